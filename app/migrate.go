@@ -0,0 +1,63 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+
+	"collab-editor/pkg/config"
+	"collab-editor/pkg/db"
+)
+
+// RunMigrate runs the migrate subcommand:
+//
+//	migrate [up]        apply all pending migrations
+//	migrate down [n]    revert the last n migrations (default 1)
+//	migrate status      list migrations and when they were applied
+func RunMigrate(args []string) error {
+	cfg := config.Load()
+
+	conn, err := db.OpenPostgres(cfg.GetDatabaseConnectionString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	migrator, err := db.NewMigrator(conn)
+	if err != nil {
+		return err
+	}
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		return migrator.Down(steps)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-30s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down or status)", command)
+	}
+}
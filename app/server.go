@@ -1,13 +1,22 @@
 package app
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"collab-editor/pkg/config"
 	"collab-editor/pkg/db"
+	"collab-editor/pkg/diagnostics"
+	"collab-editor/pkg/format"
+	"collab-editor/pkg/gitsync"
 	"collab-editor/pkg/handlers"
+	"collab-editor/pkg/identity"
 	"collab-editor/pkg/room"
+	"collab-editor/pkg/webhook"
 
 	"github.com/gorilla/mux"
 )
@@ -19,6 +28,8 @@ type Server struct {
 	handlers    *handlers.Handlers
 	docStore    db.IDocumentStore
 	config      *config.Config
+	stopGitSync chan struct{}
+	stopHooks   chan struct{}
 }
 
 // NewServer creates a new server instance
@@ -26,35 +37,109 @@ func NewServer() *Server {
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize PostgreSQL storage
-	docStore, err := db.NewPostgresDocumentStore(cfg.GetDatabaseConnectionString())
+	// Initialize document storage
+	docStore, err := newDocumentStore(cfg)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		log.Fatalf("Failed to initialize document storage: %v", err)
 	}
 
-	roomManager := room.NewRoomManager(*docStore)
+	roomManager := room.NewRoomManager(docStore)
+
+	// Check documents for problems as they are edited, and tell their rooms
+	roomManager.SetDiagnostics(diagnostics.NewRegistry())
+
+	// Push edits made outside the server (e.g. files on disk) into live rooms
+	if notifier, ok := docStore.(db.ChangeNotifier); ok {
+		go roomManager.WatchExternalChanges(notifier.Changes())
+	}
+
+	// Commit documents to local git repositories, if configured
+	gitSyncer, stopGitSync := newGitSyncer(cfg, roomManager)
+
+	// Tell registered endpoints about document events
+	dispatcher, stopHooks := newWebhookDispatcher(cfg, roomManager)
 
 	// Initialize handlers
-	h := handlers.NewHandlers(roomManager)
+	h := handlers.NewHandlers(roomManager, gitSyncer, dispatcher, identity.NewIssuer(cfg.Identity.Secret), newFormatRegistry(cfg))
 
 	// Setup routes
 	r := mux.NewRouter()
 
+	// WebSocket endpoint for a user's notifications, wherever they are.
+	// Registered first so it isn't taken for a room.
+	r.HandleFunc("/ws/notifications", h.HandleNotificationsWebSocket)
+
 	// WebSocket endpoint for real-time collaboration
 	r.HandleFunc("/ws/{roomId}", h.HandleWebSocket)
 
-	// REST API endpoints (read-only for documents)
+	// WebSocket endpoint for multi-file projects (every document in a folder)
+	r.HandleFunc("/ws/projects/{projectId}", h.HandleProjectWebSocket)
+
+	// REST API endpoints
 	r.HandleFunc("/api/documents", h.CreateDocument).Methods("POST")
 	r.HandleFunc("/api/documents", h.ListDocuments).Methods("GET")
 	r.HandleFunc("/api/documents/{id}", h.GetDocument).Methods("GET")
+	r.HandleFunc("/api/documents/{id}", h.UpdateDocument).Methods("PATCH")
+	r.HandleFunc("/api/documents/{id}/content", h.ReplaceDocumentContent).Methods("PUT")
 	r.HandleFunc("/api/documents/{id}", h.DeleteDocument).Methods("DELETE")
+	r.HandleFunc("/api/documents/{id}/folder", h.MoveDocument).Methods("PUT")
+	r.HandleFunc("/api/documents/{id}/export", h.ExportDocument).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/format", h.FormatDocument).Methods("POST")
+	r.HandleFunc("/api/documents/{id}/revisions", h.ListRevisions).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/revisions/{version}", h.GetRevision).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/tags", h.CreateTag).Methods("POST")
+	r.HandleFunc("/api/documents/{id}/tags", h.ListTags).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/tags/{name}", h.DeleteTag).Methods("DELETE")
+	r.HandleFunc("/api/documents/{id}/diff", h.DiffDocument).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/merge", h.MergeDocument).Methods("POST")
+	r.HandleFunc("/api/documents/{id}/stream", h.StreamDocument).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/chat", h.ListChatMessages).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/comments", h.ListCommentThreads).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/comments", h.CreateCommentThread).Methods("POST")
+	r.HandleFunc("/api/documents/{id}/comments/{threadId}", h.GetCommentThread).Methods("GET")
+	r.HandleFunc("/api/documents/{id}/comments/{threadId}", h.UpdateCommentThread).Methods("PATCH")
+	r.HandleFunc("/api/documents/{id}/comments/{threadId}", h.DeleteCommentThread).Methods("DELETE")
+	r.HandleFunc("/api/documents/{id}/comments/{threadId}/replies", h.ReplyToCommentThread).Methods("POST")
 	r.HandleFunc("/api/rooms/{roomId}/users", h.GetRoomUsers).Methods("GET")
+	r.HandleFunc("/api/notifications", h.ListNotifications).Methods("GET")
+	r.HandleFunc("/api/notifications/read", h.MarkNotificationsRead).Methods("POST")
+
+	// Workspaces and folders
+	r.HandleFunc("/api/workspaces", h.CreateWorkspace).Methods("POST")
+	r.HandleFunc("/api/workspaces", h.ListWorkspaces).Methods("GET")
+	r.HandleFunc("/api/workspaces/{id}", h.GetWorkspace).Methods("GET")
+	r.HandleFunc("/api/workspaces/{id}", h.RenameWorkspace).Methods("PATCH")
+	r.HandleFunc("/api/workspaces/{id}", h.DeleteWorkspace).Methods("DELETE")
+	r.HandleFunc("/api/workspaces/{id}/folders", h.ListFolders).Methods("GET")
+	r.HandleFunc("/api/folders", h.CreateFolder).Methods("POST")
+	r.HandleFunc("/api/folders/{id}", h.GetFolder).Methods("GET")
+	r.HandleFunc("/api/folders/{id}", h.UpdateFolder).Methods("PATCH")
+	r.HandleFunc("/api/folders/{id}", h.DeleteFolder).Methods("DELETE")
+	r.HandleFunc("/api/search", h.SearchDocuments).Methods("GET")
+	r.HandleFunc("/api/export", h.ExportDocuments).Methods("GET")
+	r.HandleFunc("/api/import", h.ImportDocuments).Methods("POST")
+
+	// Git sync (needs GIT_SYNC_ROOT)
+	r.HandleFunc("/api/git/bindings", h.CreateGitBinding).Methods("POST")
+	r.HandleFunc("/api/git/bindings", h.ListGitBindings).Methods("GET")
+	r.HandleFunc("/api/git/bindings/{id}", h.GetGitBinding).Methods("GET")
+	r.HandleFunc("/api/git/bindings/{id}", h.DeleteGitBinding).Methods("DELETE")
+	r.HandleFunc("/api/git/bindings/{id}/commit", h.CommitGitBinding).Methods("POST")
+	r.HandleFunc("/api/git/bindings/{id}/import", h.ImportGitBinding).Methods("POST")
+
+	// Webhooks (PostgreSQL storage only)
+	r.HandleFunc("/api/webhooks", h.CreateWebhook).Methods("POST")
+	r.HandleFunc("/api/webhooks", h.ListWebhooks).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}", h.GetWebhook).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+	r.HandleFunc("/api/webhooks/{id}/deliveries", h.ListWebhookDeliveries).Methods("GET")
+	r.HandleFunc("/api/webhooks/{id}/ping", h.PingWebhook).Methods("POST")
 
 	// CORS middleware
 	r.Use(func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 			if r.Method == "OPTIONS" {
@@ -72,6 +157,94 @@ func NewServer() *Server {
 		handlers:    h,
 		docStore:    docStore,
 		config:      cfg,
+		stopGitSync: stopGitSync,
+		stopHooks:   stopHooks,
+	}
+}
+
+// newGitSyncer creates the git syncer and starts its scheduler. It returns
+// nil if git sync isn't configured or the storage backend can't support it.
+func newGitSyncer(cfg *config.Config, roomManager *room.RoomManager) (*gitsync.Syncer, chan struct{}) {
+	if cfg.Git.Root == "" {
+		return nil, nil
+	}
+
+	syncer, err := gitsync.NewSyncer(gitsync.Config{
+		Root:           cfg.Git.Root,
+		CommitterName:  cfg.Git.CommitterName,
+		CommitterEmail: cfg.Git.CommitterEmail,
+		EmailDomain:    cfg.Git.EmailDomain,
+	}, roomManager)
+	if err != nil {
+		log.Printf("Git sync disabled: %v", err)
+		return nil, nil
+	}
+
+	interval := time.Duration(cfg.Git.SyncInterval) * time.Second
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	stop := make(chan struct{})
+	go syncer.RunScheduler(interval, stop)
+	log.Printf("Git sync enabled for repositories under %s", cfg.Git.Root)
+
+	return syncer, stop
+}
+
+// newWebhookDispatcher creates the webhook dispatcher, subscribes it to the
+// room manager's events and starts it. It returns nil if the storage backend
+// can't keep webhooks.
+func newWebhookDispatcher(cfg *config.Config, roomManager *room.RoomManager) (*webhook.Dispatcher, chan struct{}) {
+	dispatcher, err := webhook.NewDispatcher(webhook.Config{
+		MaxAttempts:  cfg.Webhook.MaxAttempts,
+		Backoff:      time.Duration(cfg.Webhook.RetryBase) * time.Second,
+		MaxBackoff:   time.Duration(cfg.Webhook.RetryMax) * time.Second,
+		Timeout:      time.Duration(cfg.Webhook.Timeout) * time.Second,
+		AllowPrivate: cfg.Webhook.AllowPrivate,
+	}, roomManager)
+	if err != nil {
+		log.Printf("Webhooks disabled: %v", err)
+		return nil, nil
+	}
+
+	roomManager.Listen(dispatcher.Handle)
+
+	stop := make(chan struct{})
+	go dispatcher.Run(5*time.Second, stop)
+
+	return dispatcher, stop
+}
+
+// newFormatRegistry creates the formatters: Go's built in, plus any external
+// commands configured. Invalid configuration is logged and skipped.
+func newFormatRegistry(cfg *config.Config) *format.Registry {
+	registry := format.NewRegistry(time.Duration(cfg.Format.Timeout) * time.Second)
+
+	commands, err := format.ParseCommands(cfg.Format.Commands)
+	if err != nil {
+		log.Printf("External formatters disabled: %v", err)
+		return registry
+	}
+	for language, command := range commands {
+		registry.Register(language, command)
+	}
+	if len(commands) > 0 {
+		log.Printf("Formatters available for %s", strings.Join(registry.Languages(), ", "))
+	}
+	return registry
+}
+
+// newDocumentStore creates the document store selected by the configuration
+func newDocumentStore(cfg *config.Config) (db.IDocumentStore, error) {
+	switch cfg.Storage.Backend {
+	case "filesystem":
+		log.Printf("Using filesystem document storage at %s", cfg.Storage.Root)
+		return db.NewFileDocumentStore(cfg.Storage.Root)
+	case "postgres", "":
+		return db.NewPostgresDocumentStore(cfg.GetDatabaseConnectionString())
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
 	}
 }
 
@@ -104,7 +277,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Always advertise the allowed methods
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 
 		// If the browser asked for specific headers, echo them back; otherwise allow common headers
 		if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
@@ -116,6 +289,9 @@ func corsMiddleware(next http.Handler) http.Handler {
 		// Allow caching preflight for a short duration
 		w.Header().Set("Access-Control-Max-Age", "600")
 
+		// Let browsers read the pagination cursor
+		w.Header().Set("Access-Control-Expose-Headers", "X-Next-Cursor")
+
 		// Inform caches that response varies by Origin and Access-Control-Request-Headers
 		w.Header().Add("Vary", "Origin")
 		w.Header().Add("Vary", "Access-Control-Request-Headers")
@@ -132,8 +308,14 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 // Close closes the server and database connections
 func (s *Server) Close() error {
-	if postgresStore, ok := s.docStore.(*db.PostgresDocumentStore); ok {
-		return postgresStore.Close()
+	if s.stopGitSync != nil {
+		close(s.stopGitSync)
+	}
+	if s.stopHooks != nil {
+		close(s.stopHooks)
+	}
+	if closer, ok := s.docStore.(io.Closer); ok {
+		return closer.Close()
 	}
 	return nil
 }
@@ -2,11 +2,19 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"collab-editor/app"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := app.RunMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	server := app.NewServer()
 	log.Fatal(server.Start(""))
 }
@@ -12,6 +12,11 @@ import (
 type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
+	Storage  StorageConfig
+	Git      GitConfig
+	Identity IdentityConfig
+	Webhook  WebhookConfig
+	Format   FormatConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -29,6 +34,41 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// StorageConfig selects where documents are persisted
+type StorageConfig struct {
+	Backend string // "postgres" or "filesystem"
+	Root    string // root directory for the filesystem backend
+}
+
+// GitConfig configures syncing documents to local git repositories
+type GitConfig struct {
+	Root           string // directory holding the repositories; empty disables git sync
+	CommitterName  string
+	CommitterEmail string
+	EmailDomain    string // author emails are username@EmailDomain
+	SyncInterval   int    // seconds between checks for scheduled commits
+}
+
+// IdentityConfig configures the identities issued to collaborators
+type IdentityConfig struct {
+	Secret string // signs identity tokens; random per process when empty
+}
+
+// WebhookConfig configures how webhook deliveries are sent and retried
+type WebhookConfig struct {
+	MaxAttempts  int  // attempts before a delivery is given up on
+	RetryBase    int  // seconds before the first retry; doubles after each failure
+	RetryMax     int  // seconds the delay between retries is capped at
+	Timeout      int  // seconds each request may take
+	AllowPrivate bool // webhooks may target loopback and private addresses
+}
+
+// FormatConfig configures the formatters behind the format command
+type FormatConfig struct {
+	Commands string // external formatters, "language=command args;..."
+	Timeout  int    // seconds a formatter may run
+}
+
 // Load loads configuration from environment variables and .env file
 func Load() *Config {
 	// Load .env file if it exists (ignore error if file doesn't exist)
@@ -49,6 +89,31 @@ func Load() *Config {
 			DBName:   getEnv("DB_NAME", "collab_editor"),
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
+		Storage: StorageConfig{
+			Backend: getEnv("STORAGE_BACKEND", "postgres"),
+			Root:    getEnv("STORAGE_ROOT", "./documents"),
+		},
+		Git: GitConfig{
+			Root:           getEnv("GIT_SYNC_ROOT", ""),
+			CommitterName:  getEnv("GIT_SYNC_COMMITTER_NAME", "Collab Editor"),
+			CommitterEmail: getEnv("GIT_SYNC_COMMITTER_EMAIL", "collab-editor@localhost"),
+			EmailDomain:    getEnv("GIT_SYNC_EMAIL_DOMAIN", "users.collab-editor.local"),
+			SyncInterval:   getEnvAsInt("GIT_SYNC_INTERVAL", 30),
+		},
+		Identity: IdentityConfig{
+			Secret: getEnv("IDENTITY_SECRET", ""),
+		},
+		Webhook: WebhookConfig{
+			MaxAttempts:  getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+			RetryBase:    getEnvAsInt("WEBHOOK_RETRY_BASE", 10),
+			RetryMax:     getEnvAsInt("WEBHOOK_RETRY_MAX", 3600),
+			Timeout:      getEnvAsInt("WEBHOOK_TIMEOUT", 10),
+			AllowPrivate: getEnvAsBool("WEBHOOK_ALLOW_PRIVATE", false),
+		},
+		Format: FormatConfig{
+			Commands: getEnv("FORMAT_COMMANDS", ""),
+			Timeout:  getEnvAsInt("FORMAT_TIMEOUT", 10),
+		},
 	}
 }
 
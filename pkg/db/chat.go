@@ -0,0 +1,29 @@
+package db
+
+import "time"
+
+const (
+	// DefaultChatLimit is the page size used when listing chat history
+	DefaultChatLimit = 50
+	// MaxChatLimit caps a page of chat history
+	MaxChatLimit = 200
+)
+
+// ChatMessage is one message in a document's chat. UserID is the sender's
+// identity, not its session.
+type ChatMessage struct {
+	ID         int64     `json:"id"`
+	DocumentID string    `json:"document_id"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	Content    string    `json:"content"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ChatStore is implemented by stores that keep a document's chat history
+type ChatStore interface {
+	CreateChatMessage(message *ChatMessage) (*ChatMessage, error)
+	// ListChatMessages returns up to limit messages older than the message
+	// with id before (the newest ones when before is 0), newest first
+	ListChatMessages(documentID string, before int64, limit int) ([]*ChatMessage, error)
+}
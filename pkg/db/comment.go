@@ -0,0 +1,52 @@
+package db
+
+import "time"
+
+// CommentThread is a discussion attached to a range of a document. Start and
+// End are offsets into the content, in the same units as operation
+// positions; the room shifts them as the text around them is edited.
+type CommentThread struct {
+	ID         string     `json:"id"`
+	DocumentID string     `json:"document_id"`
+	Start      int        `json:"start"`
+	End        int        `json:"end"`
+	Quote      string     `json:"quote"` // the anchored text when the thread was opened
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Comments   []*Comment `json:"comments"`
+}
+
+// Comment is one message in a thread; the first one opens it
+type Comment struct {
+	ID        string    `json:"id"`
+	ThreadID  string    `json:"thread_id"`
+	AuthorID  string    `json:"author_id,omitempty"` // identity id, empty for REST authors
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentAnchor is the range a thread is attached to
+type CommentAnchor struct {
+	ThreadID string
+	Start    int
+	End      int
+}
+
+// CommentStore is implemented by stores that keep comment threads
+type CommentStore interface {
+	// CreateCommentThread stores a thread opened with its first comment
+	CreateCommentThread(thread *CommentThread, first *Comment) (*CommentThread, error)
+	GetCommentThread(id string) (*CommentThread, error)
+	// ListCommentThreads returns a document's threads with their comments,
+	// in document order
+	ListCommentThreads(documentID string) ([]*CommentThread, error)
+	AddComment(comment *Comment) (*Comment, error)
+	ResolveCommentThread(id string, resolved bool, by string) (*CommentThread, error)
+	UpdateCommentAnchors(anchors []CommentAnchor) error
+	DeleteCommentThread(id string) error
+}
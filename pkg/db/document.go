@@ -8,6 +8,8 @@ type Document struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	Language  string    `json:"language,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	FolderID  *string   `json:"folder_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 	Version   int       `json:"version"`
@@ -15,19 +17,31 @@ type Document struct {
 
 // DocumentStore interface for document persistence
 type IDocumentStore interface {
-	CreateDocument(title, content, language string) (*Document, error)
+	CreateDocument(doc *NewDocument) (*Document, error)
 	GetDocument(id string) (*Document, error)
 	// UpdateDocument applies partial updates. Use pointer fields in DocumentUpdate
 	// to indicate which fields should be modified.
 	UpdateDocument(id string, updates *DocumentUpdate) (*Document, error)
 	DeleteDocument(id string) error
-	ListDocuments() ([]*Document, error)
+	ListDocuments(opts *ListOptions) (*DocumentPage, error)
+}
+
+// NewDocument holds the fields for creating a document
+type NewDocument struct {
+	Title    string  `json:"title"`
+	Content  string  `json:"content"`
+	Language string  `json:"language"`
+	Owner    string  `json:"owner"`
+	FolderID *string `json:"folder_id"`
 }
 
 // DocumentUpdate represents partial updates to a document. Pointer fields
 // allow distinguishing between "not provided" (nil) and "set to empty".
+// When ExpectedVersion is set the update only applies if the stored document
+// is still at that version; otherwise a *VersionConflictError is returned.
 type DocumentUpdate struct {
-	Title    *string `json:"title,omitempty"`
-	Content  *string `json:"content,omitempty"`
-	Language *string `json:"language,omitempty"`
+	Title           *string `json:"title,omitempty"`
+	Content         *string `json:"content,omitempty"`
+	Language        *string `json:"language,omitempty"`
+	ExpectedVersion *int    `json:"version,omitempty"`
 }
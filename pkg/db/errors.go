@@ -1,7 +1,44 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	ErrDocumentNotFound = errors.New("document not found")
+	ErrPathExists       = errors.New("a document already exists at this path")
+	ErrVersionConflict  = errors.New("document version conflict")
+
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+	ErrFolderNotFound    = errors.New("folder not found")
+	ErrFolderExists      = errors.New("a folder with this name already exists here")
+	ErrInvalidMove       = errors.New("invalid move")
+
+	ErrGitBindingNotFound = errors.New("git binding not found")
+
+	ErrRevisionNotFound = errors.New("revision not found")
+	ErrTagNotFound      = errors.New("tag not found")
+	ErrTagExists        = errors.New("a tag with this name already exists")
+
+	ErrCommentThreadNotFound = errors.New("comment thread not found")
+
+	ErrWebhookNotFound = errors.New("webhook not found")
 )
+
+// VersionConflictError is returned when an update was based on a version of
+// the document that is no longer the stored one. It matches ErrVersionConflict
+// with errors.Is.
+type VersionConflictError struct {
+	ID       string
+	Expected int
+	Actual   int
+}
+
+func (e *VersionConflictError) Error() string {
+	return fmt.Sprintf("document %s: expected version %d but found %d", e.ID, e.Expected, e.Actual)
+}
+
+func (e *VersionConflictError) Is(target error) bool {
+	return target == ErrVersionConflict
+}
@@ -0,0 +1,639 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+)
+
+// indexFileName is the sidecar file holding document metadata under the root
+const indexFileName = ".collab-index.json"
+
+// ChangeNotifier is implemented by stores whose documents can be modified
+// outside of the server (e.g. by editing files on disk).
+type ChangeNotifier interface {
+	Changes() <-chan *Document
+}
+
+// fileEntry is the metadata kept in the sidecar index for a single file
+type fileEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+}
+
+// FileDocumentStore implements DocumentStore on top of a directory of plain
+// files. Each document maps to one file under root; titles, languages and
+// versions are kept in a sidecar index since the files themselves can't
+// carry them.
+type FileDocumentStore struct {
+	root    string
+	entries map[string]*fileEntry // keyed by document id
+	// written holds, by path, the hashes of our own writes the watcher
+	// hasn't caught up with yet, see refreshPath
+	written map[string][]string
+	mutex   sync.RWMutex
+	watcher *fsnotify.Watcher
+	changes chan *Document
+	done    chan struct{}
+}
+
+// NewFileDocumentStore creates a document store rooted at the given directory.
+// Files already present under root are indexed as documents.
+func NewFileDocumentStore(root string) (*FileDocumentStore, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve root: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create root: %w", err)
+	}
+
+	s := &FileDocumentStore{
+		root:    root,
+		entries: make(map[string]*fileEntry),
+		written: make(map[string][]string),
+		changes: make(chan *Document, 64),
+		done:    make(chan struct{}),
+	}
+
+	if err := s.loadIndex(); err != nil {
+		return nil, fmt.Errorf("failed to load index: %w", err)
+	}
+	if err := s.syncIndex(); err != nil {
+		return nil, fmt.Errorf("failed to sync index: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create watcher: %w", err)
+	}
+	s.watcher = watcher
+	if err := s.watchTree(root); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("failed to watch root: %w", err)
+	}
+
+	go s.watch()
+
+	return s, nil
+}
+
+// Close stops watching the root directory
+func (s *FileDocumentStore) Close() error {
+	close(s.done)
+	return s.watcher.Close()
+}
+
+// Changes returns a channel of documents whose files were modified externally
+func (s *FileDocumentStore) Changes() <-chan *Document {
+	return s.changes
+}
+
+func (s *FileDocumentStore) CreateDocument(newDoc *NewDocument) (*Document, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := uuid.New().String()
+	path, err := s.pathForTitle(newDoc.Title, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	entry := &fileEntry{
+		ID:        id,
+		Path:      path,
+		Title:     newDoc.Title,
+		Language:  newDoc.Language,
+		Owner:     newDoc.Owner,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+
+	content := newDoc.Content
+	if err := s.writeFile(entry, content); err != nil {
+		return nil, fmt.Errorf("failed to create document: %w", err)
+	}
+
+	s.entries[id] = entry
+	if err := s.saveIndex(); err != nil {
+		return nil, fmt.Errorf("failed to create document: %w", err)
+	}
+
+	return entry.document(content), nil
+}
+
+func (s *FileDocumentStore) GetDocument(id string) (*Document, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+
+	content, err := os.ReadFile(s.abs(entry.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	return entry.document(string(content)), nil
+}
+
+func (s *FileDocumentStore) UpdateDocument(id string, updates *DocumentUpdate) (*Document, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return nil, ErrDocumentNotFound
+	}
+
+	data, err := os.ReadFile(s.abs(entry.Path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+	content := string(data)
+
+	if updates.ExpectedVersion != nil && *updates.ExpectedVersion != entry.Version {
+		return nil, &VersionConflictError{ID: id, Expected: *updates.ExpectedVersion, Actual: entry.Version}
+	}
+
+	if updates.Title == nil && updates.Content == nil && updates.Language == nil {
+		// Nothing to update; return current document
+		return entry.document(content), nil
+	}
+
+	if updates.Title != nil && *updates.Title != entry.Title {
+		path, err := s.pathForTitle(*updates.Title, entry.ID)
+		if err != nil {
+			return nil, err
+		}
+		if path != entry.Path {
+			if err := os.MkdirAll(filepath.Dir(s.abs(path)), 0o755); err != nil {
+				return nil, fmt.Errorf("failed to update document: %w", err)
+			}
+			if err := os.Rename(s.abs(entry.Path), s.abs(path)); err != nil {
+				return nil, fmt.Errorf("failed to update document: %w", err)
+			}
+			entry.Path = path
+		}
+		entry.Title = *updates.Title
+	}
+	if updates.Language != nil {
+		entry.Language = *updates.Language
+	}
+	if updates.Content != nil && *updates.Content != content {
+		content = *updates.Content
+		if err := s.writeFile(entry, content); err != nil {
+			return nil, fmt.Errorf("failed to update document: %w", err)
+		}
+	}
+
+	entry.UpdatedAt = time.Now()
+	entry.Version++
+
+	if err := s.saveIndex(); err != nil {
+		return nil, fmt.Errorf("failed to update document: %w", err)
+	}
+
+	return entry.document(content), nil
+}
+
+func (s *FileDocumentStore) DeleteDocument(id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, ok := s.entries[id]
+	if !ok {
+		return ErrDocumentNotFound
+	}
+
+	if err := os.Remove(s.abs(entry.Path)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+
+	delete(s.entries, id)
+	delete(s.written, entry.Path)
+	return s.saveIndex()
+}
+
+func (s *FileDocumentStore) ListDocuments(opts *ListOptions) (*DocumentPage, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+
+	s.mutex.RLock()
+	documents := make([]*Document, 0, len(s.entries))
+	for _, entry := range s.entries {
+		documents = append(documents, entry.document(""))
+	}
+	s.mutex.RUnlock()
+
+	page, err := listInMemory(documents, opts)
+	if err != nil || opts.Summary {
+		return page, err
+	}
+
+	// Only read the files that made it onto the page
+	for _, doc := range page.Documents {
+		content, err := s.readContent(doc.ID)
+		if err != nil {
+			log.Printf("failed to read %s: %v", doc.Title, err)
+			continue
+		}
+		doc.Content = content
+	}
+
+	return page, nil
+}
+
+// readContent reads the current file content for a document
+func (s *FileDocumentStore) readContent(id string) (string, error) {
+	s.mutex.RLock()
+	entry, ok := s.entries[id]
+	if !ok {
+		s.mutex.RUnlock()
+		return "", ErrDocumentNotFound
+	}
+	path := s.abs(entry.Path)
+	s.mutex.RUnlock()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// watch consumes filesystem events and publishes externally modified documents
+func (s *FileDocumentStore) watch() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("file watcher error: %v", err)
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			s.handleEvent(event)
+		}
+	}
+}
+
+// handleEvent reacts to one filesystem event. The index and hidden files,
+// which include the temp files writeFile renames into place, are ignored.
+func (s *FileDocumentStore) handleEvent(event fsnotify.Event) {
+	rel, err := filepath.Rel(s.root, event.Name)
+	if err != nil || rel == indexFileName || isHidden(rel) {
+		return
+	}
+	rel = filepath.ToSlash(rel)
+
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+			if err := s.watchTree(event.Name); err != nil {
+				log.Printf("failed to watch %s: %v", rel, err)
+			}
+			return
+		}
+	}
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		s.forgetPath(rel)
+		return
+	}
+
+	if event.Has(fsnotify.Create) || event.Has(fsnotify.Write) {
+		if doc := s.refreshPath(rel); doc != nil {
+			select {
+			case s.changes <- doc:
+			default:
+				log.Printf("dropping external change for %s: listener is behind", doc.ID)
+			}
+		}
+	}
+}
+
+// maxPendingWrites bounds the own writes remembered per path
+const maxPendingWrites = 16
+
+// refreshPath re-reads a file after an external write. It returns the updated
+// document, or nil if the content is unchanged or one of our own writes.
+// Writes in quick succession can have the event for an earlier one read
+// after a later one recorded its hash; that content is ours too, and the
+// later write's event is still to come.
+func (s *FileDocumentStore) refreshPath(rel string) *Document {
+	data, err := os.ReadFile(s.abs(rel))
+	if err != nil {
+		return nil
+	}
+	content := string(data)
+	hash := hashContent(content)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := s.entryForPath(rel)
+	if entry == nil {
+		entry = newFileEntry(rel)
+		entry.Hash = hash
+		s.entries[entry.ID] = entry
+	} else if entry.Hash == hash {
+		delete(s.written, rel)
+		return nil
+	} else if slices.Contains(s.written[rel], hash) {
+		return nil
+	} else {
+		entry.Hash = hash
+		entry.UpdatedAt = time.Now()
+		entry.Version++
+	}
+
+	if err := s.saveIndex(); err != nil {
+		log.Printf("failed to save index: %v", err)
+	}
+
+	return entry.document(content)
+}
+
+func (s *FileDocumentStore) forgetPath(rel string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry := s.entryForPath(rel)
+	if entry == nil {
+		return
+	}
+	if _, err := os.Stat(s.abs(rel)); err == nil {
+		// Replaced atomically (write to temp + rename); still there
+		return
+	}
+
+	delete(s.entries, entry.ID)
+	if err := s.saveIndex(); err != nil {
+		log.Printf("failed to save index: %v", err)
+	}
+}
+
+// watchTree adds a watch for dir and every directory below it
+func (s *FileDocumentStore) watchTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != s.root && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return s.watcher.Add(path)
+	})
+}
+
+// loadIndex reads the sidecar index if one exists
+func (s *FileDocumentStore) loadIndex() error {
+	data, err := os.ReadFile(filepath.Join(s.root, indexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var entries []*fileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		s.entries[entry.ID] = entry
+	}
+	return nil
+}
+
+// syncIndex reconciles the index with what is actually on disk: files that
+// disappeared are dropped, new files are added and changed files get a new
+// version.
+func (s *FileDocumentStore) syncIndex() error {
+	seen := make(map[string]bool)
+
+	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(s.root, path)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if isHidden(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		hash := hashContent(string(data))
+		seen[rel] = true
+
+		entry := s.entryForPath(rel)
+		if entry == nil {
+			entry = newFileEntry(rel)
+			s.entries[entry.ID] = entry
+		} else if entry.Hash != hash {
+			entry.UpdatedAt = time.Now()
+			entry.Version++
+		}
+		entry.Hash = hash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for id, entry := range s.entries {
+		if !seen[entry.Path] {
+			delete(s.entries, id)
+		}
+	}
+
+	return s.saveIndex()
+}
+
+// saveIndex atomically rewrites the sidecar index. Callers must hold the lock.
+func (s *FileDocumentStore) saveIndex() error {
+	entries := make([]*fileEntry, 0, len(s.entries))
+	for _, entry := range s.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.root, indexFileName+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.root, indexFileName))
+}
+
+// writeFile writes content for entry, recording its hash first so the
+// watcher recognises the resulting event as our own write. The content goes
+// to a hidden temp file in the same directory that is then renamed into
+// place, so the watcher, and anyone else reading the file, never sees it
+// half written.
+func (s *FileDocumentStore) writeFile(entry *fileEntry, content string) error {
+	entry.Hash = hashContent(content)
+	written := append(s.written[entry.Path], entry.Hash)
+	if len(written) > maxPendingWrites {
+		written = written[len(written)-maxPendingWrites:]
+	}
+	s.written[entry.Path] = written
+	path := s.abs(entry.Path)
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	// The leading dot keeps the temp file hidden from the watcher and index
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// pathForTitle maps a document title to a relative file path. Titles may
+// contain slashes to place documents in subdirectories, but must stay
+// inside the root. An empty title falls back to the document id.
+func (s *FileDocumentStore) pathForTitle(title, id string) (string, error) {
+	path := filepath.ToSlash(filepath.Clean("/" + strings.TrimSpace(title)))
+	path = strings.TrimPrefix(path, "/")
+	if path == "" || path == "." {
+		path = id
+	}
+	if path == indexFileName || isHidden(path) {
+		return "", fmt.Errorf("invalid document path %q", path)
+	}
+
+	if existing := s.entryForPath(path); existing != nil && existing.ID != id {
+		return "", fmt.Errorf("%w: %s", ErrPathExists, path)
+	}
+	return path, nil
+}
+
+// entryForPath finds the entry for a relative path. Callers must hold the lock.
+func (s *FileDocumentStore) entryForPath(rel string) *fileEntry {
+	for _, entry := range s.entries {
+		if entry.Path == rel {
+			return entry
+		}
+	}
+	return nil
+}
+
+func (s *FileDocumentStore) abs(rel string) string {
+	return filepath.Join(s.root, filepath.FromSlash(rel))
+}
+
+func (e *fileEntry) document(content string) *Document {
+	return &Document{
+		ID:        e.ID,
+		Title:     e.Title,
+		Content:   content,
+		Language:  e.Language,
+		Owner:     e.Owner,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		Version:   e.Version,
+	}
+}
+
+// newFileEntry creates index metadata for a file found on disk
+func newFileEntry(rel string) *fileEntry {
+	now := time.Now()
+	return &fileEntry{
+		ID:        uuid.New().String(),
+		Path:      rel,
+		Title:     rel,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+}
+
+// isHidden reports whether any element of a relative path starts with a dot
+func isHidden(rel string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if strings.HasPrefix(part, ".") && part != "." {
+			return true
+		}
+	}
+	return false
+}
+
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Compile-time check to ensure FileDocumentStore implements DocumentStore interface
+var _ IDocumentStore = (*FileDocumentStore)(nil)
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestFileStore opens a store on a fresh directory, closed when the test
+// ends
+func newTestFileStore(t *testing.T, root string) *FileDocumentStore {
+	t.Helper()
+	s, err := NewFileDocumentStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// readIndex returns the sidecar index under root, by path
+func readIndex(t *testing.T, root string) map[string]*fileEntry {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, indexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []*fileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	byPath := make(map[string]*fileEntry)
+	for _, entry := range entries {
+		byPath[entry.Path] = entry
+	}
+	return byPath
+}
+
+// TestFileStoreIndex checks that the sidecar index keeps ids, titles and
+// versions across restarts, and is reconciled with files changed while the
+// store wasn't running
+func TestFileStoreIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(t *testing.T, root string) // while the store is closed
+		wantPath    string
+		wantVersion int // of wantPath's entry; 0 if it must be gone
+		wantContent string
+	}{
+		{
+			name:        "unchanged",
+			change:      func(*testing.T, string) {},
+			wantPath:    "notes/todo.md",
+			wantVersion: 2,
+			wantContent: "- ship it\n",
+		},
+		{
+			name: "edited",
+			change: func(t *testing.T, root string) {
+				writeTestFile(t, root, "notes/todo.md", "- shipped\n")
+			},
+			wantPath:    "notes/todo.md",
+			wantVersion: 3,
+			wantContent: "- shipped\n",
+		},
+		{
+			name: "removed",
+			change: func(t *testing.T, root string) {
+				if err := os.Remove(filepath.Join(root, "notes", "todo.md")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantPath: "notes/todo.md",
+		},
+		{
+			name: "added",
+			change: func(t *testing.T, root string) {
+				writeTestFile(t, root, "new.txt", "hello\n")
+			},
+			wantPath:    "new.txt",
+			wantVersion: 1,
+			wantContent: "hello\n",
+		},
+		{
+			name: "hidden file added",
+			change: func(t *testing.T, root string) {
+				writeTestFile(t, root, ".cache/x", "ignored\n")
+			},
+			wantPath: ".cache/x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			s, err := NewFileDocumentStore(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, err := s.CreateDocument(&NewDocument{Title: "notes/todo.md", Content: "- todo\n", Language: "markdown"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := "- ship it\n"
+			if _, err := s.UpdateDocument(created.ID, &DocumentUpdate{Content: &content}); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+
+			tt.change(t, root)
+			s = newTestFileStore(t, root)
+
+			entry := readIndex(t, root)[tt.wantPath]
+			if tt.wantVersion == 0 {
+				if entry != nil {
+					t.Fatalf("%s still indexed as %+v", tt.wantPath, entry)
+				}
+				return
+			}
+			if entry == nil {
+				t.Fatalf("%s not indexed", tt.wantPath)
+			}
+			if entry.Version != tt.wantVersion {
+				t.Errorf("version %d, want %d", entry.Version, tt.wantVersion)
+			}
+			if entry.Hash != hashContent(tt.wantContent) {
+				t.Errorf("index hash isn't the file's")
+			}
+
+			doc, err := s.GetDocument(entry.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if doc.Content != tt.wantContent {
+				t.Errorf("content %q, want %q", doc.Content, tt.wantContent)
+			}
+			if tt.wantPath == "notes/todo.md" && (doc.ID != created.ID || doc.Language != "markdown") {
+				t.Errorf("got %+v, want the document created before the restart", doc)
+			}
+		})
+	}
+}
+
+// TestFileStoreWriteFile checks that writes replace the file whole, leave
+// no temp files behind, and are remembered as the store's own
+func TestFileStoreWriteFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		title   string
+		content string
+	}{
+		{name: "plain", title: "a.txt", content: "hello\n"},
+		{name: "empty", title: "empty.txt", content: ""},
+		{name: "nested", title: "src/pkg/main.go", content: "package main\n"},
+		{name: "unicode", title: "ünï.md", content: "héllo wörld ✓\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			s, err := NewFileDocumentStore(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Without the watcher, which forgets our writes once it sees them
+			s.Close()
+
+			doc, err := s.CreateDocument(&NewDocument{Title: tt.title, Content: "old content that is longer\n"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.UpdateDocument(doc.ID, &DocumentUpdate{Content: &tt.content}); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(tt.title)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.content {
+				t.Errorf("file holds %q, want %q", data, tt.content)
+			}
+
+			filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+				if strings.HasSuffix(path, ".tmp") {
+					t.Errorf("temp file %s left behind", path)
+				}
+				return err
+			})
+
+			s.mutex.RLock()
+			written := s.written[tt.title]
+			s.mutex.RUnlock()
+			if len(written) == 0 || written[len(written)-1] != hashContent(tt.content) {
+				t.Errorf("write not remembered as our own: %v", written)
+			}
+		})
+	}
+}
+
+// TestFileStoreRefreshPath checks how a file event is told apart: the
+// store's own writes and unchanged content aren't changes, anything else is
+func TestFileStoreRefreshPath(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		content     string // written behind the store's back; "" writes nothing
+		wantChange  bool
+		wantVersion int
+	}{
+		{name: "own write", path: "doc.txt", wantChange: false},
+		{name: "external edit", path: "doc.txt", content: "edited outside\n", wantChange: true, wantVersion: 3},
+		{name: "same content", path: "doc.txt", content: "saved\n", wantChange: false},
+		{name: "new file", path: "other.txt", content: "new\n", wantChange: true, wantVersion: 1},
+		{name: "hidden", path: ".doc.txt.123.tmp", content: "partial", wantChange: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			s, err := NewFileDocumentStore(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			doc, err := s.CreateDocument(&NewDocument{Title: "doc.txt", Content: "created\n"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved := "saved\n"
+			if _, err := s.UpdateDocument(doc.ID, &DocumentUpdate{Content: &saved}); err != nil {
+				t.Fatal(err)
+			}
+			// Events are fed to refreshPath by hand, so stop the watcher
+			s.Close()
+			if tt.content != "" {
+				writeTestFile(t, root, tt.path, tt.content)
+			}
+
+			var changed *Document
+			if !isHidden(tt.path) {
+				changed = s.refreshPath(tt.path)
+			}
+			if (changed != nil) != tt.wantChange {
+				t.Fatalf("refreshPath reported %+v, want a change: %v", changed, tt.wantChange)
+			}
+			if changed == nil {
+				return
+			}
+			if changed.Content != tt.content || changed.Version != tt.wantVersion {
+				t.Errorf("got %q at version %d, want %q at version %d", changed.Content, changed.Version, tt.content, tt.wantVersion)
+			}
+			if tt.path == "doc.txt" && changed.ID != doc.ID {
+				t.Errorf("edit reported for %s, want %s", changed.ID, doc.ID)
+			}
+		})
+	}
+}
+
+// TestFileStoreWatch checks that the watcher reports a file edited outside
+// the server on Changes, and not the store's own writes
+func TestFileStoreWatch(t *testing.T) {
+	root := t.TempDir()
+	s := newTestFileStore(t, root)
+
+	doc, err := s.CreateDocument(&NewDocument{Title: "doc.txt", Content: "created\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := "saved\n"
+	if _, err := s.UpdateDocument(doc.ID, &DocumentUpdate{Content: &saved}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeTestFile(t, root, "doc.txt", "edited outside\n")
+
+	// The edit may be seen half done first, as the file is truncated
+	// before it is written
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case changed := <-s.Changes():
+			if changed.ID != doc.ID {
+				t.Fatalf("change reported for %s, want %s", changed.ID, doc.ID)
+			}
+			if changed.Content == "created\n" || changed.Content == saved {
+				t.Fatalf("own write reported as a change: %q", changed.Content)
+			}
+			if changed.Content != "edited outside\n" {
+				continue
+			}
+			if changed.Version <= 2 {
+				t.Errorf("external edit saved as version %d, want a new version", changed.Version)
+			}
+			return
+		case <-timeout:
+			t.Fatal("external edit not reported")
+		}
+	}
+}
+
+// writeTestFile writes a file under root as an editor outside the server would
+func writeTestFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,50 @@
+package db
+
+import "time"
+
+// Workspace is a top-level area that owns a tree of folders
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Folder groups documents within a workspace. Folders nest through ParentID;
+// a nil ParentID means the folder sits at the workspace root.
+type Folder struct {
+	ID          string    `json:"id"`
+	WorkspaceID string    `json:"workspace_id"`
+	ParentID    *string   `json:"parent_id"`
+	Name        string    `json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// FolderUpdate represents partial updates to a folder. A ParentID pointing
+// at an empty string moves the folder to the workspace root.
+type FolderUpdate struct {
+	Name     *string `json:"name,omitempty"`
+	ParentID *string `json:"parent_id,omitempty"`
+}
+
+// FolderStore is implemented by stores that support workspaces and folders
+type FolderStore interface {
+	CreateWorkspace(name string) (*Workspace, error)
+	GetWorkspace(id string) (*Workspace, error)
+	ListWorkspaces() ([]*Workspace, error)
+	RenameWorkspace(id, name string) (*Workspace, error)
+	// DeleteWorkspace removes the workspace and its folders. Documents in
+	// those folders are kept but no longer filed anywhere.
+	DeleteWorkspace(id string) error
+
+	CreateFolder(workspaceID string, parentID *string, name string) (*Folder, error)
+	GetFolder(id string) (*Folder, error)
+	// ListFolders returns every folder in a workspace as a flat list
+	ListFolders(workspaceID string) ([]*Folder, error)
+	UpdateFolder(id string, updates *FolderUpdate) (*Folder, error)
+	DeleteFolder(id string) error
+
+	// MoveDocument files a document in a folder, or unfiles it if folderID is nil
+	MoveDocument(documentID string, folderID *string) (*Document, error)
+}
@@ -0,0 +1,29 @@
+package db
+
+import "time"
+
+// GitBinding ties a document or a folder to a path in a local git
+// repository. Exactly one of DocumentID and FolderID is set.
+type GitBinding struct {
+	ID         string  `json:"id"`
+	RepoPath   string  `json:"repo_path"` // relative to the configured repository root
+	Path       string  `json:"path"`      // file (document) or directory (folder) inside the repository
+	Branch     string  `json:"branch"`
+	DocumentID *string `json:"document_id,omitempty"`
+	FolderID   *string `json:"folder_id,omitempty"`
+	// IntervalSeconds schedules automatic commits; 0 means on demand only
+	IntervalSeconds int        `json:"interval_seconds"`
+	LastCommit      string     `json:"last_commit"`
+	LastSyncedAt    *time.Time `json:"last_synced_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// GitBindingStore is implemented by stores that can persist git bindings
+type GitBindingStore interface {
+	CreateGitBinding(binding *GitBinding) (*GitBinding, error)
+	GetGitBinding(id string) (*GitBinding, error)
+	ListGitBindings() ([]*GitBinding, error)
+	DeleteGitBinding(id string) error
+	// MarkGitBindingSynced records the commit a binding was last synced with
+	MarkGitBindingSynced(id, commit string, at time.Time) error
+}
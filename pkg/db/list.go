@@ -0,0 +1,251 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when ListOptions.Limit is unset
+	DefaultListLimit = 50
+	// MaxListLimit caps ListOptions.Limit
+	MaxListLimit = 200
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidListOptions = errors.New("invalid list options")
+)
+
+// sortColumns maps the sort keys accepted in ListOptions to columns
+var sortColumns = map[string]string{
+	"updated_at": "updated_at",
+	"created_at": "created_at",
+	"title":      "title",
+}
+
+// ListOptions filters, sorts and paginates ListDocuments. The zero value
+// lists the first page of all documents, most recently updated first.
+type ListOptions struct {
+	Language     string     // exact match
+	Title        string     // case-insensitive substring
+	Owner        string     // exact match
+	FolderID     string     // documents filed directly in this folder
+	WorkspaceID  string     // documents filed anywhere in this workspace
+	UpdatedSince *time.Time // updated_at >= UpdatedSince
+	Sort         string     // "updated_at" (default), "created_at" or "title"
+	Order        string     // "desc" (default) or "asc"
+	Limit        int        // page size, defaults to DefaultListLimit
+	Cursor       string     // NextCursor from the previous page
+	Summary      bool       // leave Content empty
+}
+
+// DocumentPage is one page of ListDocuments results
+type DocumentPage struct {
+	Documents  []*Document `json:"documents"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// DocumentSummary is the listing projection of a Document, without content
+type DocumentSummary struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	FolderID  *string   `json:"folder_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int       `json:"version"`
+}
+
+// Summary returns the summary projection of d
+func (d *Document) Summary() *DocumentSummary {
+	return &DocumentSummary{
+		ID:        d.ID,
+		Title:     d.Title,
+		Language:  d.Language,
+		Owner:     d.Owner,
+		FolderID:  d.FolderID,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		Version:   d.Version,
+	}
+}
+
+// listCursor is the decoded form of a page cursor: the sort key and id of
+// the last document on the previous page.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+// normalize fills in defaults and validates the sort and order
+func (o *ListOptions) normalize() error {
+	if o.Sort == "" {
+		o.Sort = "updated_at"
+	}
+	if _, ok := sortColumns[o.Sort]; !ok {
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidListOptions, o.Sort)
+	}
+	o.Order = strings.ToLower(o.Order)
+	if o.Order == "" {
+		o.Order = "desc"
+	}
+	if o.Order != "asc" && o.Order != "desc" {
+		return fmt.Errorf("%w: unknown order %q", ErrInvalidListOptions, o.Order)
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultListLimit
+	}
+	if o.Limit > MaxListLimit {
+		o.Limit = MaxListLimit
+	}
+	return nil
+}
+
+// decodeCursor parses o.Cursor. It returns nil when there is no cursor.
+func (o *ListOptions) decodeCursor() (*listCursor, error) {
+	if o.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(o.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != o.Sort {
+		return nil, ErrInvalidCursor
+	}
+	if o.Sort != "title" {
+		if _, err := time.Parse(time.RFC3339Nano, cursor.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &cursor, nil
+}
+
+// sortValue returns the value of the sort key for doc, as stored in cursors
+func sortValue(doc *Document, sortKey string) string {
+	switch sortKey {
+	case "created_at":
+		return doc.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "title":
+		return doc.Title
+	default:
+		return doc.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
+
+func encodeCursor(doc *Document, sortKey string) string {
+	data, _ := json.Marshal(listCursor{Sort: sortKey, Value: sortValue(doc, sortKey), ID: doc.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// paginate trims a result fetched with limit+1 rows to one page and sets the
+// next cursor if there are more
+func paginate(docs []*Document, opts *ListOptions) *DocumentPage {
+	page := &DocumentPage{Documents: docs}
+	if len(docs) > opts.Limit {
+		page.Documents = docs[:opts.Limit]
+		page.NextCursor = encodeCursor(page.Documents[opts.Limit-1], opts.Sort)
+	}
+	if page.Documents == nil {
+		page.Documents = []*Document{}
+	}
+	return page
+}
+
+// listInMemory applies opts to a full set of documents, for stores that
+// can't filter or sort natively
+func listInMemory(docs []*Document, opts *ListOptions) (*DocumentPage, error) {
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := opts.decodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.WorkspaceID != "" {
+		return nil, fmt.Errorf("%w: workspaces are not supported by this store", ErrInvalidListOptions)
+	}
+
+	title := strings.ToLower(opts.Title)
+	filtered := make([]*Document, 0, len(docs))
+	for _, doc := range docs {
+		if opts.Language != "" && doc.Language != opts.Language {
+			continue
+		}
+		if opts.Owner != "" && doc.Owner != opts.Owner {
+			continue
+		}
+		if opts.FolderID != "" && (doc.FolderID == nil || *doc.FolderID != opts.FolderID) {
+			continue
+		}
+		if title != "" && !strings.Contains(strings.ToLower(doc.Title), title) {
+			continue
+		}
+		if opts.UpdatedSince != nil && doc.UpdatedAt.Before(*opts.UpdatedSince) {
+			continue
+		}
+		filtered = append(filtered, doc)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		c := compareToCursor(filtered[i], opts.Sort, sortValue(filtered[j], opts.Sort), filtered[j].ID)
+		if opts.Order == "asc" {
+			return c < 0
+		}
+		return c > 0
+	})
+
+	start := 0
+	if cursor != nil {
+		start = sort.Search(len(filtered), func(i int) bool {
+			c := compareToCursor(filtered[i], opts.Sort, cursor.Value, cursor.ID)
+			if opts.Order == "asc" {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	end := start + opts.Limit + 1
+	if end > len(filtered) {
+		end = len(filtered)
+	}
+	page := paginate(filtered[start:end], opts)
+
+	if opts.Summary {
+		for i, doc := range page.Documents {
+			summary := *doc
+			summary.Content = ""
+			page.Documents[i] = &summary
+		}
+	}
+	return page, nil
+}
+
+// compareToCursor compares doc against a (sort value, id) position in
+// ascending order, returning -1, 0 or 1
+func compareToCursor(doc *Document, sortKey, value, id string) int {
+	if sortKey == "title" {
+		if c := strings.Compare(doc.Title, value); c != 0 {
+			return c
+		}
+	} else {
+		docTime, _ := time.Parse(time.RFC3339Nano, sortValue(doc, sortKey))
+		cursorTime, _ := time.Parse(time.RFC3339Nano, value)
+		if c := docTime.Compare(cursorTime); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(doc.ID, id)
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// listDocuments builds documents whose updated_at, created_at and title
+// orders all differ, with two sharing a title and two an updated_at so ties
+// are broken by id
+func listDocuments() []*Document {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	folder := "folder"
+	specs := []struct {
+		id, title, language string
+		updated, created    int
+		filed               bool
+	}{
+		{"a", "main.go", "go", 5, 1, true},
+		{"b", "README.md", "markdown", 3, 2, false},
+		{"c", "util.go", "go", 3, 3, true},
+		{"d", "main.go", "go", 1, 4, false},
+		{"e", "notes.txt", "plaintext", 4, 5, false},
+	}
+
+	docs := make([]*Document, len(specs))
+	for i, spec := range specs {
+		docs[i] = &Document{
+			ID:        spec.id,
+			Title:     spec.title,
+			Content:   "content of " + spec.id,
+			Language:  spec.language,
+			CreatedAt: base.Add(time.Duration(spec.created) * time.Minute),
+			UpdatedAt: base.Add(time.Duration(spec.updated) * time.Minute),
+			Version:   1,
+		}
+		if spec.filed {
+			docs[i].FolderID = &folder
+		}
+	}
+	return docs
+}
+
+// TestListInMemoryPages checks that following NextCursor visits every
+// matching document exactly once, in order, whatever the page size
+func TestListInMemoryPages(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ListOptions
+		want []string // ids, in order
+	}{
+		{name: "default", opts: ListOptions{}, want: []string{"a", "e", "c", "b", "d"}},
+		{name: "updated asc", opts: ListOptions{Order: "asc"}, want: []string{"d", "b", "c", "e", "a"}},
+		{name: "created", opts: ListOptions{Sort: "created_at"}, want: []string{"e", "d", "c", "b", "a"}},
+		{name: "title asc", opts: ListOptions{Sort: "title", Order: "ASC"}, want: []string{"b", "a", "d", "e", "c"}},
+		{name: "title desc", opts: ListOptions{Sort: "title"}, want: []string{"c", "e", "d", "a", "b"}},
+		{name: "language", opts: ListOptions{Language: "go"}, want: []string{"a", "c", "d"}},
+		{name: "title filter", opts: ListOptions{Title: "MAIN"}, want: []string{"a", "d"}},
+		{name: "folder", opts: ListOptions{FolderID: "folder"}, want: []string{"a", "c"}},
+		{name: "no match", opts: ListOptions{Language: "rust"}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 10} {
+			t.Run(fmt.Sprintf("%s/limit %d", tt.name, limit), func(t *testing.T) {
+				opts := tt.opts
+				opts.Limit = limit
+
+				got := []string{}
+				for pages := 0; ; pages++ {
+					if pages > len(tt.want) {
+						t.Fatalf("still paging after %d pages", pages)
+					}
+					page, err := listInMemory(listDocuments(), &opts)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(page.Documents) > limit {
+						t.Fatalf("page of %d documents, limit %d", len(page.Documents), limit)
+					}
+					for _, doc := range page.Documents {
+						got = append(got, doc.ID)
+					}
+					if page.NextCursor == "" {
+						break
+					}
+					opts.Cursor = page.NextCursor
+				}
+
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestListInMemoryOptions(t *testing.T) {
+	since := time.Date(2024, 5, 1, 12, 4, 0, 0, time.UTC)
+	cursor := func(opts ListOptions) string {
+		page, err := listInMemory(listDocuments(), &opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return page.NextCursor
+	}
+
+	tests := []struct {
+		name    string
+		opts    ListOptions
+		want    []string
+		wantErr error
+	}{
+		{name: "updated since", opts: ListOptions{UpdatedSince: &since}, want: []string{"a", "e"}},
+		{name: "limit capped", opts: ListOptions{Limit: MaxListLimit + 1}, want: []string{"a", "e", "c", "b", "d"}},
+		{name: "unknown sort", opts: ListOptions{Sort: "version"}, wantErr: ErrInvalidListOptions},
+		{name: "unknown order", opts: ListOptions{Order: "up"}, wantErr: ErrInvalidListOptions},
+		{name: "workspace", opts: ListOptions{WorkspaceID: "w"}, wantErr: ErrInvalidListOptions},
+		{name: "garbage cursor", opts: ListOptions{Cursor: "!!"}, wantErr: ErrInvalidCursor},
+		{
+			name:    "cursor of another sort",
+			opts:    ListOptions{Sort: "title", Cursor: cursor(ListOptions{Limit: 1})},
+			wantErr: ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := listInMemory(listDocuments(), &tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := []string{}
+			for _, doc := range page.Documents {
+				got = append(got, doc.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListInMemorySummary(t *testing.T) {
+	docs := listDocuments()
+
+	page, err := listInMemory(docs, &ListOptions{Summary: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range page.Documents {
+		if doc.Content != "" {
+			t.Errorf("%s has content in a summary listing", doc.ID)
+		}
+	}
+	for _, doc := range docs {
+		if doc.Content == "" {
+			t.Errorf("%s lost its content", doc.ID)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_documents_title;
+DROP INDEX IF EXISTS idx_documents_language;
+DROP INDEX IF EXISTS idx_documents_owner;
+
+ALTER TABLE documents DROP COLUMN IF EXISTS owner;
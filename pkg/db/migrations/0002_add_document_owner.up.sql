@@ -0,0 +1,5 @@
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_documents_owner ON documents(owner);
+CREATE INDEX IF NOT EXISTS idx_documents_language ON documents(language);
+CREATE INDEX IF NOT EXISTS idx_documents_title ON documents(title);
@@ -0,0 +1,8 @@
+-- 'simple' avoids stemming and stop words, which suits identifiers in code
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS search_vector tsvector
+	GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(content, '')), 'B')
+	) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_documents_search ON documents USING GIN (search_vector);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS workspaces (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS folders (
+	id VARCHAR(36) PRIMARY KEY,
+	workspace_id VARCHAR(36) NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+	parent_id VARCHAR(36) REFERENCES folders(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_folders_workspace_id ON folders(workspace_id);
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id ON folders(parent_id);
+-- Sibling folders must have distinct names
+CREATE UNIQUE INDEX IF NOT EXISTS idx_folders_sibling_name ON folders(workspace_id, COALESCE(parent_id, ''), name);
+
+-- Deleting a folder leaves its documents in place, just unfiled
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS folder_id VARCHAR(36) REFERENCES folders(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_documents_folder_id ON documents(folder_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS git_bindings (
+	id VARCHAR(36) PRIMARY KEY,
+	repo_path TEXT NOT NULL,
+	path TEXT NOT NULL,
+	branch VARCHAR(255) NOT NULL,
+	document_id VARCHAR(36) REFERENCES documents(id) ON DELETE CASCADE,
+	folder_id VARCHAR(36) REFERENCES folders(id) ON DELETE CASCADE,
+	interval_seconds INTEGER NOT NULL DEFAULT 0,
+	last_commit VARCHAR(64) NOT NULL DEFAULT '',
+	last_synced_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	-- A binding covers either one document or one folder
+	CHECK ((document_id IS NULL) <> (folder_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_git_bindings_document_id ON git_bindings(document_id);
+CREATE INDEX IF NOT EXISTS idx_git_bindings_folder_id ON git_bindings(folder_id);
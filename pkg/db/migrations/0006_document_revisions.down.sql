@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS documents_record_revision ON documents;
+DROP FUNCTION IF EXISTS record_document_revision();
+
+DROP TABLE IF EXISTS document_tags;
+DROP TABLE IF EXISTS document_revisions;
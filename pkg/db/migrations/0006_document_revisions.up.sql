@@ -0,0 +1,40 @@
+-- Every stored version of a document, written by a trigger so no code path
+-- that bumps documents.version can skip it
+CREATE TABLE IF NOT EXISTS document_revisions (
+	document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	language TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (document_id, version)
+);
+
+-- Named versions, e.g. "v1.0" or "before-refactor"
+CREATE TABLE IF NOT EXISTS document_tags (
+	document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	version INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (document_id, name),
+	FOREIGN KEY (document_id, version) REFERENCES document_revisions(document_id, version) ON DELETE CASCADE
+);
+
+CREATE OR REPLACE FUNCTION record_document_revision() RETURNS trigger AS $$
+BEGIN
+	INSERT INTO document_revisions (document_id, version, title, content, language, created_at)
+	VALUES (NEW.id, NEW.version, NEW.title, NEW.content, NEW.language, NEW.updated_at)
+	ON CONFLICT (document_id, version) DO NOTHING;
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS documents_record_revision ON documents;
+CREATE TRIGGER documents_record_revision
+	AFTER INSERT OR UPDATE OF version ON documents
+	FOR EACH ROW EXECUTE PROCEDURE record_document_revision();
+
+-- Existing documents start their history at their current version
+INSERT INTO document_revisions (document_id, version, title, content, language, created_at)
+SELECT id, version, title, content, language, updated_at FROM documents
+ON CONFLICT (document_id, version) DO NOTHING;
@@ -0,0 +1,11 @@
+-- In-room chat, kept with the document it was sent in
+CREATE TABLE IF NOT EXISTS chat_messages (
+	id BIGSERIAL PRIMARY KEY,
+	document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	user_id VARCHAR(36) NOT NULL,
+	username VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_document_id ON chat_messages(document_id, id DESC);
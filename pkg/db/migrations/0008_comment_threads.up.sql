@@ -0,0 +1,28 @@
+-- Review comments attached to a range of a document
+CREATE TABLE IF NOT EXISTS comment_threads (
+	id VARCHAR(36) PRIMARY KEY,
+	document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	start_offset INTEGER NOT NULL,
+	end_offset INTEGER NOT NULL,
+	quote TEXT NOT NULL DEFAULT '',
+	resolved BOOLEAN NOT NULL DEFAULT FALSE,
+	resolved_by VARCHAR(255) NOT NULL DEFAULT '',
+	resolved_at TIMESTAMP WITH TIME ZONE,
+	created_by VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	CHECK (start_offset >= 0 AND end_offset >= start_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_threads_document_id ON comment_threads(document_id);
+
+CREATE TABLE IF NOT EXISTS comments (
+	id VARCHAR(36) PRIMARY KEY,
+	thread_id VARCHAR(36) NOT NULL REFERENCES comment_threads(id) ON DELETE CASCADE,
+	author_id VARCHAR(36) NOT NULL DEFAULT '',
+	author VARCHAR(255) NOT NULL,
+	content TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_comments_thread_id ON comments(thread_id, created_at);
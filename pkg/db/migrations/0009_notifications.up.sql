@@ -0,0 +1,25 @@
+-- The name each identity last connected with, so @mentions can find them
+CREATE TABLE IF NOT EXISTS users (
+	id VARCHAR(36) PRIMARY KEY,
+	username VARCHAR(255) NOT NULL,
+	last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_users_username ON users(LOWER(username));
+
+CREATE TABLE IF NOT EXISTS notifications (
+	id BIGSERIAL PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL,
+	kind VARCHAR(50) NOT NULL,
+	document_id VARCHAR(36) NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	source VARCHAR(50) NOT NULL,
+	source_id VARCHAR(36) NOT NULL,
+	actor_id VARCHAR(36) NOT NULL DEFAULT '',
+	actor VARCHAR(255) NOT NULL,
+	excerpt TEXT NOT NULL,
+	read BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_notifications_unread ON notifications(user_id) WHERE NOT read;
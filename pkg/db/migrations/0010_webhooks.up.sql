@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+	id VARCHAR(36) PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	-- Not a foreign key: the webhook has to outlive its document to hear
+	-- that it was deleted
+	document_id VARCHAR(36),
+	workspace_id VARCHAR(36) REFERENCES workspaces(id) ON DELETE CASCADE,
+	events TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	-- A webhook covers either one document or one workspace
+	CHECK ((document_id IS NULL) <> (workspace_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_document_id ON webhooks(document_id);
+CREATE INDEX IF NOT EXISTS idx_webhooks_workspace_id ON webhooks(workspace_id);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id VARCHAR(36) NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id VARCHAR(36) NOT NULL,
+	event VARCHAR(50) NOT NULL,
+	payload TEXT NOT NULL,
+	status VARCHAR(16) NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	response_status INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL DEFAULT '',
+	next_attempt_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id, id DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
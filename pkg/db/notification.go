@@ -0,0 +1,46 @@
+package db
+
+import "time"
+
+const (
+	// DefaultNotificationLimit is the page size used when listing notifications
+	DefaultNotificationLimit = 50
+	// MaxNotificationLimit caps a page of notifications
+	MaxNotificationLimit = 200
+)
+
+// Notification tells a user something happened that involves them, such as
+// being @mentioned in chat or a comment. UserID is an identity id.
+type Notification struct {
+	ID         int64     `json:"id"`
+	UserID     string    `json:"user_id"`
+	Kind       string    `json:"kind"` // "mention"
+	DocumentID string    `json:"document_id"`
+	Source     string    `json:"source"`    // "chat" or "comment"
+	SourceID   string    `json:"source_id"` // the chat message or comment id
+	ActorID    string    `json:"actor_id,omitempty"`
+	Actor      string    `json:"actor"`
+	Excerpt    string    `json:"excerpt"`
+	Read       bool      `json:"read"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NotificationStore is implemented by stores that keep notifications and
+// the directory of names users have connected with, which mentions are
+// resolved against
+type NotificationStore interface {
+	// SaveUser records the name an identity connected with
+	SaveUser(id, username string) error
+	// FindParticipants returns the ids of identities that have sent chat or
+	// comments on a document and last connected with username, ignoring case
+	FindParticipants(documentID, username string) ([]string, error)
+
+	CreateNotification(notification *Notification) (*Notification, error)
+	// ListNotifications returns up to limit of a user's notifications older
+	// than the one with id before (the newest when before is 0), newest first
+	ListNotifications(userID string, unreadOnly bool, before int64, limit int) ([]*Notification, error)
+	CountUnreadNotifications(userID string) (int, error)
+	// MarkNotificationsRead marks the given notifications of a user read, or
+	// all of them when ids is empty, and returns how many changed
+	MarkNotificationsRead(userID string, ids []int64) (int, error)
+}
@@ -15,8 +15,8 @@ type PostgresDocumentStore struct {
 	db *sql.DB
 }
 
-// NewPostgresDocumentStore creates a new PostgreSQL document store
-func NewPostgresDocumentStore(connStr string) (*PostgresDocumentStore, error) {
+// OpenPostgres opens and pings a PostgreSQL connection pool
+func OpenPostgres(connStr string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
@@ -24,17 +24,32 @@ func NewPostgresDocumentStore(connStr string) (*PostgresDocumentStore, error) {
 
 	// Test the connection
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	store := &PostgresDocumentStore{db: db}
+	return db, nil
+}
+
+// NewPostgresDocumentStore creates a new PostgreSQL document store and brings
+// the schema up to date
+func NewPostgresDocumentStore(connStr string) (*PostgresDocumentStore, error) {
+	db, err := OpenPostgres(connStr)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create the documents table if it doesn't exist
-	if err := store.createTable(); err != nil {
-		return nil, fmt.Errorf("failed to create table: %w", err)
+	migrator, err := NewMigrator(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := migrator.Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	return store, nil
+	return &PostgresDocumentStore{db: db}, nil
 }
 
 // Close closes the database connection
@@ -42,28 +57,20 @@ func (s *PostgresDocumentStore) Close() error {
 	return s.db.Close()
 }
 
-func (s *PostgresDocumentStore) CreateDocument(title, content, language string) (*Document, error) {
+func (s *PostgresDocumentStore) CreateDocument(newDoc *NewDocument) (*Document, error) {
 	id := uuid.New().String()
 	now := time.Now()
 
 	query := `
-		INSERT INTO documents (id, title, content, language, created_at, updated_at, version)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, title, content, language, created_at, updated_at, version
-	`
-
-	doc := &Document{}
-	err := s.db.QueryRow(query, id, title, content, language, now, now, 1).Scan(
-		&doc.ID,
-		&doc.Title,
-		&doc.Content,
-		&doc.Language,
-		&doc.CreatedAt,
-		&doc.UpdatedAt,
-		&doc.Version,
-	)
+		INSERT INTO documents (id, title, content, language, owner, folder_id, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING ` + documentColumns
 
+	doc, err := scanDocument(s.db.QueryRow(query, id, newDoc.Title, newDoc.Content, newDoc.Language, newDoc.Owner, newDoc.FolderID, now, now, 1))
 	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrFolderNotFound
+		}
 		return nil, fmt.Errorf("failed to create document: %w", err)
 	}
 
@@ -71,23 +78,9 @@ func (s *PostgresDocumentStore) CreateDocument(title, content, language string)
 }
 
 func (s *PostgresDocumentStore) GetDocument(id string) (*Document, error) {
-	query := `
-		SELECT id, title, content, language, created_at, updated_at, version
-		FROM documents
-		WHERE id = $1
-	`
-
-	doc := &Document{}
-	err := s.db.QueryRow(query, id).Scan(
-		&doc.ID,
-		&doc.Title,
-		&doc.Content,
-		&doc.Language,
-		&doc.CreatedAt,
-		&doc.UpdatedAt,
-		&doc.Version,
-	)
+	query := `SELECT ` + documentColumns + ` FROM documents WHERE id = $1`
 
+	doc, err := scanDocument(s.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, ErrDocumentNotFound
@@ -122,7 +115,14 @@ func (s *PostgresDocumentStore) UpdateDocument(id string, updates *DocumentUpdat
 
 	if len(sets) == 0 {
 		// Nothing to update; return current document
-		return s.GetDocument(id)
+		doc, err := s.GetDocument(id)
+		if err != nil {
+			return nil, err
+		}
+		if updates.ExpectedVersion != nil && *updates.ExpectedVersion != doc.Version {
+			return nil, &VersionConflictError{ID: id, Expected: *updates.ExpectedVersion, Actual: doc.Version}
+		}
+		return doc, nil
 	}
 
 	// Always update updated_at and version
@@ -132,30 +132,26 @@ func (s *PostgresDocumentStore) UpdateDocument(id string, updates *DocumentUpdat
 	argPos++
 	sets = append(sets, "version = version + 1")
 
-	// Add id param
+	// Add id param, and the expected version when the update is guarded
+	where := fmt.Sprintf("id = $%d", argPos)
 	args = append(args, id)
+	argPos++
+	if updates.ExpectedVersion != nil {
+		where += fmt.Sprintf(" AND version = $%d", argPos)
+		args = append(args, *updates.ExpectedVersion)
+	}
 
 	query := fmt.Sprintf(`
 		UPDATE documents
 		SET %s
-		WHERE id = $%d
-		RETURNING id, title, content, language, created_at, updated_at, version
-	`, strings.Join(sets, ", "), argPos)
-
-	doc := &Document{}
-	err := s.db.QueryRow(query, args...).Scan(
-		&doc.ID,
-		&doc.Title,
-		&doc.Content,
-		&doc.Language,
-		&doc.CreatedAt,
-		&doc.UpdatedAt,
-		&doc.Version,
-	)
+		WHERE %s
+		RETURNING %s
+	`, strings.Join(sets, ", "), where, documentColumns)
 
+	doc, err := scanDocument(s.db.QueryRow(query, args...))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, ErrDocumentNotFound
+			return nil, s.updateMissError(id, updates)
 		}
 		return nil, fmt.Errorf("failed to update document: %w", err)
 	}
@@ -163,6 +159,25 @@ func (s *PostgresDocumentStore) UpdateDocument(id string, updates *DocumentUpdat
 	return doc, nil
 }
 
+// updateMissError works out why a guarded update matched no rows: either the
+// document is gone or its version moved on.
+func (s *PostgresDocumentStore) updateMissError(id string, updates *DocumentUpdate) error {
+	if updates.ExpectedVersion == nil {
+		return ErrDocumentNotFound
+	}
+
+	var actual int
+	err := s.db.QueryRow(`SELECT version FROM documents WHERE id = $1`, id).Scan(&actual)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrDocumentNotFound
+		}
+		return fmt.Errorf("failed to update document: %w", err)
+	}
+
+	return &VersionConflictError{ID: id, Expected: *updates.ExpectedVersion, Actual: actual}
+}
+
 func (s *PostgresDocumentStore) DeleteDocument(id string) error {
 	query := `DELETE FROM documents WHERE id = $1`
 
@@ -183,14 +198,71 @@ func (s *PostgresDocumentStore) DeleteDocument(id string) error {
 	return nil
 }
 
-func (s *PostgresDocumentStore) ListDocuments() ([]*Document, error) {
-	query := `
-		SELECT id, title, content, language, created_at, updated_at, version
-		FROM documents
-		ORDER BY updated_at DESC
-	`
+func (s *PostgresDocumentStore) ListDocuments(opts *ListOptions) (*DocumentPage, error) {
+	if opts == nil {
+		opts = &ListOptions{}
+	}
+	if err := opts.normalize(); err != nil {
+		return nil, err
+	}
+	cursor, err := opts.decodeCursor()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := documentColumns
+	if opts.Summary {
+		columns = documentSummaryColumns
+	}
+
+	where := []string{}
+	args := []interface{}{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if opts.Language != "" {
+		where = append(where, "language = "+addArg(opts.Language))
+	}
+	if opts.Owner != "" {
+		where = append(where, "owner = "+addArg(opts.Owner))
+	}
+	if opts.Title != "" {
+		where = append(where, "title ILIKE "+addArg("%"+escapeLike(opts.Title)+"%"))
+	}
+	if opts.FolderID != "" {
+		where = append(where, "folder_id = "+addArg(opts.FolderID))
+	}
+	if opts.WorkspaceID != "" {
+		where = append(where, "folder_id IN (SELECT id FROM folders WHERE workspace_id = "+addArg(opts.WorkspaceID)+")")
+	}
+	if opts.UpdatedSince != nil {
+		where = append(where, "updated_at >= "+addArg(*opts.UpdatedSince))
+	}
 
-	rows, err := s.db.Query(query)
+	sortColumn := sortColumns[opts.Sort]
+	direction, comparison := "DESC", "<"
+	if opts.Order == "asc" {
+		direction, comparison = "ASC", ">"
+	}
+
+	if cursor != nil {
+		var value interface{} = cursor.Value
+		if opts.Sort != "title" {
+			value, _ = time.Parse(time.RFC3339Nano, cursor.Value)
+		}
+		where = append(where, fmt.Sprintf("(%s, id) %s (%s, %s)", sortColumn, comparison, addArg(value), addArg(cursor.ID)))
+	}
+
+	query := `SELECT ` + columns + ` FROM documents`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	// Fetch one extra row to know whether there is a next page
+	query += fmt.Sprintf(` ORDER BY %s %s, id %s LIMIT %s`, sortColumn, direction, direction, addArg(opts.Limit+1))
+
+	rows, err := s.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list documents: %w", err)
 	}
@@ -198,16 +270,12 @@ func (s *PostgresDocumentStore) ListDocuments() ([]*Document, error) {
 
 	var documents []*Document
 	for rows.Next() {
-		doc := &Document{}
-		err := rows.Scan(
-			&doc.ID,
-			&doc.Title,
-			&doc.Content,
-			&doc.Language,
-			&doc.CreatedAt,
-			&doc.UpdatedAt,
-			&doc.Version,
-		)
+		var doc *Document
+		if opts.Summary {
+			doc, err = scanDocumentSummary(rows)
+		} else {
+			doc, err = scanDocument(rows)
+		}
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan document: %w", err)
 		}
@@ -218,7 +286,70 @@ func (s *PostgresDocumentStore) ListDocuments() ([]*Document, error) {
 		return nil, fmt.Errorf("failed to iterate rows: %w", err)
 	}
 
-	return documents, nil
+	return paginate(documents, opts), nil
+}
+
+// documentColumns is the column list scanDocument expects
+const documentColumns = `id, title, content, language, owner, folder_id, created_at, updated_at, version`
+
+// documentSummaryColumns is the column list scanDocumentSummary expects
+const documentSummaryColumns = `id, title, language, owner, folder_id, created_at, updated_at, version`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDocument scans a row selected with documentColumns
+func scanDocument(row rowScanner) (*Document, error) {
+	doc := &Document{}
+	var folderID sql.NullString
+	err := row.Scan(
+		&doc.ID,
+		&doc.Title,
+		&doc.Content,
+		&doc.Language,
+		&doc.Owner,
+		&folderID,
+		&doc.CreatedAt,
+		&doc.UpdatedAt,
+		&doc.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if folderID.Valid {
+		doc.FolderID = &folderID.String
+	}
+	return doc, nil
+}
+
+// scanDocumentSummary scans a row selected with documentSummaryColumns
+func scanDocumentSummary(row rowScanner, extra ...interface{}) (*Document, error) {
+	doc := &Document{}
+	var folderID sql.NullString
+	dest := []interface{}{
+		&doc.ID,
+		&doc.Title,
+		&doc.Language,
+		&doc.Owner,
+		&folderID,
+		&doc.CreatedAt,
+		&doc.UpdatedAt,
+		&doc.Version,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	if folderID.Valid {
+		doc.FolderID = &folderID.String
+	}
+	return doc, nil
+}
+
+// escapeLike escapes the LIKE wildcards in a user-supplied substring
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
 // Compile-time check to ensure PostgresDocumentStore implements DocumentStore interface
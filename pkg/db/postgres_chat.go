@@ -0,0 +1,79 @@
+package db
+
+import (
+	"fmt"
+	"math"
+)
+
+func (s *PostgresDocumentStore) CreateChatMessage(message *ChatMessage) (*ChatMessage, error) {
+	created := &ChatMessage{}
+
+	err := s.db.QueryRow(`
+		INSERT INTO chat_messages (document_id, user_id, username, content, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, document_id, user_id, username, content, created_at
+	`, message.DocumentID, message.UserID, message.Username, message.Content, message.CreatedAt).Scan(
+		&created.ID,
+		&created.DocumentID,
+		&created.UserID,
+		&created.Username,
+		&created.Content,
+		&created.CreatedAt,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to create chat message: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) ListChatMessages(documentID string, before int64, limit int) ([]*ChatMessage, error) {
+	if limit <= 0 {
+		limit = DefaultChatLimit
+	}
+	limit = min(limit, MaxChatLimit)
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, document_id, user_id, username, content, created_at
+		FROM chat_messages
+		WHERE document_id = $1 AND id < $2
+		ORDER BY id DESC
+		LIMIT $3
+	`, documentID, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*ChatMessage{}
+	for rows.Next() {
+		message := &ChatMessage{}
+		err := rows.Scan(
+			&message.ID,
+			&message.DocumentID,
+			&message.UserID,
+			&message.Username,
+			&message.Content,
+			&message.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return messages, nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements ChatStore interface
+var _ ChatStore = (*PostgresDocumentStore)(nil)
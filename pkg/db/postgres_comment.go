@@ -0,0 +1,312 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// commentThreadColumns is the column list scanCommentThread expects
+const commentThreadColumns = `id, document_id, start_offset, end_offset, quote, resolved, resolved_by, resolved_at, created_by, created_at, updated_at`
+
+func (s *PostgresDocumentStore) CreateCommentThread(thread *CommentThread, first *Comment) (*CommentThread, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	created, err := scanCommentThread(tx.QueryRow(`
+		INSERT INTO comment_threads (id, document_id, start_offset, end_offset, quote, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+		RETURNING `+commentThreadColumns,
+		uuid.New().String(),
+		thread.DocumentID,
+		thread.Start,
+		thread.End,
+		thread.Quote,
+		first.Author,
+		now,
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to create comment thread: %w", err)
+	}
+
+	first.ThreadID = created.ID
+	first.CreatedAt = now
+	comment, err := insertComment(tx, first)
+	if err != nil {
+		return nil, err
+	}
+	created.Comments = []*Comment{comment}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit comment thread: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) GetCommentThread(id string) (*CommentThread, error) {
+	thread, err := scanCommentThread(s.db.QueryRow(`
+		SELECT `+commentThreadColumns+`
+		FROM comment_threads
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCommentThreadNotFound
+		}
+		return nil, fmt.Errorf("failed to get comment thread: %w", err)
+	}
+
+	if err := s.loadComments(map[string]*CommentThread{thread.ID: thread}, `thread_id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	return thread, nil
+}
+
+func (s *PostgresDocumentStore) ListCommentThreads(documentID string) ([]*CommentThread, error) {
+	rows, err := s.db.Query(`
+		SELECT `+commentThreadColumns+`
+		FROM comment_threads
+		WHERE document_id = $1
+		ORDER BY start_offset, created_at
+	`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comment threads: %w", err)
+	}
+	defer rows.Close()
+
+	threads := []*CommentThread{}
+	byID := make(map[string]*CommentThread)
+	for rows.Next() {
+		thread, err := scanCommentThread(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan comment thread: %w", err)
+		}
+		threads = append(threads, thread)
+		byID[thread.ID] = thread
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	err = s.loadComments(byID, `thread_id IN (SELECT id FROM comment_threads WHERE document_id = $1)`, documentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// loadComments fills in the comments of threads, selected by where
+func (s *PostgresDocumentStore) loadComments(threads map[string]*CommentThread, where string, args ...interface{}) error {
+	rows, err := s.db.Query(`
+		SELECT id, thread_id, author_id, author, content, created_at
+		FROM comments
+		WHERE `+where+`
+		ORDER BY created_at, id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to list comments: %w", err)
+	}
+	defer rows.Close()
+
+	for _, thread := range threads {
+		thread.Comments = []*Comment{}
+	}
+	for rows.Next() {
+		comment := &Comment{}
+		err := rows.Scan(
+			&comment.ID,
+			&comment.ThreadID,
+			&comment.AuthorID,
+			&comment.Author,
+			&comment.Content,
+			&comment.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan comment: %w", err)
+		}
+		if thread, ok := threads[comment.ThreadID]; ok {
+			thread.Comments = append(thread.Comments, comment)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) AddComment(comment *Comment) (*Comment, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	comment.CreatedAt = time.Now()
+	result, err := tx.Exec(`UPDATE comment_threads SET updated_at = $2 WHERE id = $1`, comment.ThreadID, comment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update comment thread: %w", err)
+	}
+	if rowsAffected, err := result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	} else if rowsAffected == 0 {
+		return nil, ErrCommentThreadNotFound
+	}
+
+	created, err := insertComment(tx, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit comment: %w", err)
+	}
+
+	return created, nil
+}
+
+// insertComment stores a comment with a new id as part of tx
+func insertComment(tx *sql.Tx, comment *Comment) (*Comment, error) {
+	created := &Comment{}
+
+	err := tx.QueryRow(`
+		INSERT INTO comments (id, thread_id, author_id, author, content, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, thread_id, author_id, author, content, created_at
+	`, uuid.New().String(), comment.ThreadID, comment.AuthorID, comment.Author, comment.Content, comment.CreatedAt).Scan(
+		&created.ID,
+		&created.ThreadID,
+		&created.AuthorID,
+		&created.Author,
+		&created.Content,
+		&created.CreatedAt,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrCommentThreadNotFound
+		}
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) ResolveCommentThread(id string, resolved bool, by string) (*CommentThread, error) {
+	now := time.Now()
+	var resolvedAt *time.Time
+	if resolved {
+		resolvedAt = &now
+	} else {
+		by = ""
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE comment_threads
+		SET resolved = $2, resolved_by = $3, resolved_at = $4, updated_at = $5
+		WHERE id = $1
+	`, id, resolved, by, resolvedAt, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve comment thread: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrCommentThreadNotFound
+	}
+
+	return s.GetCommentThread(id)
+}
+
+func (s *PostgresDocumentStore) UpdateCommentAnchors(anchors []CommentAnchor) error {
+	if len(anchors) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE comment_threads SET start_offset = $2, end_offset = $3 WHERE id = $1`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare anchor update: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, anchor := range anchors {
+		if _, err := stmt.Exec(anchor.ThreadID, anchor.Start, anchor.End); err != nil {
+			return fmt.Errorf("failed to update comment anchor: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit comment anchors: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) DeleteCommentThread(id string) error {
+	result, err := s.db.Exec(`DELETE FROM comment_threads WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment thread: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrCommentThreadNotFound
+	}
+
+	return nil
+}
+
+func scanCommentThread(row rowScanner) (*CommentThread, error) {
+	thread := &CommentThread{Comments: []*Comment{}}
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&thread.ID,
+		&thread.DocumentID,
+		&thread.Start,
+		&thread.End,
+		&thread.Quote,
+		&thread.Resolved,
+		&thread.ResolvedBy,
+		&resolvedAt,
+		&thread.CreatedBy,
+		&thread.CreatedAt,
+		&thread.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if resolvedAt.Valid {
+		thread.ResolvedAt = &resolvedAt.Time
+	}
+	return thread, nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements CommentStore interface
+var _ CommentStore = (*PostgresDocumentStore)(nil)
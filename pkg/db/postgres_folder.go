@@ -0,0 +1,378 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostgreSQL error codes for constraint violations
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+)
+
+func (s *PostgresDocumentStore) CreateWorkspace(name string) (*Workspace, error) {
+	now := time.Now()
+	workspace := &Workspace{}
+
+	err := s.db.QueryRow(`
+		INSERT INTO workspaces (id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, name, created_at, updated_at
+	`, uuid.New().String(), name, now, now).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func (s *PostgresDocumentStore) GetWorkspace(id string) (*Workspace, error) {
+	workspace := &Workspace{}
+
+	err := s.db.QueryRow(`
+		SELECT id, name, created_at, updated_at
+		FROM workspaces
+		WHERE id = $1
+	`, id).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func (s *PostgresDocumentStore) ListWorkspaces() ([]*Workspace, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, created_at, updated_at
+		FROM workspaces
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	workspaces := []*Workspace{}
+	for rows.Next() {
+		workspace := &Workspace{}
+		err := rows.Scan(
+			&workspace.ID,
+			&workspace.Name,
+			&workspace.CreatedAt,
+			&workspace.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, workspace)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+func (s *PostgresDocumentStore) RenameWorkspace(id, name string) (*Workspace, error) {
+	workspace := &Workspace{}
+
+	err := s.db.QueryRow(`
+		UPDATE workspaces
+		SET name = $1, updated_at = $2
+		WHERE id = $3
+		RETURNING id, name, created_at, updated_at
+	`, name, time.Now(), id).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to rename workspace: %w", err)
+	}
+
+	return workspace, nil
+}
+
+func (s *PostgresDocumentStore) DeleteWorkspace(id string) error {
+	result, err := s.db.Exec(`DELETE FROM workspaces WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWorkspaceNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) CreateFolder(workspaceID string, parentID *string, name string) (*Folder, error) {
+	if _, err := s.GetWorkspace(workspaceID); err != nil {
+		return nil, err
+	}
+	if parentID != nil {
+		parent, err := s.GetFolder(*parentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent.WorkspaceID != workspaceID {
+			return nil, fmt.Errorf("%w: parent folder is in another workspace", ErrInvalidMove)
+		}
+	}
+
+	now := time.Now()
+	folder, err := scanFolder(s.db.QueryRow(`
+		INSERT INTO folders (id, workspace_id, parent_id, name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+folderColumns,
+		uuid.New().String(), workspaceID, parentID, name, now, now))
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrFolderExists
+		}
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+
+	return folder, nil
+}
+
+func (s *PostgresDocumentStore) GetFolder(id string) (*Folder, error) {
+	folder, err := scanFolder(s.db.QueryRow(`SELECT `+folderColumns+` FROM folders WHERE id = $1`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrFolderNotFound
+		}
+		return nil, fmt.Errorf("failed to get folder: %w", err)
+	}
+
+	return folder, nil
+}
+
+func (s *PostgresDocumentStore) ListFolders(workspaceID string) ([]*Folder, error) {
+	if _, err := s.GetWorkspace(workspaceID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+folderColumns+`
+		FROM folders
+		WHERE workspace_id = $1
+		ORDER BY name
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list folders: %w", err)
+	}
+	defer rows.Close()
+
+	folders := []*Folder{}
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan folder: %w", err)
+		}
+		folders = append(folders, folder)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return folders, nil
+}
+
+func (s *PostgresDocumentStore) UpdateFolder(id string, updates *FolderUpdate) (*Folder, error) {
+	folder, err := s.GetFolder(id)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := []string{}
+	args := []interface{}{}
+	argPos := 1
+
+	if updates.Name != nil {
+		sets = append(sets, fmt.Sprintf("name = $%d", argPos))
+		args = append(args, *updates.Name)
+		argPos++
+	}
+	if updates.ParentID != nil {
+		var parentID *string
+		if *updates.ParentID != "" {
+			if err := s.checkFolderMove(folder, *updates.ParentID); err != nil {
+				return nil, err
+			}
+			parentID = updates.ParentID
+		}
+		sets = append(sets, fmt.Sprintf("parent_id = $%d", argPos))
+		args = append(args, parentID)
+		argPos++
+	}
+
+	if len(sets) == 0 {
+		return folder, nil
+	}
+
+	sets = append(sets, fmt.Sprintf("updated_at = $%d", argPos))
+	args = append(args, time.Now())
+	argPos++
+	args = append(args, id)
+
+	query := fmt.Sprintf(`
+		UPDATE folders
+		SET %s
+		WHERE id = $%d
+		RETURNING %s
+	`, strings.Join(sets, ", "), argPos, folderColumns)
+
+	folder, err = scanFolder(s.db.QueryRow(query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrFolderNotFound
+		}
+		if isUniqueViolation(err) {
+			return nil, ErrFolderExists
+		}
+		return nil, fmt.Errorf("failed to update folder: %w", err)
+	}
+
+	return folder, nil
+}
+
+// checkFolderMove makes sure folder can be moved under parentID: the parent
+// must exist in the same workspace and must not be the folder or one of its
+// descendants.
+func (s *PostgresDocumentStore) checkFolderMove(folder *Folder, parentID string) error {
+	parent, err := s.GetFolder(parentID)
+	if err != nil {
+		return err
+	}
+	if parent.WorkspaceID != folder.WorkspaceID {
+		return fmt.Errorf("%w: parent folder is in another workspace", ErrInvalidMove)
+	}
+
+	var cycle bool
+	err = s.db.QueryRow(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id FROM folders WHERE id = $1
+			UNION ALL
+			SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $2)
+	`, parentID, folder.ID).Scan(&cycle)
+	if err != nil {
+		return fmt.Errorf("failed to check folder move: %w", err)
+	}
+	if cycle {
+		return fmt.Errorf("%w: a folder can't be moved into itself", ErrInvalidMove)
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) DeleteFolder(id string) error {
+	result, err := s.db.Exec(`DELETE FROM folders WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete folder: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrFolderNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) MoveDocument(documentID string, folderID *string) (*Document, error) {
+	if folderID != nil {
+		if _, err := s.GetFolder(*folderID); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := scanDocument(s.db.QueryRow(`
+		UPDATE documents
+		SET folder_id = $1, updated_at = $2
+		WHERE id = $3
+		RETURNING `+documentColumns,
+		folderID, time.Now(), documentID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to move document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// folderColumns is the column list scanFolder expects
+const folderColumns = `id, workspace_id, parent_id, name, created_at, updated_at`
+
+// scanFolder scans a row selected with folderColumns
+func scanFolder(row rowScanner) (*Folder, error) {
+	folder := &Folder{}
+	var parentID sql.NullString
+	err := row.Scan(
+		&folder.ID,
+		&folder.WorkspaceID,
+		&parentID,
+		&folder.Name,
+		&folder.CreatedAt,
+		&folder.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if parentID.Valid {
+		folder.ParentID = &parentID.String
+	}
+	return folder, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == uniqueViolation
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements FolderStore interface
+var _ FolderStore = (*PostgresDocumentStore)(nil)
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// gitBindingColumns is the column list scanGitBinding expects
+const gitBindingColumns = `id, repo_path, path, branch, document_id, folder_id, interval_seconds, last_commit, last_synced_at, created_at`
+
+func (s *PostgresDocumentStore) CreateGitBinding(binding *GitBinding) (*GitBinding, error) {
+	created, err := scanGitBinding(s.db.QueryRow(`
+		INSERT INTO git_bindings (id, repo_path, path, branch, document_id, folder_id, interval_seconds, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING `+gitBindingColumns,
+		uuid.New().String(),
+		binding.RepoPath,
+		binding.Path,
+		binding.Branch,
+		binding.DocumentID,
+		binding.FolderID,
+		binding.IntervalSeconds,
+		time.Now(),
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			if binding.DocumentID != nil {
+				return nil, ErrDocumentNotFound
+			}
+			return nil, ErrFolderNotFound
+		}
+		return nil, fmt.Errorf("failed to create git binding: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) GetGitBinding(id string) (*GitBinding, error) {
+	binding, err := scanGitBinding(s.db.QueryRow(`
+		SELECT `+gitBindingColumns+`
+		FROM git_bindings
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrGitBindingNotFound
+		}
+		return nil, fmt.Errorf("failed to get git binding: %w", err)
+	}
+
+	return binding, nil
+}
+
+func (s *PostgresDocumentStore) ListGitBindings() ([]*GitBinding, error) {
+	rows, err := s.db.Query(`
+		SELECT ` + gitBindingColumns + `
+		FROM git_bindings
+		ORDER BY created_at
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git bindings: %w", err)
+	}
+	defer rows.Close()
+
+	bindings := []*GitBinding{}
+	for rows.Next() {
+		binding, err := scanGitBinding(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan git binding: %w", err)
+		}
+		bindings = append(bindings, binding)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return bindings, nil
+}
+
+func (s *PostgresDocumentStore) DeleteGitBinding(id string) error {
+	result, err := s.db.Exec(`DELETE FROM git_bindings WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete git binding: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrGitBindingNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) MarkGitBindingSynced(id, commit string, at time.Time) error {
+	result, err := s.db.Exec(`
+		UPDATE git_bindings
+		SET last_commit = $1, last_synced_at = $2
+		WHERE id = $3
+	`, commit, at, id)
+	if err != nil {
+		return fmt.Errorf("failed to update git binding: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrGitBindingNotFound
+	}
+
+	return nil
+}
+
+// scanGitBinding scans a row selected with gitBindingColumns
+func scanGitBinding(row rowScanner) (*GitBinding, error) {
+	binding := &GitBinding{}
+	var documentID, folderID sql.NullString
+	var lastSyncedAt sql.NullTime
+	err := row.Scan(
+		&binding.ID,
+		&binding.RepoPath,
+		&binding.Path,
+		&binding.Branch,
+		&documentID,
+		&folderID,
+		&binding.IntervalSeconds,
+		&binding.LastCommit,
+		&lastSyncedAt,
+		&binding.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if documentID.Valid {
+		binding.DocumentID = &documentID.String
+	}
+	if folderID.Valid {
+		binding.FolderID = &folderID.String
+	}
+	if lastSyncedAt.Valid {
+		binding.LastSyncedAt = &lastSyncedAt.Time
+	}
+	return binding, nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements GitBindingStore interface
+var _ GitBindingStore = (*PostgresDocumentStore)(nil)
@@ -0,0 +1,174 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func (s *PostgresDocumentStore) SaveUser(id, username string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO users (id, username, last_seen_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET username = EXCLUDED.username, last_seen_at = EXCLUDED.last_seen_at
+	`, id, username, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresDocumentStore) FindParticipants(documentID, username string) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT u.id FROM users u
+		WHERE LOWER(u.username) = LOWER($2) AND (
+			EXISTS (SELECT 1 FROM chat_messages m WHERE m.document_id = $1 AND m.user_id = u.id) OR
+			EXISTS (
+				SELECT 1 FROM comments c JOIN comment_threads t ON t.id = c.thread_id
+				WHERE t.document_id = $1 AND c.author_id = u.id
+			)
+		)
+	`, documentID, username)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find users: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// notificationColumns is the column list scanNotification expects
+const notificationColumns = `id, user_id, kind, document_id, source, source_id, actor_id, actor, excerpt, read, created_at`
+
+func (s *PostgresDocumentStore) CreateNotification(notification *Notification) (*Notification, error) {
+	created, err := scanNotification(s.db.QueryRow(`
+		INSERT INTO notifications (user_id, kind, document_id, source, source_id, actor_id, actor, excerpt, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING `+notificationColumns,
+		notification.UserID,
+		notification.Kind,
+		notification.DocumentID,
+		notification.Source,
+		notification.SourceID,
+		notification.ActorID,
+		notification.Actor,
+		notification.Excerpt,
+		time.Now(),
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, fmt.Errorf("failed to create notification: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) ListNotifications(userID string, unreadOnly bool, before int64, limit int) ([]*Notification, error) {
+	if limit <= 0 {
+		limit = DefaultNotificationLimit
+	}
+	limit = min(limit, MaxNotificationLimit)
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+
+	rows, err := s.db.Query(`
+		SELECT `+notificationColumns+`
+		FROM notifications
+		WHERE user_id = $1 AND id < $2 AND (NOT $3 OR NOT read)
+		ORDER BY id DESC
+		LIMIT $4
+	`, userID, before, unreadOnly, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return notifications, nil
+}
+
+func (s *PostgresDocumentStore) CountUnreadNotifications(userID string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT read`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return count, nil
+}
+
+func (s *PostgresDocumentStore) MarkNotificationsRead(userID string, ids []int64) (int, error) {
+	if ids == nil {
+		// A nil slice would be sent as NULL rather than an empty array
+		ids = []int64{}
+	}
+
+	result, err := s.db.Exec(`
+		UPDATE notifications
+		SET read = TRUE
+		WHERE user_id = $1 AND NOT read AND (cardinality($2::bigint[]) = 0 OR id = ANY($2))
+	`, userID, pq.Array(ids))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+func scanNotification(row rowScanner) (*Notification, error) {
+	notification := &Notification{}
+	err := row.Scan(
+		&notification.ID,
+		&notification.UserID,
+		&notification.Kind,
+		&notification.DocumentID,
+		&notification.Source,
+		&notification.SourceID,
+		&notification.ActorID,
+		&notification.Actor,
+		&notification.Excerpt,
+		&notification.Read,
+		&notification.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return notification, nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements NotificationStore interface
+var _ NotificationStore = (*PostgresDocumentStore)(nil)
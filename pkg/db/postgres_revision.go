@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+func (s *PostgresDocumentStore) ListRevisions(documentID string) ([]*Revision, error) {
+	if _, err := s.GetDocument(documentID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT document_id, version, title, language, created_at
+		FROM document_revisions
+		WHERE document_id = $1
+		ORDER BY version DESC
+	`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []*Revision{}
+	for rows.Next() {
+		revision := &Revision{}
+		err := rows.Scan(
+			&revision.DocumentID,
+			&revision.Version,
+			&revision.Title,
+			&revision.Language,
+			&revision.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan revision: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return revisions, nil
+}
+
+func (s *PostgresDocumentStore) GetRevision(documentID string, version int) (*Revision, error) {
+	revision := &Revision{}
+
+	err := s.db.QueryRow(`
+		SELECT document_id, version, title, content, language, created_at
+		FROM document_revisions
+		WHERE document_id = $1 AND version = $2
+	`, documentID, version).Scan(
+		&revision.DocumentID,
+		&revision.Version,
+		&revision.Title,
+		&revision.Content,
+		&revision.Language,
+		&revision.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+
+	return revision, nil
+}
+
+func (s *PostgresDocumentStore) CreateTag(documentID, name string, version int) (*Tag, error) {
+	tag := &Tag{}
+
+	err := s.db.QueryRow(`
+		INSERT INTO document_tags (document_id, name, version, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING document_id, name, version, created_at
+	`, documentID, name, version, time.Now()).Scan(
+		&tag.DocumentID,
+		&tag.Name,
+		&tag.Version,
+		&tag.CreatedAt,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrTagExists
+		}
+		if isForeignKeyViolation(err) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, fmt.Errorf("failed to create tag: %w", err)
+	}
+
+	return tag, nil
+}
+
+func (s *PostgresDocumentStore) GetTag(documentID, name string) (*Tag, error) {
+	tag := &Tag{}
+
+	err := s.db.QueryRow(`
+		SELECT document_id, name, version, created_at
+		FROM document_tags
+		WHERE document_id = $1 AND name = $2
+	`, documentID, name).Scan(
+		&tag.DocumentID,
+		&tag.Name,
+		&tag.Version,
+		&tag.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrTagNotFound
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+
+	return tag, nil
+}
+
+func (s *PostgresDocumentStore) ListTags(documentID string) ([]*Tag, error) {
+	rows, err := s.db.Query(`
+		SELECT document_id, name, version, created_at
+		FROM document_tags
+		WHERE document_id = $1
+		ORDER BY version DESC, name
+	`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		tag := &Tag{}
+		if err := rows.Scan(&tag.DocumentID, &tag.Name, &tag.Version, &tag.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return tags, nil
+}
+
+func (s *PostgresDocumentStore) DeleteTag(documentID, name string) error {
+	result, err := s.db.Exec(`DELETE FROM document_tags WHERE document_id = $1 AND name = $2`, documentID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrTagNotFound
+	}
+
+	return nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements RevisionStore interface
+var _ RevisionStore = (*PostgresDocumentStore)(nil)
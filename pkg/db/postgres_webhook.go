@@ -0,0 +1,296 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// webhookColumns is the column list scanWebhook expects
+const webhookColumns = `id, url, secret, document_id, workspace_id, events, created_at`
+
+func (s *PostgresDocumentStore) CreateWebhook(webhook *Webhook) (*Webhook, error) {
+	events := webhook.Events
+	if events == nil {
+		// A nil slice would be sent as NULL rather than an empty array
+		events = []string{}
+	}
+
+	created, err := scanWebhook(s.db.QueryRow(`
+		INSERT INTO webhooks (id, url, secret, document_id, workspace_id, events, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+webhookColumns,
+		uuid.New().String(),
+		webhook.URL,
+		webhook.Secret,
+		webhook.DocumentID,
+		webhook.WorkspaceID,
+		pq.Array(events),
+		time.Now(),
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) GetWebhook(id string) (*Webhook, error) {
+	webhook, err := scanWebhook(s.db.QueryRow(`
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (s *PostgresDocumentStore) ListWebhooks() ([]*Webhook, error) {
+	return s.queryWebhooks(`
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		ORDER BY created_at
+	`)
+}
+
+func (s *PostgresDocumentStore) DeleteWebhook(id string) error {
+	result, err := s.db.Exec(`DELETE FROM webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) MatchWebhooks(documentID, workspaceID, event string) ([]*Webhook, error) {
+	return s.queryWebhooks(`
+		SELECT `+webhookColumns+`
+		FROM webhooks
+		WHERE (document_id = $1 OR ($2 <> '' AND workspace_id = $2))
+			AND (cardinality(events) = 0 OR $3 = ANY(events))
+		ORDER BY created_at
+	`, documentID, workspaceID, event)
+}
+
+func (s *PostgresDocumentStore) queryWebhooks(query string, args ...interface{}) ([]*Webhook, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// scanWebhook scans a row selected with webhookColumns
+func scanWebhook(row rowScanner) (*Webhook, error) {
+	webhook := &Webhook{}
+	var documentID, workspaceID sql.NullString
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.URL,
+		&webhook.Secret,
+		&documentID,
+		&workspaceID,
+		pq.Array(&webhook.Events),
+		&webhook.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if documentID.Valid {
+		webhook.DocumentID = &documentID.String
+	}
+	if workspaceID.Valid {
+		webhook.WorkspaceID = &workspaceID.String
+	}
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+	return webhook, nil
+}
+
+// deliveryColumns is the column list scanDelivery expects
+const deliveryColumns = `id, webhook_id, event_id, event, payload, status, attempts, response_status, error, next_attempt_at, created_at, completed_at`
+
+func (s *PostgresDocumentStore) CreateWebhookDelivery(delivery *WebhookDelivery) (*WebhookDelivery, error) {
+	created, err := scanDelivery(s.db.QueryRow(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING `+deliveryColumns,
+		delivery.WebhookID,
+		delivery.EventID,
+		delivery.Event,
+		string(delivery.Payload),
+		delivery.Status,
+		delivery.NextAttemptAt,
+		time.Now(),
+	))
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+
+	return created, nil
+}
+
+func (s *PostgresDocumentStore) ClaimWebhookDeliveries(now, until time.Time, limit int) ([]*WebhookDelivery, error) {
+	// SKIP LOCKED lets several servers share the queue without sending twice
+	return s.queryDeliveries(`
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id
+			FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		now, until, limit)
+}
+
+func (s *PostgresDocumentStore) UpdateWebhookDelivery(delivery *WebhookDelivery) error {
+	result, err := s.db.Exec(`
+		UPDATE webhook_deliveries
+		SET status = $1, attempts = $2, response_status = $3, error = $4, next_attempt_at = $5, completed_at = $6
+		WHERE id = $7
+	`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseStatus,
+		delivery.Error,
+		delivery.NextAttemptAt,
+		delivery.CompletedAt,
+		delivery.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		// The webhook was deleted, taking its deliveries with it
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+func (s *PostgresDocumentStore) ListWebhookDeliveries(webhookID string, before int64, limit int) ([]*WebhookDelivery, error) {
+	if limit <= 0 {
+		limit = DefaultDeliveryLimit
+	}
+	limit = min(limit, MaxDeliveryLimit)
+	if before <= 0 {
+		before = math.MaxInt64
+	}
+
+	return s.queryDeliveries(`
+		SELECT `+deliveryColumns+`
+		FROM webhook_deliveries
+		WHERE webhook_id = $1 AND id < $2
+		ORDER BY id DESC
+		LIMIT $3
+	`, webhookID, before, limit)
+}
+
+func (s *PostgresDocumentStore) queryDeliveries(query string, args ...interface{}) ([]*WebhookDelivery, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// scanDelivery scans a row selected with deliveryColumns
+func scanDelivery(row rowScanner) (*WebhookDelivery, error) {
+	delivery := &WebhookDelivery{}
+	var payload string
+	var nextAttemptAt, completedAt sql.NullTime
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.Event,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.ResponseStatus,
+		&delivery.Error,
+		&nextAttemptAt,
+		&delivery.CreatedAt,
+		&completedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	delivery.Payload = []byte(payload)
+	if nextAttemptAt.Valid {
+		delivery.NextAttemptAt = &nextAttemptAt.Time
+	}
+	if completedAt.Valid {
+		delivery.CompletedAt = &completedAt.Time
+	}
+	return delivery, nil
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements WebhookStore interface
+var _ WebhookStore = (*PostgresDocumentStore)(nil)
@@ -0,0 +1,33 @@
+package db
+
+import "time"
+
+// Revision is a stored version of a document. Listings leave Content empty.
+type Revision struct {
+	DocumentID string    `json:"document_id"`
+	Version    int       `json:"version"`
+	Title      string    `json:"title"`
+	Content    string    `json:"content,omitempty"`
+	Language   string    `json:"language"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Tag names a revision of a document
+type Tag struct {
+	DocumentID string    `json:"document_id"`
+	Name       string    `json:"name"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RevisionStore is implemented by stores that keep document history
+type RevisionStore interface {
+	// ListRevisions returns a document's revisions, newest first, without content
+	ListRevisions(documentID string) ([]*Revision, error)
+	GetRevision(documentID string, version int) (*Revision, error)
+
+	CreateTag(documentID, name string, version int) (*Tag, error)
+	GetTag(documentID, name string) (*Tag, error)
+	ListTags(documentID string) ([]*Tag, error)
+	DeleteTag(documentID, name string) error
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSearchLimit is the number of results used when SearchOptions.Limit is unset
+	DefaultSearchLimit = 20
+	// MaxSearchLimit caps SearchOptions.Limit
+	MaxSearchLimit = 100
+	// maxLineMatches caps the matching lines reported per document
+	maxLineMatches = 5
+	// maxLineLength truncates long matching lines
+	maxLineLength = 200
+)
+
+// Highlight markers passed to ts_headline. They can't appear in escaped
+// HTML, so the snippet can be escaped first and the markers swapped for
+// <mark> tags afterwards.
+const (
+	highlightStart = "\x01"
+	highlightStop  = "\x02"
+)
+
+// DocumentSearcher is implemented by stores that support full-text search
+type DocumentSearcher interface {
+	SearchDocuments(opts *SearchOptions) ([]*SearchResult, error)
+}
+
+// SearchOptions configures SearchDocuments
+type SearchOptions struct {
+	Query    string // web search syntax: words, "quoted phrases", -excluded, or
+	Language string // only documents with this language
+	Limit    int    // defaults to DefaultSearchLimit
+}
+
+// SearchResult is a ranked match for a search query
+type SearchResult struct {
+	Document *DocumentSummary `json:"document"`
+	Rank     float64          `json:"rank"`
+	Snippet  string           `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Matches  []LineMatch      `json:"matches"`
+}
+
+// LineMatch is a line of a document containing a search term
+type LineMatch struct {
+	Line int    `json:"line"` // 1-based
+	Text string `json:"text"`
+}
+
+func (s *PostgresDocumentStore) SearchDocuments(opts *SearchOptions) ([]*SearchResult, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+
+	args := []interface{}{opts.Query, highlightOptions(), limit}
+	filter := ""
+	if opts.Language != "" {
+		args = append(args, opts.Language)
+		filter = "AND language = $4"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s, content,
+			ts_rank(search_vector, q) AS rank,
+			ts_headline('simple', content, q, $2) AS snippet
+		FROM documents, websearch_to_tsquery('simple', $1) AS q
+		WHERE search_vector @@ q %s
+		ORDER BY rank DESC, updated_at DESC
+		LIMIT $3
+	`, documentSummaryColumns, filter)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search documents: %w", err)
+	}
+	defer rows.Close()
+
+	terms := searchTerms(opts.Query)
+	results := []*SearchResult{}
+	for rows.Next() {
+		result := &SearchResult{}
+		var content, snippet string
+		doc, err := scanDocumentSummary(rows, &content, &result.Rank, &snippet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+
+		result.Document = doc.Summary()
+		result.Snippet = highlightSnippet(snippet)
+		result.Matches = matchLines(content, terms)
+		results = append(results, result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return results, nil
+}
+
+// highlightOptions builds the ts_headline options string
+func highlightOptions() string {
+	return fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=3, MaxWords=20, MinWords=5, FragmentDelimiter=" ... "`,
+		highlightStart, highlightStop)
+}
+
+// highlightSnippet escapes a ts_headline result and turns the markers into <mark> tags
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	return strings.NewReplacer(highlightStart, "<mark>", highlightStop, "</mark>").Replace(escaped)
+}
+
+// searchTerms extracts the lowercased words to look for from a web search
+// query, skipping excluded terms and the "or" operator
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if strings.HasPrefix(field, "-") || strings.EqualFold(field, "or") {
+			continue
+		}
+		words := strings.FieldsFunc(strings.ToLower(field), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		terms = append(terms, words...)
+	}
+	return terms
+}
+
+// matchLines returns the lines of content that contain any of terms
+func matchLines(content string, terms []string) []LineMatch {
+	matches := []LineMatch{}
+	if len(terms) == 0 {
+		return matches
+	}
+
+	for i, line := range strings.Split(content, "\n") {
+		lower := strings.ToLower(line)
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				text := strings.TrimSpace(line)
+				if runes := []rune(text); len(runes) > maxLineLength {
+					text = string(runes[:maxLineLength])
+				}
+				matches = append(matches, LineMatch{Line: i + 1, Text: text})
+				break
+			}
+		}
+		if len(matches) == maxLineMatches {
+			break
+		}
+	}
+	return matches
+}
+
+// Compile-time check to ensure PostgresDocumentStore implements DocumentSearcher interface
+var _ DocumentSearcher = (*PostgresDocumentStore)(nil)
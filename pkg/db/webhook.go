@@ -0,0 +1,75 @@
+package db
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	// DefaultDeliveryLimit is the page size used when listing webhook deliveries
+	DefaultDeliveryLimit = 50
+	// MaxDeliveryLimit caps a page of webhook deliveries
+	MaxDeliveryLimit = 200
+)
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"   // waiting for its next attempt
+	DeliveryDelivered = "delivered" // the endpoint answered 2xx
+	DeliveryFailed    = "failed"    // gave up after the last attempt
+)
+
+// Webhook is an endpoint told about events on one document, or on every
+// document in a workspace. Exactly one of DocumentID and WorkspaceID is set.
+type Webhook struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Secret signs every payload. It's only returned when the webhook is created.
+	Secret      string    `json:"secret,omitempty"`
+	DocumentID  *string   `json:"document_id,omitempty"`
+	WorkspaceID *string   `json:"workspace_id,omitempty"`
+	Events      []string  `json:"events"` // empty means every event
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one event sent, or being sent, to a webhook. Every
+// attempt sends the same payload; the outcome of the latest is recorded.
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	CompletedAt    *time.Time      `json:"completed_at,omitempty"`
+}
+
+// WebhookStore is implemented by stores that keep webhooks and their
+// delivery log
+type WebhookStore interface {
+	CreateWebhook(webhook *Webhook) (*Webhook, error)
+	GetWebhook(id string) (*Webhook, error)
+	ListWebhooks() ([]*Webhook, error)
+	DeleteWebhook(id string) error
+	// MatchWebhooks returns the webhooks subscribed to event on a document,
+	// directly or through workspaceID when it isn't empty
+	MatchWebhooks(documentID, workspaceID, event string) ([]*Webhook, error)
+
+	CreateWebhookDelivery(delivery *WebhookDelivery) (*WebhookDelivery, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due by
+	// now, oldest first, and pushes their next attempt back to until so no
+	// one else picks them up while they're in flight
+	ClaimWebhookDeliveries(now, until time.Time, limit int) ([]*WebhookDelivery, error)
+	// UpdateWebhookDelivery records the outcome of an attempt: status,
+	// attempts, response status, error, next attempt and completion time
+	UpdateWebhookDelivery(delivery *WebhookDelivery) error
+	// ListWebhookDeliveries returns up to limit of a webhook's deliveries
+	// older than the one with id before (the newest when before is 0),
+	// newest first
+	ListWebhookDeliveries(webhookID string, before int64, limit int) ([]*WebhookDelivery, error)
+}
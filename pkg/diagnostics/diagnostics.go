@@ -0,0 +1,114 @@
+// Package diagnostics checks document content for problems, such as syntax
+// errors, through providers registered per language.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// MaxDiagnostics caps how many diagnostics one check reports
+const MaxDiagnostics = 100
+
+// Diagnostic is one problem in a document. Line and Column are 1-based, and
+// columns count bytes like operation positions do. EndLine and EndColumn
+// are set when the problem spans a range rather than a point.
+type Diagnostic struct {
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"end_line,omitempty"`
+	EndColumn int    `json:"end_column,omitempty"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Source    string `json:"source"` // the provider that found it, e.g. "go/parser"
+}
+
+// Provider finds problems in a document's content. Providers are called
+// whenever the content settles after edits, so they should be quick.
+type Provider interface {
+	Diagnose(ctx context.Context, content string) ([]Diagnostic, error)
+}
+
+// ProviderFunc adapts a function to a Provider
+type ProviderFunc func(ctx context.Context, content string) ([]Diagnostic, error)
+
+// Diagnose calls f
+func (f ProviderFunc) Diagnose(ctx context.Context, content string) ([]Diagnostic, error) {
+	return f(ctx, content)
+}
+
+// Registry maps document languages to the providers that check them
+type Registry struct {
+	providers map[string][]Provider
+	mutex     sync.RWMutex
+}
+
+// NewRegistry creates a registry that checks Go syntax
+func NewRegistry() *Registry {
+	return &Registry{
+		providers: map[string][]Provider{"go": {GoParser}},
+	}
+}
+
+// Register adds a provider for a language, alongside any already there
+func (r *Registry) Register(language string, provider Provider) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	language = strings.ToLower(language)
+	r.providers[language] = append(r.providers[language], provider)
+}
+
+// Supports reports whether a language has any provider
+func (r *Registry) Supports(language string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return len(r.providers[strings.ToLower(language)]) > 0
+}
+
+// Diagnose runs every provider for language on content and returns what
+// they found, in document order. A provider failing doesn't stop the
+// others; their diagnostics are returned along with the error.
+func (r *Registry) Diagnose(ctx context.Context, language, content string) ([]Diagnostic, error) {
+	r.mutex.RLock()
+	providers := r.providers[strings.ToLower(language)]
+	r.mutex.RUnlock()
+
+	found := []Diagnostic{}
+	var errs []error
+	for _, provider := range providers {
+		diagnostics, err := provider.Diagnose(ctx, content)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		found = append(found, diagnostics...)
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Line != found[j].Line {
+			return found[i].Line < found[j].Line
+		}
+		return found[i].Column < found[j].Column
+	})
+	if len(found) > MaxDiagnostics {
+		found = found[:MaxDiagnostics]
+	}
+
+	if len(errs) > 0 {
+		return found, fmt.Errorf("failed to check %s: %w", language, errors.Join(errs...))
+	}
+	return found, nil
+}
@@ -0,0 +1,37 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+)
+
+// GoParser reports Go syntax errors, as go/parser finds them
+var GoParser = ProviderFunc(func(ctx context.Context, content string) ([]Diagnostic, error) {
+	fset := token.NewFileSet()
+	_, err := parser.ParseFile(fset, "", content, parser.AllErrors|parser.SkipObjectResolution)
+	if err == nil {
+		return nil, nil
+	}
+
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		return nil, err
+	}
+	// One error per line: the parser often reports a mistake several times
+	list.RemoveMultiples()
+
+	diagnostics := make([]Diagnostic, 0, len(list))
+	for _, e := range list {
+		diagnostics = append(diagnostics, Diagnostic{
+			Line:     max(e.Pos.Line, 1),
+			Column:   max(e.Pos.Column, 1),
+			Severity: SeverityError,
+			Message:  e.Msg,
+			Source:   "go/parser",
+		})
+	}
+	return diagnostics, nil
+})
@@ -0,0 +1,347 @@
+// Package diff computes line diffs, unified diffs and three-way merges of
+// document content.
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Line kinds
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// maxEditDistance bounds the Myers search. Past it the differing middle of
+// the two texts is reported as one replacement, which keeps memory bounded
+// for wildly different inputs.
+const maxEditDistance = 2000
+
+// Line is one line of a diff. Old and New are 1-based line numbers in the
+// old and new text, 0 where the line doesn't exist on that side.
+type Line struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+	Old  int    `json:"old,omitempty"`
+	New  int    `json:"new,omitempty"`
+	// NoNewline marks a last line without a trailing newline
+	NoNewline bool `json:"no_newline,omitempty"`
+}
+
+// Hunk is a run of changes with surrounding context
+type Hunk struct {
+	OldStart int    `json:"old_start"`
+	OldLines int    `json:"old_lines"`
+	NewStart int    `json:"new_start"`
+	NewLines int    `json:"new_lines"`
+	Lines    []Line `json:"lines"`
+}
+
+// Stats counts changed lines
+type Stats struct {
+	Added   int `json:"added"`
+	Removed int `json:"removed"`
+}
+
+// SplitLines splits text into lines that keep their "\n", so a missing
+// newline at the end of the text counts as a difference
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Lines returns the line-level diff turning a into b
+func Lines(a, b string) []Line {
+	oldLines, newLines := SplitLines(a), SplitLines(b)
+
+	var out []Line
+	oldNum, newNum := 0, 0
+	for _, op := range script(oldLines, newLines) {
+		var text string
+		line := Line{Kind: op.kind}
+		switch op.kind {
+		case Equal:
+			oldNum++
+			newNum++
+			line.Old, line.New = oldNum, newNum
+			text = oldLines[op.a]
+		case Delete:
+			oldNum++
+			line.Old = oldNum
+			text = oldLines[op.a]
+		case Insert:
+			newNum++
+			line.New = newNum
+			text = newLines[op.b]
+		}
+		line.Text = strings.TrimSuffix(text, "\n")
+		line.NoNewline = !strings.HasSuffix(text, "\n")
+		out = append(out, line)
+	}
+	return out
+}
+
+// Count returns how many lines a diff adds and removes
+func Count(lines []Line) Stats {
+	var stats Stats
+	for _, line := range lines {
+		switch line.Kind {
+		case Insert:
+			stats.Added++
+		case Delete:
+			stats.Removed++
+		}
+	}
+	return stats
+}
+
+// Hunks groups a diff into hunks with the given number of context lines
+func Hunks(lines []Line, context int) []Hunk {
+	hunks := []Hunk{}
+
+	i := 0
+	for i < len(lines) {
+		// Find the next change
+		for i < len(lines) && lines[i].Kind == Equal {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		start := max(i-context, 0)
+		end := i
+		// Extend while changes are closer than two contexts apart
+		for end < len(lines) {
+			if lines[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Kind == Equal {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunk := Hunk{Lines: lines[start:end]}
+		for _, line := range hunk.Lines {
+			if line.Kind != Insert {
+				hunk.OldLines++
+				if hunk.OldStart == 0 {
+					hunk.OldStart = line.Old
+				}
+			}
+			if line.Kind != Delete {
+				hunk.NewLines++
+				if hunk.NewStart == 0 {
+					hunk.NewStart = line.New
+				}
+			}
+		}
+		// An empty side starts at the line before, as in diff -u
+		if hunk.OldLines == 0 {
+			hunk.OldStart = oldLineBefore(lines, start)
+		}
+		if hunk.NewLines == 0 {
+			hunk.NewStart = newLineBefore(lines, start)
+		}
+		hunks = append(hunks, hunk)
+		i = end
+	}
+
+	return hunks
+}
+
+func oldLineBefore(lines []Line, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if lines[j].Old != 0 {
+			return lines[j].Old
+		}
+	}
+	return 0
+}
+
+func newLineBefore(lines []Line, i int) int {
+	for j := i - 1; j >= 0; j-- {
+		if lines[j].New != 0 {
+			return lines[j].New
+		}
+	}
+	return 0
+}
+
+// Unified renders hunks as a unified diff between two labelled texts
+func Unified(fromLabel, toLabel string, hunks []Hunk) string {
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromLabel, toLabel)
+	for _, hunk := range hunks {
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunk.OldStart, hunk.OldLines), hunkRange(hunk.NewStart, hunk.NewLines))
+		for _, line := range hunk.Lines {
+			prefix := " "
+			switch line.Kind {
+			case Insert:
+				prefix = "+"
+			case Delete:
+				prefix = "-"
+			}
+			out.WriteString(prefix + line.Text + "\n")
+			if line.NoNewline {
+				out.WriteString("\\ No newline at end of file\n")
+			}
+		}
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// op is one step of an edit script: a and b index the old and new lines
+type op struct {
+	kind string
+	a, b int
+}
+
+// script returns the shortest edit script from a to b (Myers' algorithm),
+// after trimming the common prefix and suffix
+func script(a, b []string) []op {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []op
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, op{Equal, i, i})
+	}
+	for _, o := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		ops = append(ops, op{o.kind, o.a + prefix, o.b + prefix})
+	}
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, op{Equal, len(a) - suffix + i, len(b) - suffix + i})
+	}
+	return ops
+}
+
+func myers(a, b []string) []op {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replace(n, m)
+	}
+
+	// trace[d][k+d] is the furthest x reached on diagonal k after d edits
+	var trace [][]int
+	v := map[int]int{1: 0}
+	for d := 0; d <= n+m; d++ {
+		if d > maxEditDistance {
+			return replace(n, m)
+		}
+		row := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1] < v[k+1]) {
+				x = v[k+1]
+			} else {
+				x = v[k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k] = x
+			row[k+d] = x
+			if x >= n && y >= m {
+				trace = append(trace, row)
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, row)
+	}
+	return replace(n, m)
+}
+
+// backtrack walks the trace from the end to recover the edit script
+func backtrack(trace [][]int, n, m int) []op {
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int {
+			if k < -(d-1) || k > d-1 {
+				return -1
+			}
+			return prev[k+d-1]
+		}
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, op{Equal, x, y})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, op{Insert, x, y})
+		} else {
+			x--
+			ops = append(ops, op{Delete, x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, op{Equal, x, y})
+	}
+
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// replace deletes all n old lines and inserts all m new ones
+func replace(n, m int) []op {
+	ops := make([]op, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, op{Delete, i, 0})
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, op{Insert, n, j})
+	}
+	return ops
+}
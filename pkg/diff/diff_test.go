@@ -0,0 +1,227 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Line
+	}{
+		{
+			name: "equal",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Equal, Text: "b", Old: 2, New: 2},
+			},
+		},
+		{
+			name: "empty",
+			a:    "",
+			b:    "",
+			want: nil,
+		},
+		{
+			name: "insert",
+			a:    "a\nc\n",
+			b:    "a\nb\nc\n",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Insert, Text: "b", New: 2},
+				{Kind: Equal, Text: "c", Old: 2, New: 3},
+			},
+		},
+		{
+			name: "delete",
+			a:    "a\nb\nc\n",
+			b:    "a\nc\n",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Delete, Text: "b", Old: 2},
+				{Kind: Equal, Text: "c", Old: 3, New: 2},
+			},
+		},
+		{
+			name: "replace",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Delete, Text: "b", Old: 2},
+				{Kind: Insert, Text: "B", New: 2},
+				{Kind: Equal, Text: "c", Old: 3, New: 3},
+			},
+		},
+		{
+			name: "newline added at end",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Delete, Text: "b", Old: 2, NoNewline: true},
+				{Kind: Insert, Text: "b", New: 2},
+			},
+		},
+		{
+			name: "no newline on either side",
+			a:    "a\nb",
+			b:    "a\nc",
+			want: []Line{
+				{Kind: Equal, Text: "a", Old: 1, New: 1},
+				{Kind: Delete, Text: "b", Old: 2, NoNewline: true},
+				{Kind: Insert, Text: "c", New: 2, NoNewline: true},
+			},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "a\n",
+			want: []Line{
+				{Kind: Insert, Text: "a", New: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Lines(tt.a, tt.b)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lines(%q, %q)\n got %+v\nwant %+v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    [][4]int // old start, old lines, new start, new lines
+	}{
+		{
+			name:    "no changes",
+			a:       "a\nb\n",
+			b:       "a\nb\n",
+			context: 3,
+			want:    [][4]int{},
+		},
+		{
+			name:    "context is clipped at the edges",
+			a:       "a\nb\nc\n",
+			b:       "a\nB\nc\n",
+			context: 3,
+			want:    [][4]int{{1, 3, 1, 3}},
+		},
+		{
+			name:    "distant changes are separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			b:       "X\n2\n3\n4\n5\n6\n7\n8\nY\n",
+			context: 1,
+			want:    [][4]int{{1, 2, 1, 2}, {8, 2, 8, 2}},
+		},
+		{
+			name:    "close changes share a hunk",
+			a:       "1\n2\n3\n4\n5\n",
+			b:       "X\n2\n3\n4\nY\n",
+			context: 2,
+			want:    [][4]int{{1, 5, 1, 5}},
+		},
+		{
+			name:    "pure insertion starts at the line before",
+			a:       "1\n2\n3\n",
+			b:       "1\n2\nX\n3\n",
+			context: 0,
+			want:    [][4]int{{2, 0, 3, 1}},
+		},
+		{
+			name:    "pure deletion starts at the line before",
+			a:       "1\n2\n3\n",
+			b:       "1\n3\n",
+			context: 0,
+			want:    [][4]int{{2, 1, 1, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks := Hunks(Lines(tt.a, tt.b), tt.context)
+			got := [][4]int{}
+			for _, h := range hunks {
+				got = append(got, [4]int{h.OldStart, h.OldLines, h.NewStart, h.NewLines})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{
+			name: "no changes",
+			a:    "a\n",
+			b:    "a\n",
+			want: "",
+		},
+		{
+			name: "replace",
+			a:    "a\nb\nc\n",
+			b:    "a\nB\nc\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,3 +1,3 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"+B\n" +
+				" c\n",
+		},
+		{
+			name: "no newline at end of file",
+			a:    "a\nb",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n" +
+				" a\n" +
+				"-b\n" +
+				"\\ No newline at end of file\n" +
+				"+b\n",
+		},
+		{
+			name: "single line ranges",
+			a:    "a\n",
+			b:    "b\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -1 +1 @@\n" +
+				"-a\n" +
+				"+b\n",
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "a\nb\n",
+			want: "--- old\n+++ new\n" +
+				"@@ -0,0 +1,2 @@\n" +
+				"+a\n" +
+				"+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", Hunks(Lines(tt.a, tt.b), 3))
+			if got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package diff
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCharRun bounds, in bytes, a changed run of lines that Edits refines
+// character by character. Larger runs are replaced whole.
+const maxCharRun = 8192
+
+// Edit replaces Delete bytes at Position with Insert
+type Edit struct {
+	Position int    `json:"position"`
+	Delete   int    `json:"delete"`
+	Insert   string `json:"insert"`
+}
+
+// Edits returns a small set of edits turning a into b, so text that didn't
+// change is left alone rather than replaced. Lines are diffed first, then
+// the characters of each changed run of lines. Each edit's position is an
+// offset into the text after the edits before it, so they apply in order.
+func Edits(a, b string) []Edit {
+	var e editor
+	e.diff(SplitLines(a), SplitLines(b), true)
+	return e.edits
+}
+
+// editor collects edits while walking an edit script. del and ins hold the
+// current run of changes; pos is where it starts in the edited text.
+type editor struct {
+	edits    []Edit
+	pos      int
+	del, ins strings.Builder
+}
+
+// diff walks the edit script from a to b, where a and b are lines or, when
+// lines is false, characters
+func (e *editor) diff(a, b []string, lines bool) {
+	for _, op := range script(a, b) {
+		switch op.kind {
+		case Equal:
+			e.flush(lines)
+			e.pos += len(a[op.a])
+		case Delete:
+			e.del.WriteString(a[op.a])
+		case Insert:
+			e.ins.WriteString(b[op.b])
+		}
+	}
+	e.flush(lines)
+}
+
+// flush turns the current run of changes into edits, refining a run of
+// replaced lines character by character
+func (e *editor) flush(lines bool) {
+	del, ins := e.del.String(), e.ins.String()
+	e.del.Reset()
+	e.ins.Reset()
+	if del == "" && ins == "" {
+		return
+	}
+
+	if lines && del != "" && ins != "" && len(del)+len(ins) <= maxCharRun {
+		e.diff(splitRunes(del), splitRunes(ins), false)
+		return
+	}
+
+	e.edits = append(e.edits, Edit{Position: e.pos, Delete: len(del), Insert: ins})
+	e.pos += len(ins)
+}
+
+// splitRunes splits text into its characters, so edits never split one
+func splitRunes(text string) []string {
+	chars := make([]string, 0, len(text))
+	for len(text) > 0 {
+		_, size := utf8.DecodeRuneInString(text)
+		chars = append(chars, text[:size])
+		text = text[size:]
+	}
+	return chars
+}
@@ -0,0 +1,74 @@
+package diff
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// applyEdits applies edits in order, as a room applies operations
+func applyEdits(text string, edits []Edit) string {
+	for _, e := range edits {
+		text = text[:e.Position] + e.Insert + text[e.Position+e.Delete:]
+	}
+	return text
+}
+
+func TestEdits(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []Edit // nil to only check the round trip
+	}{
+		{name: "equal", a: "abc\n", b: "abc\n", want: []Edit{}},
+		{name: "from empty", a: "", b: "abc\n", want: []Edit{{Position: 0, Insert: "abc\n"}}},
+		{name: "to empty", a: "abc\n", b: "", want: []Edit{{Position: 0, Delete: 4}}},
+		{name: "one character", a: "hello world\n", b: "hello World\n", want: []Edit{{Position: 6, Delete: 1, Insert: "W"}}},
+		{name: "inserted line", a: "a\nc\n", b: "a\nb\nc\n", want: []Edit{{Position: 2, Insert: "b\n"}}},
+		{name: "removed line", a: "a\nb\nc\n", b: "a\nc\n", want: []Edit{{Position: 2, Delete: 2}}},
+		{name: "several lines", a: "one\ntwo\nthree\nfour\n", b: "one\n2\nthree\nfour!\n"},
+		{name: "no final newline", a: "a\nb", b: "a\nb\n"},
+		{name: "multibyte", a: "naïve café\n", b: "naive cafè\n"},
+		{name: "reordered", a: "a\nb\nc\nd\n", b: "d\nc\nb\na\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edits := Edits(tt.a, tt.b)
+			if got := applyEdits(tt.a, edits); got != tt.b {
+				t.Errorf("applying %+v to %q gave %q, want %q", edits, tt.a, got, tt.b)
+			}
+			if tt.want == nil {
+				return
+			}
+			if len(edits) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", edits, tt.want)
+			}
+			for i := range edits {
+				if edits[i] != tt.want[i] {
+					t.Errorf("got %+v, want %+v", edits, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestEditsRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "é", "\n", "\n", "func", " ", "{", "}"}
+	random := func() string {
+		var b strings.Builder
+		for n := rng.Intn(40); n > 0; n-- {
+			b.WriteString(words[rng.Intn(len(words))])
+		}
+		return b.String()
+	}
+
+	for i := 0; i < 1000; i++ {
+		a, b := random(), random()
+		if got := applyEdits(a, Edits(a, b)); got != b {
+			t.Fatalf("Edits(%q, %q) applied gave %q", a, b, got)
+		}
+	}
+}
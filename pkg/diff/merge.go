@@ -0,0 +1,181 @@
+package diff
+
+import (
+	"sort"
+	"strings"
+)
+
+// Conflict is a region both sides changed differently. StartLine and
+// EndLine are the 1-based lines of the conflict markers in the merged text.
+type Conflict struct {
+	StartLine int    `json:"start_line"`
+	EndLine   int    `json:"end_line"`
+	Base      string `json:"base"`
+	Ours      string `json:"ours"`
+	Theirs    string `json:"theirs"`
+}
+
+// MergeResult is the outcome of a three-way merge. Content holds
+// diff3-style conflict markers wherever Conflicts has an entry; Resolved is
+// the same merge with every conflict settled in favour of theirs.
+type MergeResult struct {
+	Content   string     `json:"content"`
+	Resolved  string     `json:"-"`
+	Clean     bool       `json:"clean"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// Labels names the sides in conflict markers
+type Labels struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// change replaces base lines [start, end) with lines, on one side
+type change struct {
+	start, end int
+	lines      []string
+	side       int
+}
+
+const (
+	ours = iota
+	theirs
+)
+
+// Merge3 merges the changes ours and theirs each made to base. Changes to
+// different regions are combined; identical changes are taken once; other
+// overlapping changes become conflicts.
+func Merge3(base, oursText, theirsText string, labels Labels) *MergeResult {
+	baseLines := SplitLines(base)
+	all := append(changes(baseLines, SplitLines(oursText), ours), changes(baseLines, SplitLines(theirsText), theirs)...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].start < all[j].start
+	})
+
+	result := &MergeResult{Clean: true, Conflicts: []Conflict{}}
+	var out, resolved []string
+	pos := 0
+
+	for i := 0; i < len(all); {
+		// Cluster every change overlapping the first one, transitively
+		cluster := []change{all[i]}
+		start, end := all[i].start, all[i].end
+		i++
+		for i < len(all) && overlaps(start, end, all[i]) {
+			cluster = append(cluster, all[i])
+			end = max(end, all[i].end)
+			i++
+		}
+
+		out = append(out, baseLines[pos:start]...)
+		resolved = append(resolved, baseLines[pos:start]...)
+		pos = end
+
+		oursLines, oursChanged := apply(baseLines, start, end, cluster, ours)
+		theirsLines, theirsChanged := apply(baseLines, start, end, cluster, theirs)
+
+		switch {
+		case !theirsChanged:
+			out = append(out, oursLines...)
+			resolved = append(resolved, oursLines...)
+		case !oursChanged, strings.Join(oursLines, "") == strings.Join(theirsLines, ""):
+			out = append(out, theirsLines...)
+			resolved = append(resolved, theirsLines...)
+		default:
+			result.Clean = false
+			conflict := Conflict{
+				StartLine: len(out) + 1,
+				Base:      strings.Join(baseLines[start:end], ""),
+				Ours:      strings.Join(oursLines, ""),
+				Theirs:    strings.Join(theirsLines, ""),
+			}
+			out = append(out, "<<<<<<< "+labels.Ours+"\n")
+			out = append(out, terminated(oursLines)...)
+			out = append(out, "||||||| "+labels.Base+"\n")
+			out = append(out, terminated(baseLines[start:end])...)
+			out = append(out, "=======\n")
+			out = append(out, terminated(theirsLines)...)
+			out = append(out, ">>>>>>> "+labels.Theirs+"\n")
+			conflict.EndLine = len(out)
+			result.Conflicts = append(result.Conflicts, conflict)
+			resolved = append(resolved, theirsLines...)
+		}
+	}
+	out = append(out, baseLines[pos:]...)
+	resolved = append(resolved, baseLines[pos:]...)
+
+	result.Content = strings.Join(out, "")
+	result.Resolved = strings.Join(resolved, "")
+	return result
+}
+
+// overlaps reports whether c touches the base range [start, end). Two
+// insertions at the same point, or an insertion at the edge of another
+// change, count as overlapping since their order would be a guess.
+func overlaps(start, end int, c change) bool {
+	if c.start < end {
+		return true
+	}
+	return c.start == end && (c.start == c.end || start == end)
+}
+
+// changes turns the diff from base to side into replaced base ranges
+func changes(base, side []string, which int) []change {
+	var out []change
+	var current *change
+	flush := func() {
+		if current != nil {
+			out = append(out, *current)
+			current = nil
+		}
+	}
+
+	for _, o := range script(base, side) {
+		if o.kind == Equal {
+			flush()
+			continue
+		}
+		if current == nil {
+			current = &change{start: o.a, end: o.a, side: which}
+		}
+		if o.kind == Delete {
+			current.end = o.a + 1
+		} else {
+			current.lines = append(current.lines, side[o.b])
+		}
+	}
+	flush()
+	return out
+}
+
+// apply returns one side's version of base[start:end] given the cluster's
+// changes, and whether that side changed anything in it
+func apply(base []string, start, end int, cluster []change, which int) ([]string, bool) {
+	var out []string
+	pos := start
+	changed := false
+	for _, c := range cluster {
+		if c.side != which {
+			continue
+		}
+		changed = true
+		out = append(out, base[pos:c.start]...)
+		out = append(out, c.lines...)
+		pos = c.end
+	}
+	out = append(out, base[pos:end]...)
+	return out, changed
+}
+
+// terminated makes sure the last line ends with a newline so a conflict
+// marker after it starts on its own line
+func terminated(lines []string) []string {
+	if len(lines) == 0 || strings.HasSuffix(lines[len(lines)-1], "\n") {
+		return lines
+	}
+	out := append([]string(nil), lines...)
+	out[len(out)-1] += "\n"
+	return out
+}
@@ -0,0 +1,129 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	labels := Labels{Ours: "ours", Base: "base", Theirs: "theirs"}
+
+	tests := []struct {
+		name         string
+		base         string
+		ours, theirs string
+		content      string
+		resolved     string // defaults to content
+		conflicts    int
+	}{
+		{
+			name:    "nothing changed",
+			base:    "a\nb\n",
+			ours:    "a\nb\n",
+			theirs:  "a\nb\n",
+			content: "a\nb\n",
+		},
+		{
+			name:    "only ours changed",
+			base:    "a\nb\nc\n",
+			ours:    "a\nB\nc\n",
+			theirs:  "a\nb\nc\n",
+			content: "a\nB\nc\n",
+		},
+		{
+			name:    "only theirs changed",
+			base:    "a\nb\nc\n",
+			ours:    "a\nb\nc\n",
+			theirs:  "a\nb\nC\n",
+			content: "a\nb\nC\n",
+		},
+		{
+			name:    "different regions",
+			base:    "a\nb\nc\nd\n",
+			ours:    "A\nb\nc\nd\n",
+			theirs:  "a\nb\nc\nD\n",
+			content: "A\nb\nc\nD\n",
+		},
+		{
+			name:    "identical changes",
+			base:    "a\nb\nc\n",
+			ours:    "a\nX\nc\n",
+			theirs:  "a\nX\nc\n",
+			content: "a\nX\nc\n",
+		},
+		{
+			name:   "conflicting changes",
+			base:   "a\nb\nc\n",
+			ours:   "a\nX\nc\n",
+			theirs: "a\nY\nc\n",
+			content: "a\n" +
+				"<<<<<<< ours\nX\n||||||| base\nb\n=======\nY\n>>>>>>> theirs\n" +
+				"c\n",
+			resolved:  "a\nY\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:   "adjacent inserts conflict",
+			base:   "a\nb\n",
+			ours:   "a\nX\nb\n",
+			theirs: "a\nY\nb\n",
+			content: "a\n" +
+				"<<<<<<< ours\nX\n||||||| base\n=======\nY\n>>>>>>> theirs\n" +
+				"b\n",
+			resolved:  "a\nY\nb\n",
+			conflicts: 1,
+		},
+		{
+			name:   "insert at the edge of a change conflicts",
+			base:   "a\nb\nc\n",
+			ours:   "a\nB\nc\n",
+			theirs: "a\nb\nY\nc\n",
+			content: "a\n" +
+				"<<<<<<< ours\nB\n||||||| base\nb\n=======\nb\nY\n>>>>>>> theirs\n" +
+				"c\n",
+			resolved:  "a\nb\nY\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:   "conflict without a final newline",
+			base:   "a\nb",
+			ours:   "a\nX",
+			theirs: "a\nY",
+			content: "a\n" +
+				"<<<<<<< ours\nX\n||||||| base\nb\n=======\nY\n>>>>>>> theirs\n",
+			resolved:  "a\nY",
+			conflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Merge3(tt.base, tt.ours, tt.theirs, labels)
+			if result.Content != tt.content {
+				t.Errorf("content\n got %q\nwant %q", result.Content, tt.content)
+			}
+			resolved := tt.resolved
+			if resolved == "" {
+				resolved = tt.content
+			}
+			if result.Resolved != resolved {
+				t.Errorf("resolved\n got %q\nwant %q", result.Resolved, resolved)
+			}
+			if len(result.Conflicts) != tt.conflicts || result.Clean != (tt.conflicts == 0) {
+				t.Errorf("got %d conflicts (clean %v), want %d", len(result.Conflicts), result.Clean, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMerge3ConflictLines(t *testing.T) {
+	result := Merge3("a\nb\nc\n", "a\nX\nc\n", "a\nY\nc\n", Labels{Ours: "ours", Base: "base", Theirs: "theirs"})
+	if len(result.Conflicts) != 1 {
+		t.Fatalf("got %d conflicts, want 1", len(result.Conflicts))
+	}
+
+	conflict := result.Conflicts[0]
+	if conflict.StartLine != 2 || conflict.EndLine != 8 {
+		t.Errorf("conflict at lines %d-%d, want 2-8", conflict.StartLine, conflict.EndLine)
+	}
+	if conflict.Base != "b\n" || conflict.Ours != "X\n" || conflict.Theirs != "Y\n" {
+		t.Errorf("got sides %q %q %q", conflict.Base, conflict.Ours, conflict.Theirs)
+	}
+}
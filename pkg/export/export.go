@@ -0,0 +1,222 @@
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/lang"
+)
+
+// Filename returns the file name a document is exported under
+func Filename(doc *db.Document) string {
+	return lang.Filename(path.Base(cleanPath(doc.Title)), doc.Language)
+}
+
+// Path returns where a document is stored under dir in an archive or
+// repository. Slashes in the title become subdirectories.
+func Path(dir string, doc *db.Document) string {
+	return path.Join(cleanPath(dir), lang.Filename(cleanPath(doc.Title), doc.Language))
+}
+
+// WriteJSON writes a document with all of its metadata
+func WriteJSON(w io.Writer, doc *db.Document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+// Archive streams documents into a zip or tar.gz file
+type Archive struct {
+	zip   *zip.Writer
+	tar   *tar.Writer
+	gzip  *gzip.Writer
+	paths map[string]bool
+}
+
+// NewArchive starts an archive of the given format ("zip" or "tar.gz")
+func NewArchive(w io.Writer, format string) (*Archive, error) {
+	a := &Archive{paths: make(map[string]bool)}
+
+	switch format {
+	case "zip":
+		a.zip = zip.NewWriter(w)
+	case "tar.gz", "tgz":
+		a.gzip = gzip.NewWriter(w)
+		a.tar = tar.NewWriter(a.gzip)
+	default:
+		return nil, fmt.Errorf("unsupported archive format %q", format)
+	}
+
+	return a, nil
+}
+
+// ContentType returns the MIME type of an archive format
+func ContentType(format string) string {
+	if format == "zip" {
+		return "application/zip"
+	}
+	return "application/gzip"
+}
+
+// Add writes a document into the archive under dir. Names that are already
+// taken get a numeric suffix, so documents with the same title in one
+// folder are all kept.
+func (a *Archive) Add(dir string, doc *db.Document) error {
+	name := a.uniquePath(Path(dir, doc))
+	modified := doc.UpdatedAt
+	if modified.IsZero() {
+		modified = time.Now()
+	}
+
+	if a.zip != nil {
+		f, err := a.zip.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add %s to archive: %w", name, err)
+		}
+		_, err = io.WriteString(f, doc.Content)
+		return err
+	}
+
+	err := a.tar.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(doc.Content)),
+		ModTime: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+	_, err = io.WriteString(a.tar, doc.Content)
+	return err
+}
+
+// Close finishes the archive
+func (a *Archive) Close() error {
+	if a.zip != nil {
+		return a.zip.Close()
+	}
+	if err := a.tar.Close(); err != nil {
+		return err
+	}
+	return a.gzip.Close()
+}
+
+func (a *Archive) uniquePath(name string) string {
+	candidate := name
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 2; a.paths[candidate]; i++ {
+		candidate = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	a.paths[candidate] = true
+	return candidate
+}
+
+// Layout places documents at paths that follow a workspace's folder tree
+type Layout struct {
+	paths   map[string]string
+	include map[string]bool
+	prefix  string
+}
+
+// NewLayout lays out a workspace's folders. If rootID is set only that
+// folder and the folders below it are included, and paths are relative to
+// it; otherwise paths are relative to the workspace root.
+func NewLayout(folders []*db.Folder, rootID string) *Layout {
+	layout := &Layout{paths: FolderPaths(folders)}
+	if rootID != "" {
+		layout.include = descendants(folders, rootID)
+		layout.prefix = layout.paths[rootID] + "/"
+	}
+	return layout
+}
+
+// Dir returns the directory for documents in a folder, and false if the
+// folder is outside the layout
+func (l *Layout) Dir(folderID *string) (string, bool) {
+	if folderID == nil || (l.include != nil && !l.include[*folderID]) {
+		return "", false
+	}
+	p, ok := l.paths[*folderID]
+	if !ok {
+		return "", false
+	}
+	if l.prefix != "" {
+		p = strings.TrimPrefix(p+"/", l.prefix)
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p, true
+}
+
+// FolderPaths maps each folder id to its slash-separated path from the
+// workspace root, e.g. "src/handlers"
+func FolderPaths(folders []*db.Folder) map[string]string {
+	byID := make(map[string]*db.Folder, len(folders))
+	for _, f := range folders {
+		byID[f.ID] = f
+	}
+
+	paths := make(map[string]string, len(folders))
+	var resolve func(f *db.Folder, depth int) string
+	resolve = func(f *db.Folder, depth int) string {
+		if p, ok := paths[f.ID]; ok {
+			return p
+		}
+		p := cleanPath(f.Name)
+		// depth guards against a cycle that slipped past the store
+		if f.ParentID != nil && depth < len(folders) {
+			if parent, ok := byID[*f.ParentID]; ok {
+				p = path.Join(resolve(parent, depth+1), p)
+			}
+		}
+		paths[f.ID] = p
+		return p
+	}
+
+	for _, f := range folders {
+		resolve(f, 0)
+	}
+	return paths
+}
+
+// descendants returns the ids of a folder and every folder below it
+func descendants(folders []*db.Folder, rootID string) map[string]bool {
+	children := make(map[string][]string)
+	for _, f := range folders {
+		if f.ParentID != nil {
+			children[*f.ParentID] = append(children[*f.ParentID], f.ID)
+		}
+	}
+
+	set := map[string]bool{rootID: true}
+	queue := []string{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, child := range children[id] {
+			if !set[child] {
+				set[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return set
+}
+
+// cleanPath makes a name safe to use as a relative archive path
+func cleanPath(name string) string {
+	p := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
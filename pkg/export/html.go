@@ -0,0 +1,216 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"unicode"
+
+	"collab-editor/pkg/db"
+)
+
+// syntax describes just enough of a language to colour it: comment markers,
+// string quotes and keywords
+type syntax struct {
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+	keywords     map[string]bool
+}
+
+func words(s string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		set[w] = true
+	}
+	return set
+}
+
+var cLike = syntax{
+	lineComments: []string{"//"},
+	blockComment: [2]string{"/*", "*/"},
+	quotes:       `"'`,
+}
+
+var syntaxes = map[string]syntax{
+	"go":         withKeywords(cLike, "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var true false nil", "\"'`"),
+	"javascript": withKeywords(cLike, "async await break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new return super switch this throw try typeof var void while with yield true false null undefined", "\"'`"),
+	"typescript": withKeywords(cLike, "abstract as async await break case catch class const continue declare default delete do else enum export extends finally for function if implements import in instanceof interface let new private protected public readonly return super switch this throw try type typeof var void while yield true false null undefined", "\"'`"),
+	"java":       withKeywords(cLike, "abstract boolean break byte case catch char class const continue default do double else enum extends final finally float for if implements import instanceof int interface long new package private protected public return short static super switch this throw throws try void volatile while true false null", `"'`),
+	"c":          withKeywords(cLike, "auto break case char const continue default do double else enum extern float for goto if int long register return short signed sizeof static struct switch typedef union unsigned void volatile while", `"'`),
+	"cpp":        withKeywords(cLike, "auto bool break case catch char class const continue default delete do double else enum explicit extern false float for friend if inline int long namespace new nullptr operator private protected public return short signed sizeof static struct switch template this throw true try typedef typename union unsigned using virtual void volatile while", `"'`),
+	"csharp":     withKeywords(cLike, "abstract as async await bool break case catch class const continue default do double else enum false finally float for foreach if in int interface internal is namespace new null object override private protected public readonly return static string struct switch this throw true try using var virtual void while", `"'`),
+	"rust":       withKeywords(cLike, "as async await break const continue crate else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while", `"'`),
+	"python": {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words("and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return True try while with yield"),
+	},
+	"ruby": {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words("alias and begin break case class def defined do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield"),
+	},
+	"shell": {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words("if then else elif fi case esac for while until do done in function return local export"),
+	},
+	"sql": {
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+		keywords:     words("select from where and or not insert into values update set delete create table index drop alter add column primary key references on join left right inner outer group by order having limit offset as distinct null is in exists case when then else end SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX DROP ALTER ADD COLUMN PRIMARY KEY REFERENCES ON JOIN LEFT RIGHT INNER OUTER GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT NULL IS IN EXISTS CASE WHEN THEN ELSE END"),
+	},
+	"yaml": {
+		lineComments: []string{"#"},
+		quotes:       `"'`,
+		keywords:     words("true false null yes no"),
+	},
+}
+
+func withKeywords(base syntax, keywords, quotes string) syntax {
+	base.keywords = words(keywords)
+	base.quotes = quotes
+	return base
+}
+
+// Highlight returns content as HTML with tokens wrapped in
+// <span class="tok-keyword|tok-string|tok-comment|tok-number">. Languages
+// without a known syntax are only escaped.
+func Highlight(content, language string) string {
+	syn, ok := syntaxes[strings.ToLower(language)]
+	if !ok {
+		return html.EscapeString(content)
+	}
+
+	var out strings.Builder
+	span := func(class, text string) {
+		fmt.Fprintf(&out, `<span class="tok-%s">%s</span>`, class, html.EscapeString(text))
+	}
+
+	src := []rune(content)
+	for i := 0; i < len(src); {
+		rest := string(src[i:])
+
+		if comment := matchComment(rest, syn); comment != "" {
+			span("comment", comment)
+			i += len([]rune(comment))
+			continue
+		}
+
+		r := src[i]
+		switch {
+		case strings.ContainsRune(syn.quotes, r):
+			j := i + 1
+			for j < len(src) && src[j] != r {
+				if src[j] == '\\' && r != '`' {
+					j++
+				} else if src[j] == '\n' && r != '`' {
+					break
+				}
+				j++
+			}
+			if j < len(src) && src[j] == r {
+				j++
+			}
+			if j > len(src) {
+				j = len(src)
+			}
+			span("string", string(src[i:j]))
+			i = j
+		case unicode.IsDigit(r):
+			j := i
+			for j < len(src) && (unicode.IsDigit(src[j]) || unicode.IsLetter(src[j]) || src[j] == '.' || src[j] == '_') {
+				j++
+			}
+			span("number", string(src[i:j]))
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(src) && (unicode.IsLetter(src[j]) || unicode.IsDigit(src[j]) || src[j] == '_') {
+				j++
+			}
+			word := string(src[i:j])
+			if syn.keywords[word] {
+				span("keyword", word)
+			} else {
+				out.WriteString(html.EscapeString(word))
+			}
+			i = j
+		default:
+			out.WriteString(html.EscapeString(string(r)))
+			i++
+		}
+	}
+
+	return out.String()
+}
+
+// matchComment returns the comment starting at the beginning of s, if any
+func matchComment(s string, syn syntax) string {
+	for _, marker := range syn.lineComments {
+		if strings.HasPrefix(s, marker) {
+			if end := strings.IndexByte(s, '\n'); end >= 0 {
+				return s[:end]
+			}
+			return s
+		}
+	}
+	if open, close := syn.blockComment[0], syn.blockComment[1]; open != "" && strings.HasPrefix(s, open) {
+		if end := strings.Index(s[len(open):], close); end >= 0 {
+			return s[:len(open)+end+len(close)]
+		}
+		return s
+	}
+	return ""
+}
+
+// stylesheet is embedded in exported pages so they render standalone
+const stylesheet = `body { margin: 0; background: #1e1e1e; color: #d4d4d4; }
+header { padding: 12px 16px; font-family: sans-serif; border-bottom: 1px solid #333; }
+header h1 { margin: 0; font-size: 16px; }
+header p { margin: 4px 0 0; font-size: 12px; color: #888; }
+pre { margin: 0; padding: 16px; font: 13px/1.5 Menlo, Consolas, monospace; }
+.tok-keyword { color: #569cd6; }
+.tok-string { color: #ce9178; }
+.tok-comment { color: #6a9955; font-style: italic; }
+.tok-number { color: #b5cea8; }`
+
+// WriteHTML writes doc as a standalone HTML page with syntax highlighting
+func WriteHTML(w io.Writer, doc *db.Document) error {
+	language := doc.Language
+	if language == "" {
+		language = "plaintext"
+	}
+
+	_, err := fmt.Fprintf(w, `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<title>%s</title>
+<style>
+%s
+</style>
+</head>
+<body>
+<header>
+<h1>%s</h1>
+<p>%s &middot; version %d &middot; updated %s</p>
+</header>
+<pre><code class="language-%s">%s</code></pre>
+</body>
+</html>
+`,
+		html.EscapeString(doc.Title),
+		stylesheet,
+		html.EscapeString(doc.Title),
+		html.EscapeString(language),
+		doc.Version,
+		doc.UpdatedAt.UTC().Format("2006-01-02 15:04:05 MST"),
+		html.EscapeString(language),
+		Highlight(doc.Content, language),
+	)
+	return err
+}
@@ -0,0 +1,160 @@
+// Package format runs source formatters for document languages: Go through
+// go/format, and anything else through external formatter binaries.
+package format
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnsupported is returned for a language without a formatter
+var ErrUnsupported = errors.New("no formatter for language")
+
+// Error is a formatter rejecting the source, typically for a syntax error
+type Error struct {
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Formatter formats source code of one language
+type Formatter interface {
+	Format(ctx context.Context, src string) (string, error)
+}
+
+// FormatterFunc adapts a function to a Formatter
+type FormatterFunc func(ctx context.Context, src string) (string, error)
+
+// Format calls f
+func (f FormatterFunc) Format(ctx context.Context, src string) (string, error) {
+	return f(ctx, src)
+}
+
+// Go formats Go source the way gofmt does
+var Go = FormatterFunc(func(ctx context.Context, src string) (string, error) {
+	out, err := format.Source([]byte(src))
+	if err != nil {
+		return "", &Error{Message: err.Error()}
+	}
+	return string(out), nil
+})
+
+// Command is an external formatter that reads source on stdin and writes
+// the formatted source to stdout. A non-zero exit means it rejected the
+// source, and what it wrote to stderr says why.
+type Command struct {
+	Path string
+	Args []string
+}
+
+// Format runs the command on src
+func (c Command) Format(ctx context.Context, src string) (string, error) {
+	cmd := exec.CommandContext(ctx, c.Path, c.Args...)
+	cmd.Stdin = strings.NewReader(src)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("%s timed out: %w", c.Path, ctx.Err())
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = fmt.Sprintf("%s exited with status %d", c.Path, exitErr.ExitCode())
+		}
+		return "", &Error{Message: message}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s: %w", c.Path, err)
+	}
+	return stdout.String(), nil
+}
+
+// ParseCommands reads external formatters from a spec such as
+// "python=black -q -;javascript=prettier --stdin-filepath x.js": entries
+// separated by semicolons, each a language, "=" and a command line split on
+// whitespace.
+func ParseCommands(spec string) (map[string]Command, error) {
+	commands := make(map[string]Command)
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		language, line, ok := strings.Cut(entry, "=")
+		fields := strings.Fields(line)
+		language = strings.ToLower(strings.TrimSpace(language))
+		if !ok || language == "" || len(fields) == 0 {
+			return nil, fmt.Errorf("invalid formatter %q: want language=command", entry)
+		}
+		commands[language] = Command{Path: fields[0], Args: fields[1:]}
+	}
+	return commands, nil
+}
+
+// Registry maps document languages to formatters
+type Registry struct {
+	formatters map[string]Formatter
+	timeout    time.Duration
+	mutex      sync.RWMutex
+}
+
+// NewRegistry creates a registry with the Go formatter. Each run of a
+// formatter is limited to timeout.
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{
+		formatters: map[string]Formatter{"go": Go},
+		timeout:    timeout,
+	}
+}
+
+// Register sets the formatter for a language, replacing any already set
+func (r *Registry) Register(language string, formatter Formatter) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.formatters[strings.ToLower(language)] = formatter
+}
+
+// Languages returns the languages that have a formatter, sorted
+func (r *Registry) Languages() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	languages := make([]string, 0, len(r.formatters))
+	for language := range r.formatters {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Format formats src with the formatter for language
+func (r *Registry) Format(ctx context.Context, language, src string) (string, error) {
+	r.mutex.RLock()
+	formatter, ok := r.formatters[strings.ToLower(language)]
+	r.mutex.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnsupported, language)
+	}
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	return formatter.Format(ctx, src)
+}
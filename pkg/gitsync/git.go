@@ -0,0 +1,222 @@
+package gitsync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// repo runs git plumbing commands against a local repository. Plumbing
+// works the same for bare and working repositories, and commits are built
+// in a private index so a working tree's own index is never disturbed.
+type repo struct {
+	dir string
+}
+
+// signature is a commit author or committer
+type signature struct {
+	Name  string
+	Email string
+}
+
+// treeEntry is a blob listed by ls-tree
+type treeEntry struct {
+	Path string
+	Hash string
+}
+
+// run executes git in the repository with extra environment variables and
+// optional stdin, returning trimmed stdout
+func (r *repo) run(env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = r.dir
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// isBare reports whether the repository has no working tree
+func (r *repo) isBare() (bool, error) {
+	out, err := r.run(nil, "", "rev-parse", "--is-bare-repository")
+	if err != nil {
+		return false, err
+	}
+	return out == "true", nil
+}
+
+// defaultBranch returns the branch HEAD points at, even if it has no commits yet
+func (r *repo) defaultBranch() string {
+	out, err := r.run(nil, "", "symbolic-ref", "--short", "HEAD")
+	if err != nil || out == "" {
+		return "main"
+	}
+	return out
+}
+
+// validBranch reports whether name is a valid branch name
+func (r *repo) validBranch(name string) bool {
+	_, err := r.run(nil, "", "check-ref-format", "--branch", name)
+	return err == nil
+}
+
+// resolve returns the commit hash for a revision, or "" if it doesn't exist
+func (r *repo) resolve(rev string) string {
+	out, err := r.run(nil, "", "rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return out
+}
+
+// headBranch returns the branch checked out in a working repository
+func (r *repo) headBranch() string {
+	out, _ := r.run(nil, "", "symbolic-ref", "--quiet", "HEAD")
+	return strings.TrimPrefix(out, "refs/heads/")
+}
+
+// listTree returns every blob at or below path in a commit
+func (r *repo) listTree(commit, path string) ([]treeEntry, error) {
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", commit}
+	if path != "" {
+		args = append(args, "--", path)
+	}
+	out, err := r.run(nil, "", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []treeEntry
+	for _, line := range strings.Split(out, "\x00") {
+		// <mode> SP <type> SP <hash> TAB <path>
+		meta, name, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		entries = append(entries, treeEntry{Path: name, Hash: fields[2]})
+	}
+	return entries, nil
+}
+
+// readBlob returns a blob's content
+func (r *repo) readBlob(hash string) (string, error) {
+	cmd := exec.Command("git", "cat-file", "blob", hash)
+	cmd.Dir = r.dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git cat-file %s: %w", hash, err)
+	}
+	return string(out), nil
+}
+
+// commitFiles commits files to a branch, replacing everything that was at
+// prefix ("" for the whole tree) with them. It returns "" if the tree didn't
+// change. In a working repository with the branch checked out, the working
+// tree is fast-forwarded too, and the commit is refused if that would
+// overwrite local changes.
+func (r *repo) commitFiles(branch, prefix string, files map[string]string, message string, author, committer signature) (string, error) {
+	indexDir, err := os.MkdirTemp("", "collab-gitsync-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(indexDir)
+	env := []string{"GIT_INDEX_FILE=" + indexDir + "/index"}
+
+	ref := "refs/heads/" + branch
+	parent := r.resolve(ref)
+
+	if parent != "" {
+		if _, err := r.run(env, "", "read-tree", parent); err != nil {
+			return "", err
+		}
+	}
+	removeArgs := []string{"rm", "--cached", "-r", "-q", "--ignore-unmatch", "--"}
+	if prefix == "" {
+		removeArgs = append(removeArgs, ".")
+	} else {
+		removeArgs = append(removeArgs, prefix)
+	}
+	if _, err := r.run(env, "", removeArgs...); err != nil {
+		return "", err
+	}
+
+	var indexInfo strings.Builder
+	for name, content := range files {
+		hash, err := r.run(nil, content, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&indexInfo, "100644 %s\t%s\n", hash, name)
+	}
+	if indexInfo.Len() > 0 {
+		if _, err := r.run(env, indexInfo.String(), "update-index", "--index-info"); err != nil {
+			return "", err
+		}
+	}
+
+	tree, err := r.run(env, "", "write-tree")
+	if err != nil {
+		return "", err
+	}
+	if parent != "" {
+		parentTree, err := r.run(nil, "", "rev-parse", parent+"^{tree}")
+		if err != nil {
+			return "", err
+		}
+		if parentTree == tree {
+			return "", nil
+		}
+	}
+
+	commitArgs := []string{"commit-tree", tree}
+	if parent != "" {
+		commitArgs = append(commitArgs, "-p", parent)
+	}
+	commitEnv := []string{
+		"GIT_AUTHOR_NAME=" + author.Name,
+		"GIT_AUTHOR_EMAIL=" + author.Email,
+		"GIT_COMMITTER_NAME=" + committer.Name,
+		"GIT_COMMITTER_EMAIL=" + committer.Email,
+	}
+	commit, err := r.run(commitEnv, message, commitArgs...)
+	if err != nil {
+		return "", err
+	}
+
+	bare, err := r.isBare()
+	if err != nil {
+		return "", err
+	}
+	if !bare && r.headBranch() == branch {
+		// Two-tree merge: a fast-forward that fails instead of clobbering local edits
+		readTreeArgs := []string{"read-tree", "-m", "-u"}
+		if parent != "" {
+			readTreeArgs = append(readTreeArgs, parent)
+		}
+		if _, err := r.run(nil, "", append(readTreeArgs, commit)...); err != nil {
+			return "", fmt.Errorf("working tree has conflicting local changes: %w", err)
+		}
+	}
+
+	// The old value makes this fail if the branch moved while we were committing
+	if _, err := r.run(nil, "", "update-ref", ref, commit, parent); err != nil {
+		return "", err
+	}
+
+	return commit, nil
+}
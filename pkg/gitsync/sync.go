@@ -0,0 +1,662 @@
+package gitsync
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/diff"
+	"collab-editor/pkg/export"
+	"collab-editor/pkg/importer"
+	"collab-editor/pkg/lang"
+	"collab-editor/pkg/room"
+)
+
+var (
+	ErrInvalidBinding = errors.New("invalid git binding")
+	ErrNoSuchCommit   = errors.New("commit not found")
+)
+
+// Config configures where repositories live and who commits
+type Config struct {
+	// Root is the directory every binding's repository must live under
+	Root string
+	// CommitterName and CommitterEmail identify the server as committer
+	CommitterName  string
+	CommitterEmail string
+	// EmailDomain builds author emails for users, as username@EmailDomain
+	EmailDomain string
+}
+
+// Syncer commits documents to git repositories and imports them back
+type Syncer struct {
+	config   Config
+	rooms    *room.RoomManager
+	bindings db.GitBindingStore
+	folders  db.FolderStore
+
+	locksMutex sync.Mutex
+	locks      map[string]*sync.Mutex // per repository
+}
+
+// CommitResult describes a commit made for a binding
+type CommitResult struct {
+	Commit  string   `json:"commit"`  // "" if nothing changed
+	Changed bool     `json:"changed"` // false when the repository already matched
+	Files   []string `json:"files"`
+	Authors []string `json:"authors"`
+}
+
+// ImportResult describes the documents touched by an import
+type ImportResult struct {
+	Commit    string             `json:"commit"`
+	Updated   []string           `json:"updated"`
+	Created   []string           `json:"created"`
+	Unchanged int                `json:"unchanged"`
+	Skipped   []importer.Skipped `json:"skipped"`
+	Conflicts []ImportConflict   `json:"conflicts"`
+}
+
+// ImportConflict is a document the import couldn't simply update: the commit
+// and edits made in the editor since the last sync changed the same lines,
+// in which case the document keeps the editor's text there and the rest of
+// the import is merged in, or the document was saved while the import ran,
+// in which case it is left alone (Error says so).
+type ImportConflict struct {
+	DocumentID string          `json:"document_id"`
+	Path       string          `json:"path"`
+	Conflicts  []diff.Conflict `json:"conflicts,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// importBase returns the content a document had at the last sync, the
+// common ancestor of the import and edits made since
+type importBase func(rel string) (string, bool)
+
+// NewSyncer creates a syncer. The room manager's store must support git
+// bindings and folders.
+func NewSyncer(cfg Config, rooms *room.RoomManager) (*Syncer, error) {
+	bindings, ok := rooms.Store.(db.GitBindingStore)
+	if !ok {
+		return nil, fmt.Errorf("git sync needs a store with git binding support")
+	}
+	folders, ok := rooms.Store.(db.FolderStore)
+	if !ok {
+		return nil, fmt.Errorf("git sync needs a store with folder support")
+	}
+
+	root, err := filepath.Abs(cfg.Root)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Root = root
+
+	return &Syncer{
+		config:   cfg,
+		rooms:    rooms,
+		bindings: bindings,
+		folders:  folders,
+		locks:    make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// Bindings returns the binding store
+func (s *Syncer) Bindings() db.GitBindingStore {
+	return s.bindings
+}
+
+// CreateBinding validates a binding against its repository and stores it.
+// An empty branch defaults to the repository's HEAD branch.
+func (s *Syncer) CreateBinding(binding *db.GitBinding) (*db.GitBinding, error) {
+	if (binding.DocumentID == nil) == (binding.FolderID == nil) {
+		return nil, fmt.Errorf("%w: exactly one of document_id and folder_id is required", ErrInvalidBinding)
+	}
+	if binding.IntervalSeconds < 0 {
+		return nil, fmt.Errorf("%w: interval_seconds can't be negative", ErrInvalidBinding)
+	}
+
+	binding.RepoPath = cleanRelative(binding.RepoPath)
+	binding.Path = cleanRelative(binding.Path)
+	if binding.DocumentID != nil && binding.Path == "" {
+		return nil, fmt.Errorf("%w: a document binding needs a file path", ErrInvalidBinding)
+	}
+
+	r, err := s.repo(binding)
+	if err != nil {
+		return nil, err
+	}
+	if binding.Branch == "" {
+		binding.Branch = r.defaultBranch()
+	}
+	if !r.validBranch(binding.Branch) {
+		return nil, fmt.Errorf("%w: %q is not a valid branch name", ErrInvalidBinding, binding.Branch)
+	}
+
+	if binding.DocumentID != nil {
+		if _, err := s.rooms.Store.GetDocument(*binding.DocumentID); err != nil {
+			return nil, err
+		}
+	} else if _, err := s.folders.GetFolder(*binding.FolderID); err != nil {
+		return nil, err
+	}
+
+	return s.bindings.CreateGitBinding(binding)
+}
+
+// Commit snapshots a binding's documents, including unsaved edits in live
+// rooms, and commits them if anything changed. The first user connected to
+// the documents is the author and the others are credited as co-authors.
+func (s *Syncer) Commit(binding *db.GitBinding, message string) (*CommitResult, error) {
+	r, err := s.repo(binding)
+	if err != nil {
+		return nil, err
+	}
+
+	files, users, err := s.snapshot(binding)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if strings.TrimSpace(message) == "" {
+		message = "Update " + describe(binding)
+	}
+	author := signature{Name: s.config.CommitterName, Email: s.config.CommitterEmail}
+	if len(users) > 0 {
+		author = s.userSignature(users[0])
+		var trailers []string
+		for _, user := range users[1:] {
+			sig := s.userSignature(user)
+			trailers = append(trailers, fmt.Sprintf("Co-authored-by: %s <%s>", sig.Name, sig.Email))
+		}
+		if len(trailers) > 0 {
+			message += "\n\n" + strings.Join(trailers, "\n")
+		}
+	}
+
+	lock := s.lock(binding.RepoPath)
+	lock.Lock()
+	commit, err := r.commitFiles(binding.Branch, binding.Path, files, message+"\n", author, signature{
+		Name:  s.config.CommitterName,
+		Email: s.config.CommitterEmail,
+	})
+	lock.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit %s: %w", describe(binding), err)
+	}
+
+	synced := commit
+	if synced == "" {
+		synced = binding.LastCommit
+	}
+	if err := s.bindings.MarkGitBindingSynced(binding.ID, synced, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &CommitResult{
+		Commit:  commit,
+		Changed: commit != "",
+		Files:   names,
+		Authors: users,
+	}, nil
+}
+
+// Import loads a binding's files from a commit (a hash, branch or tag; ""
+// means the binding's branch) into its documents. Changed documents are
+// updated and pushed to live rooms; files without a document are created.
+// Documents missing from the commit are left alone.
+func (s *Syncer) Import(binding *db.GitBinding, rev string) (*ImportResult, error) {
+	r, err := s.repo(binding)
+	if err != nil {
+		return nil, err
+	}
+	if rev == "" {
+		rev = "refs/heads/" + binding.Branch
+	}
+	commit := ""
+	if !strings.HasPrefix(rev, "-") {
+		commit = r.resolve(rev)
+	}
+	if commit == "" {
+		return nil, fmt.Errorf("%w: %s", ErrNoSuchCommit, rev)
+	}
+
+	entries, err := r.listTree(commit, binding.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := importer.NewCollector()
+	for _, entry := range entries {
+		rel := entry.Path
+		if binding.FolderID != nil && binding.Path != "" {
+			rel = strings.TrimPrefix(rel, binding.Path+"/")
+		}
+		content, err := r.readBlob(entry.Hash)
+		if err != nil {
+			return nil, err
+		}
+		if err := collector.Add(rel, strings.NewReader(content)); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &ImportResult{
+		Commit:    commit,
+		Updated:   []string{},
+		Created:   []string{},
+		Skipped:   collector.Skipped,
+		Conflicts: []ImportConflict{},
+	}
+
+	base := s.lastSynced(r, binding)
+	if binding.DocumentID != nil {
+		err = s.importDocument(binding, collector.Files, base, result)
+	} else {
+		err = s.importFolder(binding, collector.Files, base, result)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.bindings.MarkGitBindingSynced(binding.ID, commit, time.Now()); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// lastSynced returns the files at the binding's last synced commit, keyed
+// like imported files. Without one every lookup fails.
+func (s *Syncer) lastSynced(r *repo, binding *db.GitBinding) importBase {
+	hashes := make(map[string]string)
+	if binding.LastCommit != "" {
+		entries, err := r.listTree(binding.LastCommit, binding.Path)
+		if err != nil {
+			log.Printf("git sync: failed to read last synced commit of %s: %v", describe(binding), err)
+		}
+		for _, entry := range entries {
+			rel := entry.Path
+			if binding.FolderID != nil && binding.Path != "" {
+				rel = strings.TrimPrefix(rel, binding.Path+"/")
+			}
+			hashes[cleanRelative(rel)] = entry.Hash
+		}
+	}
+
+	return func(rel string) (string, bool) {
+		hash, ok := hashes[rel]
+		if !ok {
+			return "", false
+		}
+		content, err := r.readBlob(hash)
+		if err != nil {
+			log.Printf("git sync: failed to read %s at the last synced commit: %v", rel, err)
+			return "", false
+		}
+		return content, true
+	}
+}
+
+func (s *Syncer) importDocument(binding *db.GitBinding, files []importer.File, base importBase, result *ImportResult) error {
+	if len(files) != 1 || files[0].Path != binding.Path {
+		return fmt.Errorf("%w: %s is not a text file in this commit", ErrInvalidBinding, binding.Path)
+	}
+
+	doc, err := s.rooms.Store.GetDocument(*binding.DocumentID)
+	if err != nil {
+		return err
+	}
+	return s.updateContent(doc, files[0].Path, files[0].Content, base, result)
+}
+
+func (s *Syncer) importFolder(binding *db.GitBinding, files []importer.File, base importBase, result *ImportResult) error {
+	existing, _, err := s.folderDocuments(*binding.FolderID)
+	if err != nil {
+		return err
+	}
+
+	var tree *importer.FolderTree
+	for _, file := range files {
+		if doc, ok := existing[file.Path]; ok {
+			if err := s.updateContent(doc, file.Path, file.Content, base, result); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if tree == nil {
+			tree, err = importer.NewFolderTree(s.folders, "", *binding.FolderID)
+			if err != nil {
+				return err
+			}
+		}
+		dir, name := path.Split(file.Path)
+		folderID, err := tree.Resolve(strings.TrimSuffix(dir, "/"))
+		if err != nil {
+			return err
+		}
+
+		doc, err := s.rooms.Store.CreateDocument(&db.NewDocument{
+			Title:    name,
+			Content:  file.Content,
+			Language: lang.Detect(file.Path, file.Content),
+			FolderID: folderID,
+		})
+		if err != nil {
+			return err
+		}
+		s.rooms.RefreshDocument(doc)
+		s.rooms.Emit(room.EventDocumentCreated, doc, nil)
+		result.Created = append(result.Created, doc.ID)
+	}
+	return nil
+}
+
+// updateContent persists imported content if it differs from what's live.
+// When the document was also edited since the last sync, the edits are
+// three-way merged with the import instead of being overwritten, keeping the
+// edits where both changed the same lines. A document open in a room gets
+// the merge as operations, applied under the room lock, so edits made
+// meanwhile aren't lost and cursors, comments and undo history stay put.
+// Otherwise the write is guarded by the version read, so a save racing the
+// import is reported rather than lost.
+func (s *Syncer) updateContent(doc *db.Document, rel, content string, base importBase, result *ImportResult) error {
+	ancestor, ok := base(rel)
+	if !ok {
+		// Never synced: the stored content is where any live edits started
+		ancestor = doc.Content
+	}
+
+	if liveRoom, ok := s.rooms.GetRoom(doc.ID); ok {
+		return s.updateRoom(liveRoom, rel, content, ancestor, result)
+	}
+
+	content, changed := mergeImport(doc, rel, content, ancestor, doc.Content, result)
+	if !changed {
+		result.Unchanged++
+		return nil
+	}
+
+	updated, err := s.rooms.Store.UpdateDocument(doc.ID, &db.DocumentUpdate{
+		Content:         &content,
+		ExpectedVersion: &doc.Version,
+	})
+	var conflict *db.VersionConflictError
+	if errors.As(err, &conflict) {
+		result.Conflicts = append(result.Conflicts, ImportConflict{
+			DocumentID: doc.ID,
+			Path:       rel,
+			Error:      fmt.Sprintf("saved as version %d while importing; import again", conflict.Actual),
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.rooms.MoveCommentAnchors(doc.ID, doc.Content, updated.Content)
+	s.rooms.RefreshDocument(updated)
+	s.rooms.Emit(room.EventDocumentUpdated, updated, nil)
+	result.Updated = append(result.Updated, updated.ID)
+	return nil
+}
+
+// updateRoom merges imported content into a live room as operations, then
+// saves the room's content. A save racing it only means the merge lands
+// with the room's next save.
+func (s *Syncer) updateRoom(r *room.Room, rel, content, ancestor string, result *ImportResult) error {
+	var saved db.Document
+	operations := r.Edit(func(doc db.Document) []*room.Operation {
+		merged, changed := mergeImport(&doc, rel, content, ancestor, doc.Content, result)
+		if !changed {
+			return nil
+		}
+		return room.EditOperations(doc.Content, merged, "", "git")
+	}, "", func(doc db.Document) {
+		saved = doc
+	})
+	if len(operations) == 0 {
+		result.Unchanged++
+		return nil
+	}
+	result.Updated = append(result.Updated, r.ID)
+
+	_, err := s.rooms.SaveEdit(r, saved)
+	var conflict *db.VersionConflictError
+	if errors.As(err, &conflict) {
+		log.Printf("git sync: %s was saved as version %d while importing; the import is live and saves with it", r.ID, conflict.Actual)
+		return nil
+	}
+	return err
+}
+
+// mergeImport returns what a document holding live should hold after
+// importing content: content itself, or its three-way merge with live when
+// live was edited since ancestor, recording any conflicts. It reports false
+// when that is live already.
+func mergeImport(doc *db.Document, rel, content, ancestor, live string, result *ImportResult) (string, bool) {
+	if live == content {
+		return live, false
+	}
+	if live == ancestor {
+		return content, true
+	}
+
+	merge := diff.Merge3(ancestor, content, live, diff.Labels{
+		Ours:   "import",
+		Base:   "last sync",
+		Theirs: "editor",
+	})
+	if !merge.Clean {
+		result.Conflicts = append(result.Conflicts, ImportConflict{
+			DocumentID: doc.ID,
+			Path:       rel,
+			Conflicts:  merge.Conflicts,
+		})
+	}
+	return merge.Resolved, merge.Resolved != live
+}
+
+// snapshot returns a binding's files keyed by repository path, and the
+// users connected to them
+func (s *Syncer) snapshot(binding *db.GitBinding) (map[string]string, []string, error) {
+	files := make(map[string]string)
+	var docIDs, folderIDs []string
+
+	if binding.DocumentID != nil {
+		doc, err := s.rooms.Store.GetDocument(*binding.DocumentID)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[binding.Path] = s.rooms.LiveDocument(doc).Content
+		docIDs = append(docIDs, doc.ID)
+		if doc.FolderID != nil {
+			folderIDs = append(folderIDs, *doc.FolderID)
+		}
+	} else {
+		byPath, ids, err := s.folderDocuments(*binding.FolderID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, doc := range byPath {
+			files[path.Join(binding.Path, name)] = s.rooms.LiveDocument(doc).Content
+			docIDs = append(docIDs, doc.ID)
+		}
+		folderIDs = ids
+	}
+
+	return files, s.connectedUsers(docIDs, folderIDs), nil
+}
+
+// folderDocuments returns the documents in a folder and its subfolders keyed
+// by their path relative to it, plus the ids of those folders
+func (s *Syncer) folderDocuments(folderID string) (map[string]*db.Document, []string, error) {
+	root, err := s.folders.GetFolder(folderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	folders, err := s.folders.ListFolders(root.WorkspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	layout := export.NewLayout(folders, root.ID)
+
+	var folderIDs []string
+	for _, f := range folders {
+		if _, ok := layout.Dir(&f.ID); ok {
+			folderIDs = append(folderIDs, f.ID)
+		}
+	}
+
+	byPath := make(map[string]*db.Document)
+	opts := &db.ListOptions{WorkspaceID: root.WorkspaceID, Sort: "created_at", Order: "asc", Limit: db.MaxListLimit}
+	for {
+		page, err := s.rooms.Store.ListDocuments(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, doc := range page.Documents {
+			dir, ok := layout.Dir(doc.FolderID)
+			if !ok {
+				continue
+			}
+			name := export.Path(dir, doc)
+			if _, taken := byPath[name]; taken {
+				log.Printf("git sync: skipping document %s, %s is already taken", doc.ID, name)
+				continue
+			}
+			byPath[name] = doc
+		}
+		if page.NextCursor == "" {
+			return byPath, folderIDs, nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+// connectedUsers returns the distinct usernames in the documents' rooms and
+// the folders' project rooms, sorted
+func (s *Syncer) connectedUsers(docIDs, folderIDs []string) []string {
+	seen := make(map[string]bool)
+	var users []string
+	add := func(list []room.User) {
+		for _, user := range list {
+			if user.Username != "" && !seen[user.Username] {
+				seen[user.Username] = true
+				users = append(users, user.Username)
+			}
+		}
+	}
+
+	for _, id := range docIDs {
+		if liveRoom, ok := s.rooms.GetRoom(id); ok {
+			add(liveRoom.GetUsers())
+		}
+	}
+	for _, id := range folderIDs {
+		if project, ok := s.rooms.GetProjectRoom(id); ok {
+			add(project.GetUsers())
+		}
+	}
+
+	sort.Strings(users)
+	return users
+}
+
+var unsafeEmailChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+func (s *Syncer) userSignature(username string) signature {
+	local := strings.Trim(unsafeEmailChars.ReplaceAllString(username, "-"), "-.")
+	if local == "" {
+		local = "user"
+	}
+	return signature{Name: username, Email: local + "@" + s.config.EmailDomain}
+}
+
+// RunScheduler commits every binding with an interval once it's due. It
+// checks every tick and blocks until stop is closed.
+func (s *Syncer) RunScheduler(tick time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			bindings, err := s.bindings.ListGitBindings()
+			if err != nil {
+				log.Printf("git sync: failed to list bindings: %v", err)
+				continue
+			}
+			for _, binding := range bindings {
+				if binding.IntervalSeconds <= 0 {
+					continue
+				}
+				due := binding.CreatedAt
+				if binding.LastSyncedAt != nil {
+					due = *binding.LastSyncedAt
+				}
+				if now.Before(due.Add(time.Duration(binding.IntervalSeconds) * time.Second)) {
+					continue
+				}
+				if result, err := s.Commit(binding, "Scheduled snapshot of "+describe(binding)); err != nil {
+					log.Printf("git sync: scheduled commit for binding %s failed: %v", binding.ID, err)
+				} else if result.Changed {
+					log.Printf("git sync: committed %s to %s (%s)", describe(binding), binding.RepoPath, result.Commit)
+				}
+			}
+		}
+	}
+}
+
+// repo opens a binding's repository, which must live under the configured root
+func (s *Syncer) repo(binding *db.GitBinding) (*repo, error) {
+	dir := filepath.Join(s.config.Root, filepath.FromSlash(cleanRelative(binding.RepoPath)))
+	r := &repo{dir: dir}
+
+	// Accept the repository itself, not a directory that happens to sit inside one
+	gitDir, err := r.run(nil, "", "rev-parse", "--absolute-git-dir")
+	if err != nil || (gitDir != dir && gitDir != filepath.Join(dir, ".git")) {
+		return nil, fmt.Errorf("%w: %s is not a git repository", ErrInvalidBinding, binding.RepoPath)
+	}
+	return r, nil
+}
+
+func (s *Syncer) lock(repoPath string) *sync.Mutex {
+	s.locksMutex.Lock()
+	defer s.locksMutex.Unlock()
+
+	lock, ok := s.locks[repoPath]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[repoPath] = lock
+	}
+	return lock
+}
+
+func describe(binding *db.GitBinding) string {
+	if binding.Path == "" {
+		return "repository root"
+	}
+	return binding.Path
+}
+
+// cleanRelative turns a user-supplied path into a slash path that can't
+// climb out of its root
+func cleanRelative(p string) string {
+	cleaned := path.Clean("/" + strings.ReplaceAll(p, "\\", "/"))
+	return strings.TrimPrefix(cleaned, "/")
+}
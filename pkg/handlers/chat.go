@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/room"
+
+	"github.com/gorilla/mux"
+)
+
+// maxChatLength caps a chat message, in characters
+const maxChatLength = 4000
+
+// handleChat stores a chat message, when the store keeps chat, and sends it
+// to everyone in the room
+func (h *Handlers) handleChat(client *room.Client, msg map[string]interface{}) {
+	content, ok := msg["content"].(string)
+	content = strings.TrimSpace(content)
+	if !ok || content == "" || utf8.RuneCountInString(content) > maxChatLength {
+		log.Printf("Invalid chat format")
+		return
+	}
+	seq, _ := msg["seq"].(float64)
+
+	message := &db.ChatMessage{
+		DocumentID: client.Room.ID,
+		UserID:     client.ClientID,
+		Username:   client.Username,
+		Content:    content,
+		CreatedAt:  time.Now(),
+	}
+
+	if store, ok := h.roomManager.Store.(db.ChatStore); ok {
+		created, err := store.CreateChatMessage(message)
+		if err != nil {
+			log.Printf("failed to store chat message in %s: %v", client.Room.ID, err)
+			return
+		}
+		message = created
+	}
+
+	client.Room.BroadcastChat(message, client.ID, uint64(seq))
+
+	author := commentAuthor{ID: client.ClientID, Name: client.Username}
+	h.notifyMentions(client.Room.ID, "chat", strconv.FormatInt(message.ID, 10), author, content)
+}
+
+// ListChatMessages returns a page of a document's chat history, oldest first.
+// Pages go back in time: the X-Next-Cursor header holds the cursor for the
+// page before this one.
+func (h *Handlers) ListChatMessages(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.roomManager.Store.(db.ChatStore)
+	if !ok {
+		http.Error(w, "Chat history is not supported by this storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	limit := db.DefaultChatLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, db.MaxChatLimit)
+	}
+	var before int64
+	if raw := query.Get("cursor"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, db.ErrInvalidCursor.Error(), http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	if _, err := h.roomManager.Store.GetDocument(id); err != nil {
+		writeStoreError(w, err, "Failed to get document")
+		return
+	}
+
+	// One extra message tells whether there is an older page
+	messages, err := store.ListChatMessages(id, before, limit+1)
+	if err != nil {
+		writeStoreError(w, err, "Failed to list chat messages")
+		return
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(messages[limit-1].ID, 10))
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/room"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCommentLength caps a comment, in characters
+const maxCommentLength = 10000
+
+var errInvalidComment = errors.New("content must be 1 to 10000 characters")
+
+// commentAuthor is who writes a comment: a connected identity, or just a
+// name over REST
+type commentAuthor struct {
+	ID   string
+	Name string
+}
+
+// commentStore returns the store's comment support, writing a 501 if it has none
+func (h *Handlers) commentStore(w http.ResponseWriter) (db.CommentStore, bool) {
+	store, ok := h.roomManager.Store.(db.CommentStore)
+	if !ok {
+		http.Error(w, "Comments are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// commentText trims a comment and checks its length
+func commentText(content string) (string, error) {
+	content = strings.TrimSpace(content)
+	if content == "" || utf8.RuneCountInString(content) > maxCommentLength {
+		return "", errInvalidComment
+	}
+	return content, nil
+}
+
+// commentThread loads a thread, treating one on another document as missing.
+// A live room's anchors replace the stored ones.
+func (h *Handlers) commentThread(store db.CommentStore, documentID, threadID string) (*db.CommentThread, error) {
+	thread, err := store.GetCommentThread(threadID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.DocumentID != documentID {
+		return nil, db.ErrCommentThreadNotFound
+	}
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		if live, ok := liveRoom.CommentThread(threadID); ok {
+			thread.Start, thread.End = live.Start, live.End
+		}
+	}
+	return thread, nil
+}
+
+// openCommentThread anchors a new thread to [start, end) of the document's
+// live content. In a live room the range is checked and the thread stored
+// under the room lock, see Room.OpenCommentThread.
+func (h *Handlers) openCommentThread(store db.CommentStore, documentID string, start, end int, content string, author commentAuthor) (*db.CommentThread, error) {
+	content, err := commentText(content)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &db.CommentThread{
+		DocumentID: documentID,
+		Start:      start,
+		End:        end,
+	}
+	create := func(thread *db.CommentThread) (*db.CommentThread, error) {
+		return store.CreateCommentThread(thread, &db.Comment{
+			AuthorID: author.ID,
+			Author:   author.Name,
+			Content:  content,
+		})
+	}
+
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		thread, err = liveRoom.OpenCommentThread(thread, create)
+	} else {
+		thread, err = h.openStoredCommentThread(documentID, thread, create)
+	}
+	if err != nil {
+		return nil, err
+	}
+	h.notifyMentions(documentID, "comment", thread.Comments[0].ID, author, content)
+	return thread, nil
+}
+
+// openStoredCommentThread opens a thread on the stored content of a
+// document no room has open
+func (h *Handlers) openStoredCommentThread(documentID string, thread *db.CommentThread, create func(*db.CommentThread) (*db.CommentThread, error)) (*db.CommentThread, error) {
+	doc, err := h.roomManager.Store.GetDocument(documentID)
+	if err != nil {
+		return nil, err
+	}
+	if thread.Start < 0 || thread.End < thread.Start || thread.End > len(doc.Content) {
+		return nil, room.ErrInvalidRange
+	}
+	thread.Quote = doc.Content[thread.Start:thread.End]
+	return create(thread)
+}
+
+// replyToCommentThread adds a comment to a thread
+func (h *Handlers) replyToCommentThread(store db.CommentStore, documentID, threadID, content string, author commentAuthor) (*db.Comment, error) {
+	content, err := commentText(content)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := h.commentThread(store, documentID, threadID); err != nil {
+		return nil, err
+	}
+
+	comment, err := store.AddComment(&db.Comment{
+		ThreadID: threadID,
+		AuthorID: author.ID,
+		Author:   author.Name,
+		Content:  content,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		liveRoom.AddComment(comment)
+	}
+	h.notifyMentions(documentID, "comment", comment.ID, author, content)
+	return comment, nil
+}
+
+// resolveCommentThread marks a thread resolved or reopens it
+func (h *Handlers) resolveCommentThread(store db.CommentStore, documentID, threadID string, resolved bool, by string) (*db.CommentThread, error) {
+	if _, err := h.commentThread(store, documentID, threadID); err != nil {
+		return nil, err
+	}
+
+	thread, err := store.ResolveCommentThread(threadID, resolved, by)
+	if err != nil {
+		return nil, err
+	}
+
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		thread = liveRoom.PutCommentThread(thread, "comment_thread_updated")
+	}
+	return thread, nil
+}
+
+// deleteCommentThread removes a thread and its comments
+func (h *Handlers) deleteCommentThread(store db.CommentStore, documentID, threadID string) error {
+	if _, err := h.commentThread(store, documentID, threadID); err != nil {
+		return err
+	}
+	if err := store.DeleteCommentThread(threadID); err != nil {
+		return err
+	}
+
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		liveRoom.RemoveCommentThread(threadID)
+	}
+	return nil
+}
+
+// handleCommentMessage handles comment_create, comment_reply, comment_resolve
+// and comment_delete from a room client. Results reach the client through
+// the room broadcast like everyone else.
+func (h *Handlers) handleCommentMessage(client *room.Client, msg map[string]interface{}) {
+	store, ok := h.roomManager.Store.(db.CommentStore)
+	if !ok {
+		log.Printf("comments are not supported by this storage backend")
+		return
+	}
+
+	documentID := client.Room.ID
+	author := commentAuthor{ID: client.ClientID, Name: client.Username}
+	threadID, _ := msg["thread_id"].(string)
+	content, _ := msg["content"].(string)
+
+	var err error
+	switch msg["type"] {
+	case "comment_create":
+		start, oks := msg["start"].(float64)
+		end, oke := msg["end"].(float64)
+		if !oks || !oke {
+			log.Printf("Invalid comment format")
+			return
+		}
+		_, err = h.openCommentThread(store, documentID, int(start), int(end), content, author)
+	case "comment_reply":
+		_, err = h.replyToCommentThread(store, documentID, threadID, content, author)
+	case "comment_resolve":
+		resolved, ok := msg["resolved"].(bool)
+		if !ok {
+			resolved = true
+		}
+		_, err = h.resolveCommentThread(store, documentID, threadID, resolved, client.Username)
+	case "comment_delete":
+		err = h.deleteCommentThread(store, documentID, threadID)
+	}
+	if err != nil {
+		log.Printf("%v from %s failed: %v", msg["type"], client.ID, err)
+	}
+}
+
+// writeCommentError maps comment validation errors to 400 and everything else
+// through writeStoreError
+func writeCommentError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, errInvalidComment) || errors.Is(err, room.ErrInvalidRange) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeStoreError(w, err, message)
+}
+
+// ListCommentThreads returns a document's comment threads in document order.
+// resolved=true or resolved=false filters by state.
+func (h *Handlers) ListCommentThreads(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var filter *bool
+	switch r.URL.Query().Get("resolved") {
+	case "":
+	case "true":
+		filter = new(bool)
+		*filter = true
+	case "false":
+		filter = new(bool)
+	default:
+		http.Error(w, "resolved must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	var threads []*db.CommentThread
+	if liveRoom, ok := h.roomManager.GetRoom(id); ok {
+		threads = liveRoom.CommentThreads()
+	} else {
+		if _, err := h.roomManager.Store.GetDocument(id); err != nil {
+			writeStoreError(w, err, "Failed to get document")
+			return
+		}
+		var err error
+		threads, err = store.ListCommentThreads(id)
+		if err != nil {
+			writeStoreError(w, err, "Failed to list comments")
+			return
+		}
+	}
+
+	filtered := []*db.CommentThread{}
+	for _, thread := range threads {
+		if filter == nil || thread.Resolved == *filter {
+			filtered = append(filtered, thread)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(filtered)
+}
+
+// CreateCommentThread opens a thread on a range of a document
+func (h *Handlers) CreateCommentThread(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Start   *int   `json:"start"`
+		End     *int   `json:"end"`
+		Content string `json:"content"`
+		Author  string `json:"author"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Author = strings.TrimSpace(req.Author)
+	if req.Start == nil || req.End == nil || req.Author == "" {
+		http.Error(w, "start, end, content and author are required", http.StatusBadRequest)
+		return
+	}
+
+	thread, err := h.openCommentThread(store, mux.Vars(r)["id"], *req.Start, *req.End, req.Content, commentAuthor{Name: req.Author})
+	if err != nil {
+		writeCommentError(w, err, "Failed to create comment thread")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(thread)
+}
+
+// GetCommentThread returns one thread with its comments
+func (h *Handlers) GetCommentThread(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	thread, err := h.commentThread(store, vars["id"], vars["threadId"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get comment thread")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// ReplyToCommentThread adds a comment to a thread
+func (h *Handlers) ReplyToCommentThread(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+		Author  string `json:"author"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Author = strings.TrimSpace(req.Author)
+	if req.Author == "" {
+		http.Error(w, "content and author are required", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	comment, err := h.replyToCommentThread(store, vars["id"], vars["threadId"], req.Content, commentAuthor{Name: req.Author})
+	if err != nil {
+		writeCommentError(w, err, "Failed to add comment")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// UpdateCommentThread resolves or reopens a thread
+func (h *Handlers) UpdateCommentThread(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Resolved *bool  `json:"resolved"`
+		By       string `json:"by"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Resolved == nil {
+		http.Error(w, "resolved is required", http.StatusBadRequest)
+		return
+	}
+
+	vars := mux.Vars(r)
+	thread, err := h.resolveCommentThread(store, vars["id"], vars["threadId"], *req.Resolved, strings.TrimSpace(req.By))
+	if err != nil {
+		writeStoreError(w, err, "Failed to update comment thread")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(thread)
+}
+
+// DeleteCommentThread removes a thread and all of its comments
+func (h *Handlers) DeleteCommentThread(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.commentStore(w)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := h.deleteCommentThread(store, vars["id"], vars["threadId"]); err != nil {
+		writeStoreError(w, err, "Failed to delete comment thread")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
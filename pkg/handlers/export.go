@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/export"
+
+	"github.com/gorilla/mux"
+)
+
+// maxExportIDs caps how many documents can be picked by id in one bulk export
+const maxExportIDs = 500
+
+// setAttachment marks the response as a download with the given file name
+func setAttachment(w http.ResponseWriter, contentType, filename string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
+
+// ExportDocument downloads one document. The format query parameter is raw
+// (default; the file itself, named after the title and language), json (the
+// document with all metadata) or html (a standalone syntax-highlighted page).
+func (h *Handlers) ExportDocument(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.roomManager.Store.GetDocument(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get document")
+		return
+	}
+	doc = h.roomManager.LiveDocument(doc)
+	filename := export.Filename(doc)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "raw":
+		contentType := mime.TypeByExtension(path.Ext(filename))
+		if contentType == "" || !strings.HasPrefix(contentType, "text/") {
+			contentType = "text/plain; charset=utf-8"
+		}
+		setAttachment(w, contentType, filename)
+		io.WriteString(w, doc.Content)
+	case "json":
+		setAttachment(w, "application/json", filename+".json")
+		export.WriteJSON(w, doc)
+	case "html":
+		setAttachment(w, "text/html; charset=utf-8", filename+".html")
+		export.WriteHTML(w, doc)
+	default:
+		http.Error(w, "format must be raw, json or html", http.StatusBadRequest)
+	}
+}
+
+// ExportDocuments streams many documents as one archive. The format query
+// parameter is zip (default) or tar.gz. Documents are picked by exactly one
+// of: ids (comma-separated), folder_id (the folder and everything below it)
+// or workspace_id. Folder exports keep the folder tree as directories.
+func (h *Handlers) ExportDocuments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	switch format {
+	case "":
+		format = "zip"
+	case "zip", "tar.gz":
+	default:
+		http.Error(w, "format must be zip or tar.gz", http.StatusBadRequest)
+		return
+	}
+
+	var ids []string
+	for _, value := range query["ids"] {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	folderID := query.Get("folder_id")
+	workspaceID := query.Get("workspace_id")
+
+	selectors := 0
+	for _, set := range []bool{len(ids) > 0, folderID != "", workspaceID != ""} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		http.Error(w, "exactly one of ids, folder_id or workspace_id is required", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxExportIDs {
+		http.Error(w, fmt.Sprintf("at most %d ids can be exported at once", maxExportIDs), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		name  string
+		write func(archive *export.Archive) error
+	)
+
+	if len(ids) > 0 {
+		name = "documents"
+		write = func(archive *export.Archive) error {
+			return h.exportByID(archive, ids)
+		}
+	} else {
+		store, ok := h.folderStore(w)
+		if !ok {
+			return
+		}
+
+		var (
+			root *db.Folder
+			err  error
+		)
+		if folderID != "" {
+			root, err = store.GetFolder(folderID)
+			if err != nil {
+				writeStoreError(w, err, "Failed to get folder")
+				return
+			}
+			workspaceID = root.WorkspaceID
+			name = root.Name
+		} else {
+			workspace, err := store.GetWorkspace(workspaceID)
+			if err != nil {
+				writeStoreError(w, err, "Failed to get workspace")
+				return
+			}
+			name = workspace.Name
+		}
+
+		folders, err := store.ListFolders(workspaceID)
+		if err != nil {
+			writeStoreError(w, err, "Failed to list folders")
+			return
+		}
+
+		write = func(archive *export.Archive) error {
+			return h.exportFolders(archive, workspaceID, folders, root)
+		}
+	}
+
+	setAttachment(w, export.ContentType(format), name+"."+format)
+
+	archive, err := export.NewArchive(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Headers are already sent, so a failure here can only truncate the archive
+	if err := write(archive); err != nil {
+		log.Printf("export of %s failed: %v", name, err)
+		return
+	}
+	if err := archive.Close(); err != nil {
+		log.Printf("failed to finish export of %s: %v", name, err)
+	}
+}
+
+// exportByID adds the given documents at the root of the archive, skipping
+// ids that don't exist
+func (h *Handlers) exportByID(archive *export.Archive, ids []string) error {
+	for _, id := range ids {
+		doc, err := h.roomManager.Store.GetDocument(id)
+		if err != nil {
+			if errors.Is(err, db.ErrDocumentNotFound) {
+				continue
+			}
+			return err
+		}
+		if err := archive.Add("", h.roomManager.LiveDocument(doc)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportFolders adds every document in a workspace, laid out by folder. If
+// root is set only that folder and its descendants are included, with root
+// as the top directory of the archive.
+func (h *Handlers) exportFolders(archive *export.Archive, workspaceID string, folders []*db.Folder, root *db.Folder) error {
+	rootID, top := "", ""
+	if root != nil {
+		rootID, top = root.ID, root.Name
+	}
+	layout := export.NewLayout(folders, rootID)
+
+	opts := &db.ListOptions{WorkspaceID: workspaceID, Sort: "title", Order: "asc", Limit: db.MaxListLimit}
+	for {
+		page, err := h.roomManager.Store.ListDocuments(opts)
+		if err != nil {
+			return err
+		}
+
+		for _, doc := range page.Documents {
+			dir, ok := layout.Dir(doc.FolderID)
+			if !ok {
+				continue
+			}
+			if err := archive.Add(path.Join(top, dir), h.roomManager.LiveDocument(doc)); err != nil {
+				return err
+			}
+		}
+
+		if page.NextCursor == "" {
+			return nil
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"collab-editor/pkg/db"
+
+	"github.com/gorilla/mux"
+)
+
+// folderStore returns the store's folder support, writing a 501 if it has none
+func (h *Handlers) folderStore(w http.ResponseWriter) (db.FolderStore, bool) {
+	store, ok := h.roomManager.Store.(db.FolderStore)
+	if !ok {
+		http.Error(w, "Folders are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// CreateWorkspace creates a new workspace
+func (h *Handlers) CreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := store.CreateWorkspace(req.Name)
+	if err != nil {
+		writeStoreError(w, err, "Failed to create workspace")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// ListWorkspaces returns all workspaces
+func (h *Handlers) ListWorkspaces(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	workspaces, err := store.ListWorkspaces()
+	if err != nil {
+		writeStoreError(w, err, "Failed to list workspaces")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspaces)
+}
+
+// GetWorkspace retrieves a workspace by ID
+func (h *Handlers) GetWorkspace(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	workspace, err := store.GetWorkspace(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get workspace")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// RenameWorkspace renames a workspace
+func (h *Handlers) RenameWorkspace(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+
+	workspace, err := store.RenameWorkspace(mux.Vars(r)["id"], req.Name)
+	if err != nil {
+		writeStoreError(w, err, "Failed to rename workspace")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workspace)
+}
+
+// DeleteWorkspace deletes a workspace and its folders
+func (h *Handlers) DeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	if err := store.DeleteWorkspace(mux.Vars(r)["id"]); err != nil {
+		writeStoreError(w, err, "Failed to delete workspace")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListFolders returns every folder in a workspace as a flat list
+func (h *Handlers) ListFolders(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	folders, err := store.ListFolders(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to list folders")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folders)
+}
+
+// CreateFolder creates a folder in a workspace, optionally under a parent folder
+func (h *Handlers) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		WorkspaceID string  `json:"workspace_id"`
+		ParentID    *string `json:"parent_id"`
+		Name        string  `json:"name"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.WorkspaceID == "" || strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "workspace_id and name are required", http.StatusBadRequest)
+		return
+	}
+	if req.ParentID != nil && *req.ParentID == "" {
+		req.ParentID = nil
+	}
+
+	folder, err := store.CreateFolder(req.WorkspaceID, req.ParentID, req.Name)
+	if err != nil {
+		writeStoreError(w, err, "Failed to create folder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// GetFolder retrieves a folder by ID
+func (h *Handlers) GetFolder(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	folder, err := store.GetFolder(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get folder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// UpdateFolder renames a folder and/or moves it under another parent.
+// A parent_id of "" moves the folder to the workspace root.
+func (h *Handlers) UpdateFolder(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	var req db.FolderUpdate
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		http.Error(w, "name can't be empty", http.StatusBadRequest)
+		return
+	}
+
+	folder, err := store.UpdateFolder(mux.Vars(r)["id"], &req)
+	if err != nil {
+		writeStoreError(w, err, "Failed to update folder")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// DeleteFolder deletes a folder and its subfolders. Documents inside are unfiled, not deleted.
+func (h *Handlers) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	if err := store.DeleteFolder(mux.Vars(r)["id"]); err != nil {
+		writeStoreError(w, err, "Failed to delete folder")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveDocument files a document in a folder. A null folder_id unfiles it.
+func (h *Handlers) MoveDocument(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.folderStore(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req struct {
+		FolderID *string `json:"folder_id"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.FolderID != nil && *req.FolderID == "" {
+		req.FolderID = nil
+	}
+
+	doc, err := store.MoveDocument(id, req.FolderID)
+	if err != nil {
+		writeStoreError(w, err, "Failed to move document")
+		return
+	}
+
+	h.roomManager.FileDocument(doc)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/format"
+	"collab-editor/pkg/room"
+
+	"github.com/gorilla/mux"
+)
+
+// formatAttempts bounds how often formatting a live room starts over because
+// someone edited the document while the formatter ran
+const formatAttempts = 3
+
+var errFormatRace = errors.New("the document kept changing while it was formatted")
+
+// formatRoom formats a live room's document and applies the result as the
+// few operations that turn the current content into it, so cursors outside
+// the changed text stay put. The operations go to everyone like any other;
+// when client is set they are its own, so its user can undo them.
+func (h *Handlers) formatRoom(ctx context.Context, r *room.Room, client *room.Client) (int, error) {
+	sessionID := sessionOf(client)
+	for attempt := 0; attempt < formatAttempts; attempt++ {
+		before := r.CurrentDocument()
+		formatted, err := h.formatters.Format(ctx, before.Language, before.Content)
+		if err != nil {
+			return 0, err
+		}
+
+		raced := false
+		operations := r.Edit(func(doc db.Document) []*room.Operation {
+			if doc.Content != before.Content || doc.Language != before.Language {
+				raced = true
+				return nil
+			}
+			return room.EditOperations(before.Content, formatted, sessionID, "format")
+		}, "", nil)
+		if !raced {
+			return len(operations), nil
+		}
+	}
+	return 0, errFormatRace
+}
+
+// handleFormat formats the client's document for everyone in the room and
+// tells the client how it went
+func (h *Handlers) handleFormat(client *room.Client, msg map[string]interface{}) {
+	r := client.Room
+	seq, _ := msg["seq"].(float64)
+	result := room.FormatResult{
+		Type:     "format_result",
+		Seq:      uint64(seq),
+		Language: r.CurrentDocument().Language,
+	}
+
+	n, err := h.formatRoom(context.Background(), r, client)
+	if err != nil {
+		log.Printf("format on %s: %v", r.ID, err)
+		result.Error = formatErrorMessage(err)
+	}
+	result.Changed = n > 0
+	result.Operations = n
+	result.Timestamp = time.Now().UnixNano()
+	r.SendFormatResult(client, result)
+}
+
+// formatErrorMessage returns what to tell a client about a failed format
+func formatErrorMessage(err error) string {
+	var formatErr *format.Error
+	switch {
+	case errors.As(err, &formatErr), errors.Is(err, format.ErrUnsupported), errors.Is(err, errFormatRace):
+		return err.Error()
+	default:
+		return "the formatter failed"
+	}
+}
+
+// FormatDocument formats a document with the formatter for its language. A
+// live room gets the result as operations, like a client's format command;
+// otherwise the stored content is replaced. The response says whether
+// anything changed and carries the document.
+func (h *Handlers) FormatDocument(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var (
+		doc        *db.Document
+		operations int
+		changed    bool
+		err        error
+	)
+	if liveRoom, ok := h.roomManager.GetRoom(id); ok {
+		operations, err = h.formatRoom(r.Context(), liveRoom, nil)
+		current := liveRoom.CurrentDocument()
+		doc, changed = &current, operations > 0
+	} else {
+		doc, changed, err = h.formatStoredDocument(r.Context(), id)
+	}
+	if err != nil {
+		writeFormatError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"changed":    changed,
+		"operations": operations,
+		"document":   doc,
+	})
+}
+
+// formatStoredDocument formats a document no room has open, replacing its
+// stored content if the formatter changed it
+func (h *Handlers) formatStoredDocument(ctx context.Context, id string) (*db.Document, bool, error) {
+	doc, err := h.roomManager.Store.GetDocument(id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	formatted, err := h.formatters.Format(ctx, doc.Language, doc.Content)
+	if err != nil || formatted == doc.Content {
+		return doc, false, err
+	}
+
+	before := doc.Content
+	doc, err = h.roomManager.Store.UpdateDocument(id, &db.DocumentUpdate{
+		Content:         &formatted,
+		ExpectedVersion: &doc.Version,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	h.roomManager.MoveCommentAnchors(id, before, doc.Content)
+	h.roomManager.Emit(room.EventDocumentUpdated, doc, nil)
+	return doc, true, nil
+}
+
+// writeFormatError maps a source the formatter rejected, or a language
+// without one, to 422, a document that kept changing to 409 and everything
+// else through writeStoreError
+func writeFormatError(w http.ResponseWriter, err error) {
+	var formatErr *format.Error
+	switch {
+	case errors.As(err, &formatErr), errors.Is(err, format.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, errFormatRace):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("failed to format document: %v", err)
+		writeStoreError(w, err, "Failed to format document")
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/gitsync"
+
+	"github.com/gorilla/mux"
+)
+
+// syncer returns the git syncer, writing a 501 if git sync isn't configured
+func (h *Handlers) syncer(w http.ResponseWriter) (*gitsync.Syncer, bool) {
+	if h.gitSyncer == nil {
+		http.Error(w, "Git sync is not configured", http.StatusNotImplemented)
+		return nil, false
+	}
+	return h.gitSyncer, true
+}
+
+// writeGitError maps a git sync error to an HTTP response
+func writeGitError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, gitsync.ErrInvalidBinding):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, gitsync.ErrNoSuchCommit):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	default:
+		log.Printf("%s: %v", message, err)
+		writeStoreError(w, err, message)
+	}
+}
+
+// CreateGitBinding binds a document or folder to a path in a repository
+func (h *Handlers) CreateGitBinding(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	var req db.GitBinding
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := syncer.CreateBinding(&db.GitBinding{
+		RepoPath:        req.RepoPath,
+		Path:            req.Path,
+		Branch:          req.Branch,
+		DocumentID:      req.DocumentID,
+		FolderID:        req.FolderID,
+		IntervalSeconds: req.IntervalSeconds,
+	})
+	if err != nil {
+		writeGitError(w, err, "Failed to create git binding")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(binding)
+}
+
+// ListGitBindings returns every git binding
+func (h *Handlers) ListGitBindings(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	bindings, err := syncer.Bindings().ListGitBindings()
+	if err != nil {
+		writeStoreError(w, err, "Failed to list git bindings")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bindings)
+}
+
+// GetGitBinding retrieves a git binding by ID
+func (h *Handlers) GetGitBinding(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	binding, err := syncer.Bindings().GetGitBinding(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get git binding")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(binding)
+}
+
+// DeleteGitBinding removes a git binding. The repository is left untouched.
+func (h *Handlers) DeleteGitBinding(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	if err := syncer.Bindings().DeleteGitBinding(mux.Vars(r)["id"]); err != nil {
+		writeStoreError(w, err, "Failed to delete git binding")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CommitGitBinding commits a snapshot of a binding's documents. The body may
+// carry a commit message; it's optional.
+func (h *Handlers) CommitGitBinding(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := syncer.Bindings().GetGitBinding(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get git binding")
+		return
+	}
+
+	result, err := syncer.Commit(binding, req.Message)
+	if err != nil {
+		writeGitError(w, err, "Failed to commit")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ImportGitBinding loads a binding's documents from a commit. The body may
+// name the commit (hash, branch or tag); it defaults to the binding's branch.
+func (h *Handlers) ImportGitBinding(w http.ResponseWriter, r *http.Request) {
+	syncer, ok := h.syncer(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Commit string `json:"commit"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	binding, err := syncer.Bindings().GetGitBinding(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get git binding")
+		return
+	}
+
+	result, err := syncer.Import(binding, req.Commit)
+	if err != nil {
+		writeGitError(w, err, "Failed to import from git")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -2,13 +2,21 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 
 	"collab-editor/pkg/db"
+	"collab-editor/pkg/format"
+	"collab-editor/pkg/gitsync"
+	"collab-editor/pkg/identity"
+	"collab-editor/pkg/notify"
 	"collab-editor/pkg/room"
+	"collab-editor/pkg/webhook"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
@@ -18,12 +26,23 @@ import (
 // Handlers contains all HTTP and WebSocket handlers
 type Handlers struct {
 	roomManager *room.RoomManager
+	gitSyncer   *gitsync.Syncer     // nil when git sync isn't configured
+	webhooks    *webhook.Dispatcher // nil when the store can't keep webhooks
+	identities  *identity.Issuer
+	formatters  *format.Registry
+	// notifications reaches users outside the rooms they have open
+	notifications *notify.Hub
 }
 
 // NewHandlers creates a new handlers instance
-func NewHandlers(roomManager *room.RoomManager) *Handlers {
+func NewHandlers(roomManager *room.RoomManager, gitSyncer *gitsync.Syncer, webhooks *webhook.Dispatcher, identities *identity.Issuer, formatters *format.Registry) *Handlers {
 	return &Handlers{
-		roomManager: roomManager,
+		roomManager:   roomManager,
+		gitSyncer:     gitSyncer,
+		webhooks:      webhooks,
+		identities:    identities,
+		formatters:    formatters,
+		notifications: notify.NewHub(),
 	}
 }
 
@@ -45,16 +64,11 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r) //this is lowkey goated
 	roomID := vars["roomId"]
 
-	var clientId, username string
-
-	// if proto := r.Header.Get("Sec-WebSocket-Protocol"); proto != "" {
-	// 	// header may contain comma-separated protocols; take first
-	// 	id := strings.Split(proto, ",")[0]
-	// 	userID = id
-	// 	uname := strings.Split(proto, ",")[1]
-	// 	username = uname
-
-	// }
+	// A client keeps its id by presenting the token it was issued last time
+	query := r.URL.Query()
+	clientId, token := h.identify(query.Get("token"))
+	username := query.Get("username")
+	h.rememberUser(clientId, username)
 
 	// Get or create room
 	roomInstance, err := h.roomManager.GetOrCreateRoom(roomID)
@@ -69,6 +83,7 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		ID:       uuid.New().String(),
 		ClientID: clientId,
 		Username: username,
+		Token:    token,
 		Conn:     conn,
 		Room:     roomInstance,
 		Send:     make(chan []byte, 256),
@@ -79,8 +94,36 @@ func (h *Handlers) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 	go h.readPump(client)
 
 	// Register client with room
-	roomInstance.Register <- client
+	if !roomInstance.Join(client) {
+		// The document was deleted meanwhile
+		close(client.Send)
+	}
+
+}
+
+// identify returns the id a connection's token was issued for, with the
+// token, or a new identity when the token is missing or invalid
+func (h *Handlers) identify(token string) (string, string) {
+	if token != "" {
+		if id, ok := h.identities.Verify(token); ok {
+			return id, token
+		}
+		log.Printf("Ignoring invalid identity token")
+	}
+	return h.identities.Issue()
+}
 
+// reidentify returns the identity a client asked to switch to in an init
+// message, or the one it already has
+func (h *Handlers) reidentify(client *room.Client, token string) (string, string) {
+	if token == "" || token == client.Token {
+		return client.ClientID, client.Token
+	}
+	if id, ok := h.identities.Verify(token); ok {
+		return id, token
+	}
+	log.Printf("Ignoring invalid identity token from %s", client.ID)
+	return client.ClientID, client.Token
 }
 
 // readPump handles reading messages from the WebSocket
@@ -91,17 +134,15 @@ func (h *Handlers) readPump(c *room.Client) {
 			log.Printf("panic in readPump for %s: %v\n%s", c.ID, r, debug.Stack())
 		}
 		// signal the room to unregister this client (non-blocking attempt)
-		select {
-		case c.Room.Unregister <- c:
-		default:
-		}
+		c.Leave()
 		// close connection only here — do NOT close c.Send here
 		log.Println("readPump closing for", c.ID)
 		c.Conn.Close()
 		log.Println("readPump exiting for", c.ID)
 	}()
 
-	c.Conn.SetReadLimit(512)
+	// Snapshots and reconcile requests carry the whole document
+	c.Conn.SetReadLimit(1 << 20)
 	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.Conn.SetPongHandler(func(string) error {
 		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -153,7 +194,27 @@ func (h *Handlers) readPump(c *room.Client) {
 			h.handleSnapshot(c, snapshot)
 		case "presence_user":
 			log.Printf("received presence update")
-			h.handlePresence(c, msg)
+			var presence room.Presence
+			if err := json.Unmarshal(message, &presence); err != nil {
+				log.Printf("error parsing presence: %v", err)
+				continue
+			}
+			h.handlePresence(c, &presence)
+		case "undo", "redo":
+			h.handleUndo(c, msg["type"] == "redo")
+		case "format":
+			h.handleFormat(c, msg)
+		case "chat":
+			h.handleChat(c, msg)
+		case "comment_create", "comment_reply", "comment_resolve", "comment_delete":
+			h.handleCommentMessage(c, msg)
+		case "reconcile":
+			var request reconcileRequest
+			if err := json.Unmarshal(message, &request); err != nil {
+				log.Printf("error parsing reconcile: %v", err)
+				continue
+			}
+			h.handleReconcile(c, &request)
 		default:
 			log.Printf("Unknown message type from %s: %v", c.ID, msg["type"])
 		}
@@ -167,10 +228,7 @@ func (h *Handlers) writePump(c *room.Client) {
 	defer func() {
 		ticker.Stop()
 		// Ensure the client is unregistered and that the connection is closed
-		select {
-		case c.Room.Unregister <- c:
-		default:
-		}
+		c.Leave()
 		log.Println("writePump closing for", c.ID)
 		c.Conn.Close()
 		log.Println("Exiting writePump for", c.ID)
@@ -190,10 +248,7 @@ func (h *Handlers) writePump(c *room.Client) {
 			if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
 				log.Printf("WebSocket write error for %s: %v", c.ID, err)
 				// signal the room to unregister this client (non-blocking)
-				select {
-				case c.Room.Unregister <- c:
-				default:
-				}
+				c.Leave()
 				return
 			}
 
@@ -201,10 +256,7 @@ func (h *Handlers) writePump(c *room.Client) {
 			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				log.Printf("Ping error for %s: %v", c.ID, err)
-				select {
-				case c.Room.Unregister <- c:
-				default:
-				}
+				c.Leave()
 				return
 			}
 		}
@@ -213,47 +265,78 @@ func (h *Handlers) writePump(c *room.Client) {
 
 // handleOperation processes text operations from clients
 func (h *Handlers) handleOperation(client *room.Client, msg map[string]interface{}) {
-	operationData, ok := msg["operation"].(map[string]interface{})
+	operation, ok := parseOperation(client, msg)
 	if !ok {
 		log.Printf("Invalid operation format")
 		return
 	}
 
-	operation := &room.Operation{
-		Type:      operationData["type"].(string),
-		Position:  int(operationData["position"].(float64)),
-		Content:   operationData["content"].(string),
-		Length:    int(operationData["length"].(float64)),
-		ClientID:  client.ID,
-		Timestamp: time.Now().UnixNano(),
-	}
-
-	// Broadcast operation to other clients
-	client.Room.BroadcastOperation(operation, client.ID)
+	// Apply it and send it to the other clients
+	client.Room.ApplyOperations([]*room.Operation{operation}, client.ID)
+}
 
-	// Update document content (simplified - in production, use operational transformation)
-	h.updateDocumentContent(client.Room, operation)
+// handleUndo undoes the client's user's latest edit, or redoes their latest
+// undo. The resulting operations go to everyone, the client included, and
+// the client is told how many steps it can still undo and redo.
+func (h *Handlers) handleUndo(client *room.Client, redo bool) {
+	operations := client.Room.Undo(client, redo)
+
+	undo, redoable := client.Room.UndoDepth(client)
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "undo_state",
+		"applied": len(operations),
+		"undo":    undo,
+		"redo":    redoable,
+	})
+	select {
+	case client.Send <- data:
+	default:
+		// drop on slow client
+	}
 }
 
-func (h *Handlers) handleInit(client *room.Client, msg map[string]interface{}) {
-	id, ok1 := msg["id"].(string)
-	username, ok2 := msg["username"].(string)
+// parseOperation reads the "operation" object of a client message
+func parseOperation(client *room.Client, msg map[string]interface{}) (*room.Operation, bool) {
+	operationData, ok := msg["operation"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
 
-	if !ok1 || !ok2 {
-		log.Printf("Invalid init format")
+	opType, okt := operationData["type"].(string)
+	position, okp := operationData["position"].(float64)
+	content, _ := operationData["content"].(string)
+	length, _ := operationData["length"].(float64)
+	if !okt || !okp {
+		return nil, false
 	}
 
-	client.ClientID = id
-	client.Username = username
+	return &room.Operation{
+		Type:      opType,
+		Position:  int(position),
+		Content:   content,
+		Length:    int(length),
+		ClientID:  client.ID,
+		Timestamp: time.Now().UnixNano(),
+	}, true
+}
+
+// handleInit sets a client's display name and, given a valid token, switches
+// it to the identity the token was issued for. Clients can't pick their id.
+func (h *Handlers) handleInit(client *room.Client, msg map[string]interface{}) {
+	username, _ := msg["username"].(string)
+	requested, _ := msg["token"].(string)
 
-	initok := &room.User{
-		ID:       id,
-		Username: username,
+	id, token := h.reidentify(client, requested)
+	h.rememberUser(id, username)
+	if username == "" {
+		username = client.Username
 	}
 
-	client.Room.BroadcastUserConnected(initok)
+	client.Room.Identify(client, id, token, username)
 }
 
+// handleDocUpdate saves a client's title and language change, guarded by
+// the version it was based on, and tells everyone
 func (h *Handlers) handleDocUpdate(client *room.Client, msg map[string]interface{}) {
 	title, okt := msg["title"].(string)
 	language, okl := msg["language"].(string)
@@ -262,21 +345,29 @@ func (h *Handlers) handleDocUpdate(client *room.Client, msg map[string]interface
 		log.Printf("Invalid update format")
 		return
 	}
+	version, _ := msg["version"].(float64)
+	seq, _ := msg["seq"].(float64)
 
 	update := &room.MetadataUpdate{
 		Type:      "document_update",
 		Title:     title,
 		Language:  language,
+		Version:   int(version),
 		ClientID:  client.ID,
 		Timestamp: time.Now().UnixNano(),
 	}
 
-	client.Room.Document.Title = title
-	client.Room.Document.Language = language
-
-	client.Room.BroadcastMetadataUpdate(update, client.ID)
+	if err := h.updateDocumentMetadata(client.Room, client, update); err != nil {
+		return
+	}
 
-	h.updateDocumentMetadata(client.Room, update)
+	client.Room.SendAck(client, room.Ack{
+		Type:      "ack",
+		Event:     "document_update",
+		Version:   update.Version,
+		Seq:       uint64(seq),
+		Timestamp: time.Now().UnixNano(),
+	}, client.ID)
 }
 
 func (h *Handlers) handleSnapshot(client *room.Client, msg room.Snapshot) {
@@ -293,140 +384,316 @@ func (h *Handlers) handleSnapshot(client *room.Client, msg room.Snapshot) {
 	snapshot := &room.Snapshot{
 		Type:      "snapshot",
 		Content:   msg.Content,
+		Version:   msg.Version,
 		ClientID:  client.ClientID,
 		Users:     users,
 		Timestamp: time.Now().UnixNano(),
 	}
 
-	client.Room.Document.Content = msg.Content
-
-	h.updateDocumentSnapshot(client.Room, snapshot)
-
-	client.Room.BroadcastSnapshotUpdate(snapshot, client.ID)
+	if err := h.updateDocumentSnapshot(client.Room, client, snapshot); err != nil {
+		return
+	}
 
 	client.Room.SendAck(client, room.Ack{
 		Type:      "ack",
 		Event:     "snapshot",
+		Version:   snapshot.Version,
 		Seq:       msg.Seq,
 		Timestamp: time.Now().UnixNano(),
 	}, client.ID)
 }
 
-func (h *Handlers) handlePresence(client *room.Client, msg map[string]interface{}) {
-	username, oku := msg["username"].(string)
-	color, okc := msg["color"].(string)
-	lineNumber, okl := msg["lineNumber"].(float64)
-	column, okcl := msg["column"].(float64)
-
-	if !oku || !okc || !okl || !okcl {
-		log.Printf("Invalid presence format")
+// handlePresence broadcasts a client's position. Who it is comes from the
+// connection, never from the message.
+func (h *Handlers) handlePresence(client *room.Client, presence *room.Presence) {
+	if err := presence.Normalize(); err != nil {
+		log.Printf("Invalid presence format: %v", err)
 		return
 	}
 
-	presence := &room.Presence{
-		Type:       "presence_user",
-		ClientID:   client.ClientID,
-		Username:   username,
-		Color:      color,
-		LineNumber: lineNumber,
-		Column:     column,
-	}
-
-	client.Room.BroadcastPresence(presence, client.ID) //dont need to persist this
+	presence.Type = "presence_user"
+	presence.ClientID = client.ClientID
+	presence.SessionID = client.ID
+	presence.Username = client.Username
+	presence.Color = client.Color
 
+	client.Room.BroadcastPresence(presence, client.ID)
 }
 
-// updateDocumentContent updates the document content based on the operation
-// This is the ONLY way to update document content in the collaborative editor
-func (h *Handlers) updateDocumentContent(room *room.Room, operation *room.Operation) {
-	// This is a simplified implementation
-	// In production, you would use operational transformation algorithms
-	// to handle concurrent edits properly
-
-	switch operation.Type {
-	case "insert":
-		// Insert text at position
-		content := room.Document.Content
-		if operation.Position >= len(content) {
-			room.Document.Content = content + operation.Content
-		} else {
-			room.Document.Content = content[:operation.Position] + operation.Content + content[operation.Position:]
-		}
-	case "delete":
-		// Delete text at position
-		content := room.Document.Content
-		if operation.Position+operation.Length <= len(content) {
-			room.Document.Content = content[:operation.Position] + content[operation.Position+operation.Length:]
-		}
-	}
-
-	// Update version
-	room.Document.Version++
-
-	// we dont commit this to db, just broadcast it to reduce load
-}
-
-func (h *Handlers) updateDocumentMetadata(room *room.Room, update *room.MetadataUpdate) {
-	room.Document.Version++
+// updateDocumentMetadata saves a title and language change, along with the
+// live content, and applies it to the room, telling everyone but client
+func (h *Handlers) updateDocumentMetadata(r *room.Room, client *room.Client, update *room.MetadataUpdate) error {
+	content := r.CurrentDocument().Content
 	updates := db.DocumentUpdate{
 		Title:    &update.Title,
-		Content:  &room.Document.Content,
+		Content:  &content,
 		Language: &update.Language,
 	}
+	if update.Version > 0 {
+		updates.ExpectedVersion = &update.Version
+	}
 
-	_, err := h.roomManager.Store.UpdateDocument(room.ID, &updates)
+	doc, err := h.persistRoomDocument(r, client, "document_update", &updates)
 	if err != nil {
-		log.Printf("failed to updated doc")
-		return
+		return err
 	}
+	r.ApplyMetadataUpdate(doc, update, sessionOf(client))
+	h.roomManager.SaveCommentAnchors(r)
+	h.roomManager.Emit(room.EventDocumentUpdated, doc, nil)
+	return nil
 }
 
-func (h *Handlers) updateDocumentSnapshot(room *room.Room, snapshot *room.Snapshot) {
-	room.Document.Version++
+// updateDocumentSnapshot saves a snapshot's content and replaces the room's
+// with it, telling everyone but client
+func (h *Handlers) updateDocumentSnapshot(r *room.Room, client *room.Client, snapshot *room.Snapshot) error {
 	updates := db.DocumentUpdate{
 		Content: &snapshot.Content,
 	}
+	if snapshot.Version > 0 {
+		updates.ExpectedVersion = &snapshot.Version
+	}
 
-	_, err := h.roomManager.Store.UpdateDocument(room.ID, &updates)
+	doc, err := h.persistRoomDocument(r, client, "snapshot", &updates)
 	if err != nil {
-		log.Printf("failed to updated doc")
-		return
+		return err
+	}
+	r.ApplySnapshot(doc, snapshot, sessionOf(client))
+	h.roomManager.SaveCommentAnchors(r)
+	h.roomManager.Emit(room.EventDocumentUpdated, doc, nil)
+	return nil
+}
+
+// sessionOf returns a client's session id, or "" for writes that didn't
+// come from a client
+func sessionOf(client *room.Client) string {
+	if client == nil {
+		return ""
+	}
+	return client.ID
+}
+
+// persistRoomDocument writes updates for a room's document, guarded by the
+// version the write was based on: updates.ExpectedVersion when the writer
+// said, otherwise the version the room last persisted, and returns the
+// stored document for the caller to apply to the room. On a version
+// conflict client (if any) is sent a conflict frame, see resolveConflict.
+func (h *Handlers) persistRoomDocument(r *room.Room, client *room.Client, event string, updates *db.DocumentUpdate) (*db.Document, error) {
+	if updates.ExpectedVersion == nil {
+		expected := r.CurrentDocument().Version
+		updates.ExpectedVersion = &expected
+	}
+
+	doc, err := h.roomManager.Store.UpdateDocument(r.ID, updates)
+	if err != nil {
+		var conflict *db.VersionConflictError
+		if errors.As(err, &conflict) {
+			log.Printf("version conflict on %s: %v", r.ID, err)
+			h.resolveConflict(r, client, event, conflict)
+			return nil, err
+		}
+		log.Printf("failed to update doc %s: %v", r.ID, err)
+		return nil, err
+	}
+	return doc, nil
+}
+
+// resolveConflict tells the writer (if any) that its change was rejected.
+// When only the writer was behind, the room already holds the latest
+// document and is left alone. When the stored document moved past the room
+// too, the room is reset to it so every client converges on it; that throws
+// away the room's unsaved edits, which the writer is sent to recover from.
+func (h *Handlers) resolveConflict(r *room.Room, client *room.Client, event string, conflict *db.VersionConflictError) {
+	frame := room.Conflict{
+		Type:            "conflict",
+		Event:           event,
+		ExpectedVersion: conflict.Expected,
+		ActualVersion:   conflict.Actual,
+	}
+
+	if live := r.CurrentDocument(); conflict.Actual == live.Version {
+		frame.Document = &live
+	} else {
+		current, err := h.roomManager.Store.GetDocument(r.ID)
+		if err != nil {
+			log.Printf("failed to reload doc %s after conflict: %v", r.ID, err)
+			return
+		}
+
+		if replaced := r.ApplyExternalChange(current); replaced != current.Content {
+			frame.Discarded = replaced
+		}
+		h.roomManager.SaveCommentAnchors(r)
+		frame.Document = current
+	}
+
+	switch {
+	case client == nil:
+	case client.Project != nil:
+		frame.Timestamp = time.Now().UnixNano()
+		client.Project.SendConflict(client, r.ID, frame)
+	default:
+		frame.Timestamp = time.Now().UnixNano()
+		r.SendConflict(client, frame)
+	}
+}
+
+// writeStoreError maps a document store error to an HTTP response
+func writeStoreError(w http.ResponseWriter, err error, message string) {
+	var conflict *db.VersionConflictError
+	switch {
+	case errors.As(err, &conflict):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":            "version conflict",
+			"expected_version": conflict.Expected,
+			"actual_version":   conflict.Actual,
+		})
+	case errors.Is(err, db.ErrDocumentNotFound):
+		http.Error(w, "Document not found", http.StatusNotFound)
+	case errors.Is(err, db.ErrWorkspaceNotFound), errors.Is(err, db.ErrFolderNotFound), errors.Is(err, db.ErrGitBindingNotFound),
+		errors.Is(err, db.ErrRevisionNotFound), errors.Is(err, db.ErrTagNotFound), errors.Is(err, db.ErrCommentThreadNotFound),
+		errors.Is(err, db.ErrWebhookNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, db.ErrFolderExists), errors.Is(err, db.ErrPathExists), errors.Is(err, db.ErrTagExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, db.ErrInvalidMove):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, message, http.StatusInternalServerError)
 	}
 }
 
 // CreateDocument creates a new document
 func (h *Handlers) CreateDocument(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Title    string `json:"title"`
-		Content  string `json:"content"`
-		Language string `json:"language"`
-	}
+	var req db.NewDocument
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	doc, err := h.roomManager.Store.CreateDocument(req.Title, req.Content, req.Language)
+	doc, err := h.roomManager.Store.CreateDocument(&req)
 	if err != nil {
-		http.Error(w, "Failed to create document", http.StatusInternalServerError)
+		writeStoreError(w, err, "Failed to create document")
 		return
 	}
+	h.roomManager.Emit(room.EventDocumentCreated, doc, nil)
+	h.roomManager.FileDocument(doc)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
 
-// ListDocuments returns a list of documents
+// ListDocuments returns a page of documents. Query parameters:
+// language, title (substring), owner, folder_id, workspace_id,
+// updated_since (RFC 3339), sort (updated_at|created_at|title),
+// order (asc|desc), limit, cursor and view (full|summary). The cursor for
+// the next page is returned in the X-Next-Cursor header.
 func (h *Handlers) ListDocuments(w http.ResponseWriter, r *http.Request) {
-	docs, err := h.roomManager.Store.ListDocuments()
+	query := r.URL.Query()
+
+	opts := &db.ListOptions{
+		Language:    query.Get("language"),
+		Title:       query.Get("title"),
+		Owner:       query.Get("owner"),
+		FolderID:    query.Get("folder_id"),
+		WorkspaceID: query.Get("workspace_id"),
+		Sort:        query.Get("sort"),
+		Order:       query.Get("order"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	if since := query.Get("updated_since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			http.Error(w, "updated_since must be an RFC 3339 timestamp", http.StatusBadRequest)
+			return
+		}
+		opts.UpdatedSince = &t
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+	switch query.Get("view") {
+	case "", "full":
+	case "summary":
+		opts.Summary = true
+	default:
+		http.Error(w, "view must be full or summary", http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.roomManager.Store.ListDocuments(opts)
 	if err != nil {
+		if errors.Is(err, db.ErrInvalidCursor) || errors.Is(err, db.ErrInvalidListOptions) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Failed to list documents", http.StatusInternalServerError)
 		return
 	}
 
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(docs)
+
+	if opts.Summary {
+		summaries := make([]*db.DocumentSummary, len(page.Documents))
+		for i, doc := range page.Documents {
+			summaries[i] = doc.Summary()
+		}
+		json.NewEncoder(w).Encode(summaries)
+		return
+	}
+	json.NewEncoder(w).Encode(page.Documents)
+}
+
+// SearchDocuments runs a full-text search over document titles and content.
+// Query parameters: q (required), language and limit.
+func (h *Handlers) SearchDocuments(w http.ResponseWriter, r *http.Request) {
+	searcher, ok := h.roomManager.Store.(db.DocumentSearcher)
+	if !ok {
+		http.Error(w, "Search is not supported by this storage backend", http.StatusNotImplemented)
+		return
+	}
+
+	query := r.URL.Query()
+	opts := &db.SearchOptions{
+		Query:    strings.TrimSpace(query.Get("q")),
+		Language: query.Get("language"),
+	}
+	if opts.Query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+
+	results, err := searcher.SearchDocuments(opts)
+	if err != nil {
+		log.Printf("search failed: %v", err)
+		http.Error(w, "Failed to search documents", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"query":   opts.Query,
+		"results": results,
+	})
 }
 
 // GetDocument retrieves a document by ID
@@ -436,7 +703,105 @@ func (h *Handlers) GetDocument(w http.ResponseWriter, r *http.Request) {
 
 	doc, err := h.roomManager.Store.GetDocument(id)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		writeStoreError(w, err, "Failed to get document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// UpdateDocument applies a partial title/language update. If the document's
+// room is live the change goes through the room so connected clients get a
+// document_update broadcast.
+func (h *Handlers) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req struct {
+		Title    *string `json:"title"`
+		Language *string `json:"language"`
+		Version  *int    `json:"version"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	liveRoom, ok := h.roomManager.GetRoom(id)
+	if !ok {
+		doc, err := h.roomManager.Store.UpdateDocument(id, &db.DocumentUpdate{
+			Title:           req.Title,
+			Language:        req.Language,
+			ExpectedVersion: req.Version,
+		})
+		if err != nil {
+			writeStoreError(w, err, "Failed to update document")
+			return
+		}
+		h.roomManager.Emit(room.EventDocumentUpdated, doc, nil)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+		return
+	}
+
+	if err := checkRoomVersion(liveRoom, req.Version); err != nil {
+		writeStoreError(w, err, "Failed to update document")
+		return
+	}
+
+	live := liveRoom.CurrentDocument()
+	update := &room.MetadataUpdate{
+		Type:      "document_update",
+		Title:     live.Title,
+		Language:  live.Language,
+		Timestamp: time.Now().UnixNano(),
+	}
+	if req.Version != nil {
+		update.Version = *req.Version
+	}
+	if req.Title != nil {
+		update.Title = *req.Title
+	}
+	if req.Language != nil {
+		update.Language = *req.Language
+	}
+
+	if err := h.updateDocumentMetadata(liveRoom, nil, update); err != nil {
+		writeStoreError(w, err, "Failed to update document")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liveRoom.CurrentDocument())
+}
+
+// ReplaceDocumentContent overwrites a document's content. The request must
+// carry the version it was based on so it can't silently clobber newer edits.
+// If the document's room is live, connected clients get the new snapshot.
+func (h *Handlers) ReplaceDocumentContent(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req struct {
+		Content *string `json:"content"`
+		Version *int    `json:"version"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Content == nil || req.Version == nil {
+		http.Error(w, "content and version are required", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.replaceContent(id, *req.Content, req.Version)
+	if err != nil {
+		writeStoreError(w, err, "Failed to update document")
 		return
 	}
 
@@ -444,20 +809,113 @@ func (h *Handlers) GetDocument(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(doc)
 }
 
+// replaceContent overwrites a document's content. If its room is live the
+// new content is applied there as operations, under the room lock, so edits
+// in flight transform against it rather than being lost, and then saved. A
+// non-nil version guards against overwriting newer edits.
+func (h *Handlers) replaceContent(id, content string, version *int) (*db.Document, error) {
+	liveRoom, ok := h.roomManager.GetRoom(id)
+	if !ok {
+		before, err := h.roomManager.Store.GetDocument(id)
+		if err != nil {
+			return nil, err
+		}
+		if version == nil {
+			// Comment anchors move from the content read above, so it must
+			// be the content replaced
+			version = &before.Version
+		}
+		doc, err := h.roomManager.Store.UpdateDocument(id, &db.DocumentUpdate{
+			Content:         &content,
+			ExpectedVersion: version,
+		})
+		if err != nil {
+			return nil, err
+		}
+		h.roomManager.MoveCommentAnchors(id, before.Content, doc.Content)
+		h.roomManager.Emit(room.EventDocumentUpdated, doc, nil)
+		return doc, nil
+	}
+
+	var stale error
+	var saved db.Document
+	operations := liveRoom.Edit(func(doc db.Document) []*room.Operation {
+		if version != nil && *version != doc.Version {
+			stale = &db.VersionConflictError{ID: id, Expected: *version, Actual: doc.Version}
+			return nil
+		}
+		return room.EditOperations(doc.Content, content, "", "replace")
+	}, "", func(doc db.Document) {
+		saved = doc
+	})
+	if stale != nil {
+		return nil, stale
+	}
+	if len(operations) == 0 {
+		return &saved, nil
+	}
+
+	doc, err := h.roomManager.SaveEdit(liveRoom, saved)
+	var conflict *db.VersionConflictError
+	if errors.As(err, &conflict) {
+		// Saved meanwhile; the new content is live and saves with the room
+		return &saved, nil
+	}
+	return doc, err
+}
+
+// roomSnapshot builds a server-side snapshot of content for a room's users
+func roomSnapshot(r *room.Room, content string) *room.Snapshot {
+	users := r.GetUsers()
+	snapshot := &room.Snapshot{
+		Type:      "snapshot",
+		Content:   content,
+		Users:     make([]room.Client, len(users)),
+		Timestamp: time.Now().UnixNano(),
+	}
+	for i, user := range users {
+		snapshot.Users[i] = room.Client{ClientID: user.ID, Username: user.Username}
+	}
+	return snapshot
+}
+
+// checkRoomVersion rejects a REST write based on a different version than the
+// live room holds. A nil version means the caller didn't ask for a guard.
+func checkRoomVersion(r *room.Room, version *int) error {
+	if current := r.CurrentDocument().Version; version != nil && *version != current {
+		return &db.VersionConflictError{ID: r.ID, Expected: *version, Actual: current}
+	}
+	return nil
+}
+
 // DeleteDocument deletes a document
 func (h *Handlers) DeleteDocument(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	err := h.roomManager.Store.DeleteDocument(id)
-	if err != nil {
-		http.Error(w, "Failed to delete document", http.StatusInternalServerError)
+	if err := h.deleteDocument(id); err != nil {
+		writeStoreError(w, err, "Failed to delete document")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// deleteDocument deletes a document, takes it out of its open project and
+// reports it, as it was, to the event listener
+func (h *Handlers) deleteDocument(id string) error {
+	doc, err := h.roomManager.Store.GetDocument(id)
+	if err != nil {
+		return err
+	}
+	if err := h.roomManager.Store.DeleteDocument(id); err != nil {
+		return err
+	}
+	h.roomManager.RemoveDocument(id)
+	h.roomManager.Emit(room.EventDocumentDeleted, doc, nil)
+	return nil
+}
+
 // GetRoomUsers returns the list of users in a room
 func (h *Handlers) GetRoomUsers(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
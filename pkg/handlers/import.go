@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/importer"
+	"collab-editor/pkg/lang"
+	"collab-editor/pkg/room"
+)
+
+const (
+	// maxImportSize caps the whole multipart request body
+	maxImportSize = 64 << 20
+	// importMemory is how much of an upload is buffered in memory before
+	// spilling to temporary files
+	importMemory = 32 << 20
+)
+
+// ImportDocuments creates documents from uploaded files. The request is
+// multipart with one or more files under "files"; .zip, .tar.gz and .tgz
+// uploads are unpacked. Optional form fields: owner, and workspace_id or
+// folder_id to recreate the upload's directories as folders there.
+// Without a folder target a file's path becomes its title.
+func (h *Handlers) ImportDocuments(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(importMemory); err != nil {
+		http.Error(w, "Expected a multipart form no larger than 64MB", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	uploads := append(r.MultipartForm.File["files"], r.MultipartForm.File["file"]...)
+	if len(uploads) == 0 {
+		http.Error(w, "No files uploaded", http.StatusBadRequest)
+		return
+	}
+
+	var tree *importer.FolderTree
+	workspaceID := r.FormValue("workspace_id")
+	folderID := r.FormValue("folder_id")
+	if workspaceID != "" || folderID != "" {
+		store, ok := h.folderStore(w)
+		if !ok {
+			return
+		}
+
+		var err error
+		tree, err = importer.NewFolderTree(store, workspaceID, folderID)
+		if err != nil {
+			writeStoreError(w, err, "Failed to load folders")
+			return
+		}
+	}
+
+	collector := importer.NewCollector()
+	for _, upload := range uploads {
+		if err := collectUpload(collector, upload); err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, importer.ErrTooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+	}
+
+	owner := r.FormValue("owner")
+	created := make([]*db.DocumentSummary, 0, len(collector.Files))
+
+	for _, file := range collector.Files {
+		newDoc := &db.NewDocument{
+			Title:    file.Path,
+			Content:  file.Content,
+			Language: lang.Detect(file.Path, file.Content),
+			Owner:    owner,
+		}
+
+		if tree != nil {
+			dir, name := path.Split(file.Path)
+			folder, err := tree.Resolve(strings.TrimSuffix(dir, "/"))
+			if err != nil {
+				log.Printf("import: failed to create folder for %s: %v", file.Path, err)
+				collector.Skip(file.Path, "failed to create folder")
+				continue
+			}
+			newDoc.Title = name
+			newDoc.FolderID = folder
+		}
+
+		doc, err := h.roomManager.Store.CreateDocument(newDoc)
+		if err != nil {
+			reason := "failed to create document"
+			if errors.Is(err, db.ErrPathExists) {
+				reason = "already exists"
+			} else {
+				log.Printf("import: failed to create %s: %v", file.Path, err)
+			}
+			collector.Skip(file.Path, reason)
+			continue
+		}
+		h.roomManager.Emit(room.EventDocumentCreated, doc, nil)
+		h.roomManager.FileDocument(doc)
+		created = append(created, doc.Summary())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"documents":    created,
+		"skipped":      collector.Skipped,
+		"more_skipped": collector.MoreSkipped,
+	})
+}
+
+// collectUpload reads one uploaded file, unpacking it if it's an archive
+func collectUpload(collector *importer.Collector, upload *multipart.FileHeader) error {
+	f, err := upload.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch importer.ArchiveFormat(upload.Filename) {
+	case "zip":
+		return collector.AddZip(f, upload.Size)
+	case "tar.gz":
+		return collector.AddTarGz(f)
+	default:
+		return collector.Add(upload.Filename, f)
+	}
+}
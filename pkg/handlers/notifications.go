@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/notify"
+	"collab-editor/pkg/room"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// maxExcerptLength caps the text quoted in a notification, in characters
+const maxExcerptLength = 200
+
+// rememberUser records the name an identity connected with, so later
+// @mentions of that name in documents it took part in reach it even when
+// it's offline
+func (h *Handlers) rememberUser(id, username string) {
+	store, ok := h.roomManager.Store.(db.NotificationStore)
+	if !ok || username == "" {
+		return
+	}
+	if err := store.SaveUser(id, username); err != nil {
+		log.Printf("failed to save user %s: %v", id, err)
+	}
+}
+
+// mentionedUsers resolves the names @mentioned in text to identity ids,
+// only ever of users who are on the document, by the exact name they have
+// there, or have sent chat or comments on it. Names are chosen freely, so a
+// name alone must not reach anyone else's inbox.
+func (h *Handlers) mentionedUsers(documentID, text string) []string {
+	names := notify.Mentions(text)
+	if len(names) == 0 {
+		return nil
+	}
+
+	var ids []string
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	var online []room.User
+	if liveRoom, ok := h.roomManager.GetRoom(documentID); ok {
+		online = liveRoom.Present()
+	}
+	store, _ := h.roomManager.Store.(db.NotificationStore)
+
+	for _, name := range names {
+		for _, user := range online {
+			if strings.EqualFold(user.Username, name) {
+				add(user.ID)
+			}
+		}
+		if store == nil {
+			continue
+		}
+		found, err := store.FindParticipants(documentID, name)
+		if err != nil {
+			log.Printf("failed to look up mentioned user %q: %v", name, err)
+			continue
+		}
+		for _, id := range found {
+			add(id)
+		}
+	}
+	return ids
+}
+
+// notifyMentions notifies everyone @mentioned in text, other than its
+// author, storing the notification when the store keeps them and pushing it
+// to the user's open notification connections
+func (h *Handlers) notifyMentions(documentID, source, sourceID string, author commentAuthor, text string) {
+	store, _ := h.roomManager.Store.(db.NotificationStore)
+
+	for _, userID := range h.mentionedUsers(documentID, text) {
+		if userID == author.ID {
+			continue
+		}
+
+		notification := &db.Notification{
+			UserID:     userID,
+			Kind:       "mention",
+			DocumentID: documentID,
+			Source:     source,
+			SourceID:   sourceID,
+			ActorID:    author.ID,
+			Actor:      author.Name,
+			Excerpt:    notify.Excerpt(text, maxExcerptLength),
+			CreatedAt:  time.Now(),
+		}
+		if store != nil {
+			created, err := store.CreateNotification(notification)
+			if err != nil {
+				log.Printf("failed to store notification for %s: %v", userID, err)
+				continue
+			}
+			notification = created
+		}
+
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":         "notification",
+			"notification": notification,
+		})
+		h.notifications.Publish(userID, data)
+	}
+}
+
+// publishUnread tells a user's open notification connections how many
+// notifications they have left unread, and returns the count
+func (h *Handlers) publishUnread(store db.NotificationStore, userID string) (int, error) {
+	unread, err := store.CountUnreadNotifications(userID)
+	if err != nil {
+		return 0, err
+	}
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":   "unread_count",
+		"unread": unread,
+	})
+	h.notifications.Publish(userID, data)
+	return unread, nil
+}
+
+// authenticate returns the identity a request's token was issued for. The
+// token is read from an "Authorization: Bearer" header or the token query
+// parameter.
+func (h *Handlers) authenticate(r *http.Request) (string, bool) {
+	token := r.URL.Query().Get("token")
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimPrefix(header, "Bearer ")
+	}
+	if token == "" {
+		return "", false
+	}
+	return h.identities.Verify(token)
+}
+
+// notificationStore returns the store's notification support, writing a 501
+// if it has none
+func (h *Handlers) notificationStore(w http.ResponseWriter) (db.NotificationStore, bool) {
+	store, ok := h.roomManager.Store.(db.NotificationStore)
+	if !ok {
+		http.Error(w, "Notifications are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// HandleNotificationsWebSocket handles a user's notification connection. It
+// isn't tied to a room: mentions anywhere are pushed to every connection the
+// user has open.
+func (h *Handlers) HandleNotificationsWebSocket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authenticate(r)
+	if !ok {
+		http.Error(w, "A valid identity token is required", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	client := &room.Client{
+		ID:       uuid.New().String(),
+		ClientID: userID,
+		Conn:     conn,
+		Send:     make(chan []byte, 256),
+	}
+	h.notifications.Subscribe(userID, client.Send)
+
+	go h.writePump(client)
+	go h.notificationReadPump(client)
+
+	if store, ok := h.roomManager.Store.(db.NotificationStore); ok {
+		if _, err := h.publishUnread(store, userID); err != nil {
+			log.Printf("failed to count notifications for %s: %v", userID, err)
+		}
+	}
+}
+
+// notificationReadPump handles reading messages from a notification
+// WebSocket: pings and marking notifications read
+func (h *Handlers) notificationReadPump(c *room.Client) {
+	defer func() {
+		// the hub won't send to c.Send once unsubscribed, so it's safe to close
+		h.notifications.Unsubscribe(c.ClientID, c.Send)
+		close(c.Send)
+		c.Conn.Close()
+	}()
+
+	c.Conn.SetReadLimit(4096)
+	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.Conn.SetPongHandler(func(string) error {
+		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket unexpected close for %s: %v", c.ID, err)
+			}
+			return
+		}
+
+		var msg struct {
+			Type string  `json:"type"`
+			IDs  []int64 `json:"ids"`
+		}
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Error parsing message from %s: %v", c.ID, err)
+			continue
+		}
+
+		switch msg.Type {
+		case "ping":
+			c.Send <- []byte(`{"type":"pong"}`)
+		case "mark_read":
+			store, ok := h.roomManager.Store.(db.NotificationStore)
+			if !ok {
+				continue
+			}
+			if _, err := store.MarkNotificationsRead(c.ClientID, msg.IDs); err != nil {
+				log.Printf("failed to mark notifications read for %s: %v", c.ClientID, err)
+				continue
+			}
+			if _, err := h.publishUnread(store, c.ClientID); err != nil {
+				log.Printf("failed to count notifications for %s: %v", c.ClientID, err)
+			}
+		default:
+			log.Printf("Unknown message type from %s: %v", c.ID, msg.Type)
+		}
+	}
+}
+
+// ListNotifications returns a page of the caller's notifications, newest
+// first, with the unread count. The X-Next-Cursor header holds the cursor
+// for the next, older page.
+func (h *Handlers) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authenticate(r)
+	if !ok {
+		http.Error(w, "A valid identity token is required", http.StatusUnauthorized)
+		return
+	}
+	store, ok := h.notificationStore(w)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	limit := db.DefaultNotificationLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, db.MaxNotificationLimit)
+	}
+	var before int64
+	if raw := query.Get("cursor"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, db.ErrInvalidCursor.Error(), http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+	unreadOnly := false
+	if raw := query.Get("unread"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			http.Error(w, "unread must be true or false", http.StatusBadRequest)
+			return
+		}
+		unreadOnly = b
+	}
+
+	// One extra notification tells whether there is an older page
+	notifications, err := store.ListNotifications(userID, unreadOnly, before, limit+1)
+	if err != nil {
+		writeStoreError(w, err, "Failed to list notifications")
+		return
+	}
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(notifications[limit-1].ID, 10))
+	}
+	unread, err := store.CountUnreadNotifications(userID)
+	if err != nil {
+		writeStoreError(w, err, "Failed to count notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// MarkNotificationsRead marks the caller's notifications with the given ids
+// read, or all of them when no ids are given
+func (h *Handlers) MarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := h.authenticate(r)
+	if !ok {
+		http.Error(w, "A valid identity token is required", http.StatusUnauthorized)
+		return
+	}
+	store, ok := h.notificationStore(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		IDs []int64 `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	marked, err := store.MarkNotificationsRead(userID, req.IDs)
+	if err != nil {
+		writeStoreError(w, err, "Failed to mark notifications read")
+		return
+	}
+	// Other tabs update their badge too
+	unread, err := h.publishUnread(store, userID)
+	if err != nil {
+		writeStoreError(w, err, "Failed to count notifications")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{
+		"marked": marked,
+		"unread": unread,
+	})
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/room"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+// HandleProjectWebSocket handles WebSocket connections to a project: every
+// document in a folder, multiplexed over one connection
+func (h *Handlers) HandleProjectWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade error: %v", err)
+		return
+	}
+
+	projectID := mux.Vars(r)["projectId"]
+
+	project, err := h.roomManager.GetOrCreateProjectRoom(projectID)
+	if err != nil {
+		log.Printf("Error getting project %s: %v", projectID, err)
+		conn.Close()
+		return
+	}
+
+	query := r.URL.Query()
+	clientID, token := h.identify(query.Get("token"))
+	h.rememberUser(clientID, query.Get("username"))
+
+	client := &room.Client{
+		ID:       uuid.New().String(),
+		ClientID: clientID,
+		Username: query.Get("username"),
+		Token:    token,
+		Conn:     conn,
+		Project:  project,
+		Send:     make(chan []byte, 256),
+	}
+
+	go h.writePump(client)
+	go h.projectReadPump(client)
+
+	if !project.Join(client) {
+		// The project closed meanwhile
+		close(client.Send)
+	}
+}
+
+// projectReadPump handles reading messages from a project WebSocket
+func (h *Handlers) projectReadPump(c *room.Client) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic in projectReadPump for %s: %v\n%s", c.ID, r, debug.Stack())
+		}
+		c.Leave()
+		c.Conn.Close()
+	}()
+
+	// Project messages carry whole files on create and snapshot
+	c.Conn.SetReadLimit(1 << 20)
+	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.Conn.SetPongHandler(func(string) error {
+		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		_, message, err := c.Conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket unexpected close for %s: %v", c.ID, err)
+			}
+			break
+		}
+
+		var msg map[string]interface{}
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Error parsing message from %s: %v", c.ID, err)
+			continue
+		}
+
+		fileID, _ := msg["file_id"].(string)
+
+		switch msg["type"] {
+		case "init":
+			h.handleProjectInit(c, msg)
+		case "operation":
+			h.handleProjectOperation(c, fileID, msg)
+		case "presence_user":
+			var presence room.Presence
+			if err := json.Unmarshal(message, &presence); err != nil {
+				log.Printf("error parsing presence: %v", err)
+				continue
+			}
+			h.handleProjectPresence(c, fileID, &presence)
+		case "undo", "redo":
+			h.handleProjectUndo(c, fileID, msg["type"] == "redo")
+		case "snapshot":
+			h.handleProjectSnapshot(c, fileID, msg)
+		case "file_create":
+			h.handleFileCreate(c, msg)
+		case "file_rename":
+			h.handleFileRename(c, fileID, msg)
+		case "file_delete":
+			h.handleFileDelete(c, fileID)
+		case "ping":
+			c.Send <- []byte(`{"type":"pong"}`)
+		default:
+			log.Printf("Unknown project message type from %s: %v", c.ID, msg["type"])
+		}
+	}
+}
+
+// handleProjectInit sets a client's display name and, given a valid token,
+// switches it to the identity the token was issued for
+func (h *Handlers) handleProjectInit(client *room.Client, msg map[string]interface{}) {
+	username, _ := msg["username"].(string)
+	requested, _ := msg["token"].(string)
+
+	id, token := h.reidentify(client, requested)
+	h.rememberUser(id, username)
+	if username == "" {
+		username = client.Username
+	}
+
+	client.Project.Identify(client, id, token, username)
+}
+
+// handleProjectOperation applies an operation through the file's room, so
+// the file's room clients get it too
+func (h *Handlers) handleProjectOperation(client *room.Client, fileID string, msg map[string]interface{}) {
+	operation, ok := parseOperation(client, msg)
+	if !ok {
+		log.Printf("Invalid operation format")
+		return
+	}
+
+	r, ok := h.projectFile(client, fileID)
+	if !ok {
+		return
+	}
+	r.ApplyOperations([]*room.Operation{operation}, client.ID)
+}
+
+// handleProjectUndo undoes or redoes the client's user's latest edit to one
+// file, like handleUndo
+func (h *Handlers) handleProjectUndo(client *room.Client, fileID string, redo bool) {
+	r, ok := h.projectFile(client, fileID)
+	if !ok {
+		return
+	}
+	operations := r.Undo(client, redo)
+
+	undo, redoable := r.UndoDepth(client)
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "undo_state",
+		"file_id": fileID,
+		"applied": len(operations),
+		"undo":    undo,
+		"redo":    redoable,
+	})
+	select {
+	case client.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+func (h *Handlers) handleProjectPresence(client *room.Client, fileID string, presence *room.Presence) {
+	if fileID == "" {
+		log.Printf("Invalid presence format")
+		return
+	}
+	if err := presence.Normalize(); err != nil {
+		log.Printf("Invalid presence format: %v", err)
+		return
+	}
+
+	presence.Type = "presence_user"
+	presence.ClientID = client.ClientID
+	presence.SessionID = client.ID
+	presence.Username = client.Username
+	presence.Color = client.Color
+
+	r, ok := h.projectFile(client, fileID)
+	if !ok {
+		return
+	}
+	r.BroadcastPresence(presence, client.ID)
+}
+
+// handleProjectSnapshot persists a file's full content through its room,
+// guarded by the version the room last saved
+func (h *Handlers) handleProjectSnapshot(client *room.Client, fileID string, msg map[string]interface{}) {
+	content, ok := msg["content"].(string)
+	if !ok {
+		log.Printf("Invalid snapshot format")
+		return
+	}
+	seq, _ := msg["seq"].(float64)
+
+	r, ok := h.projectFile(client, fileID)
+	if !ok {
+		return
+	}
+
+	snapshot := roomSnapshot(r, content)
+	snapshot.ClientID = client.ClientID
+	if err := h.updateDocumentSnapshot(r, client, snapshot); err != nil {
+		return
+	}
+
+	client.Project.SendAck(client, room.Ack{
+		Type:      "ack",
+		Event:     "snapshot",
+		Version:   snapshot.Version,
+		Seq:       uint64(seq),
+		Timestamp: time.Now().UnixNano(),
+	})
+}
+
+// projectFile returns the room of a file in the client's project
+func (h *Handlers) projectFile(client *room.Client, fileID string) (*room.Room, bool) {
+	r, ok := client.Project.File(fileID)
+	if !ok {
+		log.Printf("message for unknown file %s in project %s", fileID, client.Project.ID)
+	}
+	return r, ok
+}
+
+func (h *Handlers) handleFileCreate(client *room.Client, msg map[string]interface{}) {
+	title, _ := msg["title"].(string)
+	language, _ := msg["language"].(string)
+	content, _ := msg["content"].(string)
+	folderID := client.Project.ID
+
+	doc, err := h.roomManager.Store.CreateDocument(&db.NewDocument{
+		Title:    title,
+		Content:  content,
+		Language: language,
+		Owner:    client.Username,
+		FolderID: &folderID,
+	})
+	if err != nil {
+		log.Printf("failed to create file in project %s: %v", client.Project.ID, err)
+		return
+	}
+	h.roomManager.Emit(room.EventDocumentCreated, doc, nil)
+	h.roomManager.FileDocument(doc)
+}
+
+// handleFileRename saves a file's new title through its room, which
+// announces it to the project
+func (h *Handlers) handleFileRename(client *room.Client, fileID string, msg map[string]interface{}) {
+	title, ok := msg["title"].(string)
+	if !ok {
+		log.Printf("Invalid file_rename format")
+		return
+	}
+
+	r, ok := h.projectFile(client, fileID)
+	if !ok {
+		return
+	}
+
+	update := &room.MetadataUpdate{
+		Type:      "document_update",
+		Title:     title,
+		Language:  r.CurrentDocument().Language,
+		ClientID:  client.ID,
+		Timestamp: time.Now().UnixNano(),
+	}
+	h.updateDocumentMetadata(r, client, update)
+}
+
+func (h *Handlers) handleFileDelete(client *room.Client, fileID string) {
+	if _, ok := h.projectFile(client, fileID); !ok {
+		return
+	}
+
+	err := h.deleteDocument(fileID)
+	if errors.Is(err, db.ErrDocumentNotFound) {
+		// Already deleted elsewhere; still drop it from the project
+		h.roomManager.RemoveDocument(fileID)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to delete file %s: %v", fileID, err)
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/diff"
+	"collab-editor/pkg/room"
+)
+
+// reconcileRequest is sent by a client coming back online with edits it made
+// while disconnected. BaseVersion is the stored version the edits started
+// from; the edits are either the resulting content or the operations, in
+// order, that turn the base into it.
+type reconcileRequest struct {
+	Type        string           `json:"type"`
+	BaseVersion *int             `json:"base_version"`
+	Content     *string          `json:"content"`
+	Operations  []room.Operation `json:"operations"`
+	Seq         uint64           `json:"seq"`
+}
+
+// handleReconcile three-way merges a client's offline edits into the live
+// document. Conflicting regions keep the live text so other clients' work is
+// never dropped; the client is sent the conflicts, and the merge with
+// markers, to resolve by hand. The merge is applied as the operations that
+// turn the live content into it, so everyone else's cursors, comments and
+// undo history stay put and edits made meanwhile aren't lost.
+func (h *Handlers) handleReconcile(client *room.Client, req *reconcileRequest) {
+	r := client.Room
+	result := room.ReconcileResult{
+		Type:      "reconcile_result",
+		Seq:       req.Seq,
+		Conflicts: []diff.Conflict{},
+	}
+	// The result is sent under the room lock, with the document as it is
+	// then, so the client gets it before any operation applied after it
+	send := func(doc db.Document) {
+		result.Version = doc.Version
+		result.Content = doc.Content
+		result.Timestamp = time.Now().UnixNano()
+		r.SendReconcileResult(client, result)
+	}
+	fail := func(message string) {
+		result.Error = message
+		r.Edit(func(db.Document) []*room.Operation { return nil }, "", send)
+	}
+
+	if req.BaseVersion == nil || (req.Content == nil && len(req.Operations) == 0) {
+		fail("base_version and content or operations are required")
+		return
+	}
+	result.BaseVersion = *req.BaseVersion
+
+	base, err := h.reconcileBase(r, *req.BaseVersion)
+	if err != nil {
+		log.Printf("reconcile on %s: %v", r.ID, err)
+		fail(fmt.Sprintf("base version %d is not available", *req.BaseVersion))
+		return
+	}
+
+	local := base
+	if req.Content != nil {
+		local = *req.Content
+	} else {
+		for _, op := range req.Operations {
+			local = op.Apply(local)
+		}
+	}
+
+	labels := diff.Labels{
+		Ours:   "yours",
+		Base:   fmt.Sprintf("base (version %d)", *req.BaseVersion),
+		Theirs: "live",
+	}
+	r.Edit(func(doc db.Document) []*room.Operation {
+		merge := diff.Merge3(base, local, doc.Content, labels)
+		result.Clean = merge.Clean
+		result.Conflicts = merge.Conflicts
+		if !merge.Clean {
+			result.Merged = merge.Content
+		}
+		return room.EditOperations(doc.Content, merge.Resolved, client.ID, "reconcile")
+	}, client.ID, send)
+}
+
+// reconcileBase returns the stored content of a document at version, from
+// its history when the store keeps one and otherwise only if version is
+// still the current one
+func (h *Handlers) reconcileBase(r *room.Room, version int) (string, error) {
+	if store, ok := h.roomManager.Store.(db.RevisionStore); ok {
+		revision, err := store.GetRevision(r.ID, version)
+		if err == nil {
+			return revision.Content, nil
+		}
+		if !errors.Is(err, db.ErrRevisionNotFound) {
+			return "", err
+		}
+	}
+
+	doc, err := h.roomManager.Store.GetDocument(r.ID)
+	if err != nil {
+		return "", err
+	}
+	if doc.Version != version {
+		return "", db.ErrRevisionNotFound
+	}
+	return doc.Content, nil
+}
@@ -0,0 +1,361 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/diff"
+	"collab-editor/pkg/room"
+
+	"github.com/gorilla/mux"
+)
+
+// diffContext is the number of unchanged lines around each hunk
+const diffContext = 3
+
+// revisionStore returns the store's history support, writing a 501 if it has none
+func (h *Handlers) revisionStore(w http.ResponseWriter) (db.RevisionStore, bool) {
+	store, ok := h.roomManager.Store.(db.RevisionStore)
+	if !ok {
+		http.Error(w, "Revisions are not supported by this storage backend", http.StatusNotImplemented)
+	}
+	return store, ok
+}
+
+// resolvedRevision is document content picked by a revision reference
+type resolvedRevision struct {
+	Label   string
+	Version int
+	Content string
+}
+
+// resolveRevision looks up a revision reference: a version number, a tag
+// name, "current" for the stored document or "live" for the room's content
+// including unsaved edits
+func (h *Handlers) resolveRevision(store db.RevisionStore, id, ref string) (*resolvedRevision, error) {
+	switch ref {
+	case "live", "current":
+		doc, err := h.roomManager.Store.GetDocument(id)
+		if err != nil {
+			return nil, err
+		}
+		if ref == "live" {
+			doc = h.roomManager.LiveDocument(doc)
+		}
+		return &resolvedRevision{Label: ref, Version: doc.Version, Content: doc.Content}, nil
+	}
+
+	version, err := strconv.Atoi(ref)
+	if err != nil {
+		tag, err := store.GetTag(id, ref)
+		if err != nil {
+			return nil, err
+		}
+		version = tag.Version
+	}
+
+	revision, err := store.GetRevision(id, version)
+	if err != nil {
+		return nil, err
+	}
+	return &resolvedRevision{
+		Label:   fmt.Sprintf("%s (version %d)", ref, version),
+		Version: version,
+		Content: revision.Content,
+	}, nil
+}
+
+// revisionRef reads a revision reference given as a JSON number or string
+func revisionRef(raw json.RawMessage) string {
+	var version int
+	if err := json.Unmarshal(raw, &version); err == nil {
+		return strconv.Itoa(version)
+	}
+	var ref string
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		return strings.TrimSpace(ref)
+	}
+	return ""
+}
+
+// ListRevisions returns a document's stored versions, newest first
+func (h *Handlers) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	revisions, err := store.ListRevisions(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to list revisions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revisions)
+}
+
+// GetRevision returns one stored version of a document, with content
+func (h *Handlers) GetRevision(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	version, err := strconv.Atoi(vars["version"])
+	if err != nil {
+		http.Error(w, "version must be an integer", http.StatusBadRequest)
+		return
+	}
+
+	revision, err := store.GetRevision(vars["id"], version)
+	if err != nil {
+		writeStoreError(w, err, "Failed to get revision")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revision)
+}
+
+// CreateTag names a version of a document. Without a version it tags the
+// current stored version.
+func (h *Handlers) CreateTag(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req struct {
+		Name    string `json:"name"`
+		Version *int   `json:"version"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := strconv.Atoi(req.Name); err == nil || req.Name == "live" || req.Name == "current" {
+		http.Error(w, "name can't be a number, \"live\" or \"current\"", http.StatusBadRequest)
+		return
+	}
+
+	doc, err := h.roomManager.Store.GetDocument(id)
+	if err != nil {
+		writeStoreError(w, err, "Failed to get document")
+		return
+	}
+	if req.Version == nil {
+		req.Version = &doc.Version
+	}
+
+	tag, err := store.CreateTag(id, req.Name, *req.Version)
+	if err != nil {
+		writeStoreError(w, err, "Failed to create tag")
+		return
+	}
+	h.roomManager.Emit(room.EventVersionTagged, doc, tag)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+// ListTags returns a document's named versions
+func (h *Handlers) ListTags(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	tags, err := store.ListTags(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to list tags")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tags)
+}
+
+// DeleteTag removes a named version. The revision itself is kept.
+func (h *Handlers) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	if err := store.DeleteTag(vars["id"], vars["name"]); err != nil {
+		writeStoreError(w, err, "Failed to delete tag")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DiffDocument compares two versions of a document. from is required and to
+// defaults to "live"; both take a version number, tag name, "current" or
+// "live". The response has the unified diff and the line-level diff as
+// hunks, or just the unified diff as text with format=unified.
+func (h *Handlers) DiffDocument(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	fromRef, toRef := query.Get("from"), query.Get("to")
+	if fromRef == "" {
+		http.Error(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	if toRef == "" {
+		toRef = "live"
+	}
+
+	from, err := h.resolveRevision(store, id, fromRef)
+	if err != nil {
+		writeStoreError(w, err, "Failed to load revision")
+		return
+	}
+	to, err := h.resolveRevision(store, id, toRef)
+	if err != nil {
+		writeStoreError(w, err, "Failed to load revision")
+		return
+	}
+
+	lines := diff.Lines(from.Content, to.Content)
+	hunks := diff.Hunks(lines, diffContext)
+	unified := diff.Unified(from.Label, to.Label, hunks)
+
+	switch query.Get("format") {
+	case "unified":
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.Write([]byte(unified))
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"from":         fromRef,
+			"to":           toRef,
+			"from_version": from.Version,
+			"to_version":   to.Version,
+			"stats":        diff.Count(lines),
+			"unified":      unified,
+			"hunks":        hunks,
+		})
+	default:
+		http.Error(w, "format must be json or unified", http.StatusBadRequest)
+	}
+}
+
+// MergeDocument three-way merges content edited offline against the live
+// document. base names the version the edits started from (a version number
+// or tag). With apply set and no conflicts the merge result replaces the
+// live content: a live room gets it as operations, merged against the room's
+// content under the room lock so edits made meanwhile aren't lost, and is
+// then saved.
+func (h *Handlers) MergeDocument(w http.ResponseWriter, r *http.Request) {
+	store, ok := h.revisionStore(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var req struct {
+		Base    json.RawMessage `json:"base"`
+		Content *string         `json:"content"`
+		Apply   bool            `json:"apply"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	baseRef := revisionRef(req.Base)
+	if baseRef == "" || req.Content == nil {
+		http.Error(w, "base and content are required", http.StatusBadRequest)
+		return
+	}
+
+	base, err := h.resolveRevision(store, id, baseRef)
+	if err != nil {
+		writeStoreError(w, err, "Failed to load base revision")
+		return
+	}
+	live, err := h.resolveRevision(store, id, "live")
+	if err != nil {
+		writeStoreError(w, err, "Failed to load document")
+		return
+	}
+
+	labels := diff.Labels{
+		Ours:   "yours",
+		Base:   base.Label,
+		Theirs: "live",
+	}
+	result := diff.Merge3(base.Content, *req.Content, live.Content, labels)
+	version, applied := live.Version, false
+
+	if liveRoom, ok := h.roomManager.GetRoom(id); ok && req.Apply {
+		var saved db.Document
+		operations := liveRoom.Edit(func(doc db.Document) []*room.Operation {
+			result = diff.Merge3(base.Content, *req.Content, doc.Content, labels)
+			if !result.Clean {
+				return nil
+			}
+			return room.EditOperations(doc.Content, result.Content, "", "merge")
+		}, "", func(doc db.Document) {
+			saved = doc
+		})
+		version, applied = saved.Version, len(operations) > 0
+
+		if applied {
+			doc, err := h.roomManager.SaveEdit(liveRoom, saved)
+			var conflict *db.VersionConflictError
+			switch {
+			case errors.As(err, &conflict):
+				// Saved meanwhile; the merge is live and saves with the room
+			case err != nil:
+				writeStoreError(w, err, "Failed to apply merge")
+				return
+			default:
+				version = doc.Version
+			}
+		}
+	} else if req.Apply && result.Clean && result.Content != live.Content {
+		doc, err := h.replaceContent(id, result.Content, &live.Version)
+		if err != nil {
+			writeStoreError(w, err, "Failed to apply merge")
+			return
+		}
+		version, applied = doc.Version, true
+	}
+
+	response := map[string]interface{}{
+		"base_version": base.Version,
+		"version":      version,
+		"content":      result.Content,
+		"clean":        result.Clean,
+		"conflicts":    result.Conflicts,
+		"applied":      applied,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/room"
+
+	"github.com/gorilla/mux"
+)
+
+// streamKeepAlive is how often an idle stream gets a comment line, so
+// proxies don't close it
+const streamKeepAlive = 30 * time.Second
+
+// streamPoll is how often a stream of a document no room has open checks
+// for a room opening or a new stored version
+const streamPoll = 5 * time.Second
+
+// StreamDocument serves a read-only Server-Sent Events feed of a document.
+// The first event is a snapshot of the document; after it comes an event for
+// every operation, metadata update and content replacement the document's
+// room accepts. Each event's data is the same JSON frame WebSocket clients
+// get, and its name is the frame's type. A stream doesn't open the room, so
+// viewers alone never keep a document in memory: until someone opens it the
+// stream follows the stored document, sending a snapshot of every new
+// version, and it switches to the room once one is open.
+func (h *Handlers) StreamDocument(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	var doc db.Document
+	var watcher *room.Watcher
+	liveRoom, live := h.roomManager.GetRoom(id)
+	if live {
+		watcher, doc = liveRoom.Watch()
+	} else {
+		stored, err := h.roomManager.Store.GetDocument(id)
+		if err != nil {
+			writeStoreError(w, err, "Failed to open document")
+			return
+		}
+		doc = *stored
+	}
+	defer func() {
+		if watcher != nil {
+			liveRoom.Unwatch(watcher)
+		}
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Stop nginx and similar proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// A reconnecting client starts over from a fresh snapshot
+	fmt.Fprint(w, "retry: 3000\n")
+	writeEvent(w, "snapshot", streamSnapshot(doc))
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	var updates <-chan []byte
+	var poll <-chan time.Time
+	if watcher != nil {
+		updates = watcher.Send
+	} else {
+		ticker := time.NewTicker(streamPoll)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-updates:
+			if !ok {
+				// Dropped for falling behind, and the client will
+				// reconnect, or the document was deleted
+				log.Printf("stream of %s ended", id)
+				return
+			}
+			var frame struct {
+				Type string `json:"type"`
+			}
+			json.Unmarshal(data, &frame)
+			writeEvent(w, frame.Type, data)
+			flusher.Flush()
+		case <-poll:
+			if liveRoom, live = h.roomManager.GetRoom(id); live {
+				watcher, doc = liveRoom.Watch()
+				updates, poll = watcher.Send, nil
+				writeEvent(w, "snapshot", streamSnapshot(doc))
+				flusher.Flush()
+				continue
+			}
+			stored, err := h.roomManager.Store.GetDocument(id)
+			if errors.Is(err, db.ErrDocumentNotFound) {
+				deleted, _ := json.Marshal(map[string]interface{}{
+					"type": "document_deleted",
+					"id":   id,
+				})
+				writeEvent(w, "document_deleted", deleted)
+				flusher.Flush()
+				return
+			}
+			if err == nil && stored.Version != doc.Version {
+				doc = *stored
+				writeEvent(w, "snapshot", streamSnapshot(doc))
+				flusher.Flush()
+			}
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// streamSnapshot is the snapshot event a stream sends of a document
+func streamSnapshot(doc db.Document) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "snapshot",
+		"id":       doc.ID,
+		"content":  doc.Content,
+		"title":    doc.Title,
+		"language": doc.Language,
+		"version":  doc.Version,
+	})
+	return data
+}
+
+// writeEvent writes one SSE event. data is a JSON frame, which has no
+// newlines, so it fits on a single data line.
+func writeEvent(w http.ResponseWriter, event string, data []byte) {
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+// dispatcher returns the webhook dispatcher, writing a 501 if the store
+// can't keep webhooks
+func (h *Handlers) dispatcher(w http.ResponseWriter) (*webhook.Dispatcher, bool) {
+	if h.webhooks == nil {
+		http.Error(w, "Webhooks are not supported by this storage backend", http.StatusNotImplemented)
+		return nil, false
+	}
+	return h.webhooks, true
+}
+
+// writeWebhookError maps a webhook error to an HTTP response
+func writeWebhookError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, webhook.ErrInvalidWebhook) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("%s: %v", message, err)
+	writeStoreError(w, err, message)
+}
+
+// CreateWebhook registers an endpoint for a document's or a workspace's
+// events. The response is the only one that includes the signing secret.
+func (h *Handlers) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	var req db.Webhook
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	created, err := dispatcher.CreateWebhook(&db.Webhook{
+		URL:         req.URL,
+		Secret:      req.Secret,
+		DocumentID:  req.DocumentID,
+		WorkspaceID: req.WorkspaceID,
+		Events:      req.Events,
+	})
+	if err != nil {
+		writeWebhookError(w, err, "Failed to create webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// ListWebhooks returns every webhook, without secrets
+func (h *Handlers) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	webhooks, err := dispatcher.Webhooks().ListWebhooks()
+	if err != nil {
+		writeStoreError(w, err, "Failed to list webhooks")
+		return
+	}
+	for _, hook := range webhooks {
+		hook.Secret = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(webhooks)
+}
+
+// GetWebhook retrieves a webhook by ID, without its secret
+func (h *Handlers) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	hook, err := dispatcher.Webhooks().GetWebhook(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get webhook")
+		return
+	}
+	hook.Secret = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hook)
+}
+
+// DeleteWebhook removes a webhook and its delivery log
+func (h *Handlers) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	if err := dispatcher.Webhooks().DeleteWebhook(mux.Vars(r)["id"]); err != nil {
+		writeStoreError(w, err, "Failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListWebhookDeliveries returns a page of a webhook's delivery log, newest
+// first. The X-Next-Cursor header holds the cursor for the next, older page.
+func (h *Handlers) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+	query := r.URL.Query()
+
+	limit := db.DefaultDeliveryLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, db.MaxDeliveryLimit)
+	}
+	var before int64
+	if raw := query.Get("cursor"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			http.Error(w, db.ErrInvalidCursor.Error(), http.StatusBadRequest)
+			return
+		}
+		before = n
+	}
+
+	store := dispatcher.Webhooks()
+	if _, err := store.GetWebhook(id); err != nil {
+		writeStoreError(w, err, "Failed to get webhook")
+		return
+	}
+
+	// One extra delivery tells whether there is an older page
+	deliveries, err := store.ListWebhookDeliveries(id, before, limit+1)
+	if err != nil {
+		writeStoreError(w, err, "Failed to list webhook deliveries")
+		return
+	}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		w.Header().Set("X-Next-Cursor", strconv.FormatInt(deliveries[limit-1].ID, 10))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// PingWebhook queues a ping event to a webhook to test its endpoint. The
+// delivery is returned as queued; its outcome shows in the delivery log.
+func (h *Handlers) PingWebhook(w http.ResponseWriter, r *http.Request) {
+	dispatcher, ok := h.dispatcher(w)
+	if !ok {
+		return
+	}
+
+	hook, err := dispatcher.Webhooks().GetWebhook(mux.Vars(r)["id"])
+	if err != nil {
+		writeStoreError(w, err, "Failed to get webhook")
+		return
+	}
+
+	delivery, err := dispatcher.Ping(hook)
+	if err != nil {
+		writeWebhookError(w, err, "Failed to ping webhook")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
@@ -0,0 +1,76 @@
+// Package identity issues the ids collaborators are known by. Every id comes
+// with a signed token the client presents on later connections to keep it,
+// so a client can't claim someone else's id.
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash/fnv"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// palette holds the presence colors ids are mapped onto, picked to stay
+// readable on light and dark editor themes
+var palette = []string{
+	"#e91e63", "#9c27b0", "#673ab7", "#3f51b5", "#2196f3", "#00acc1",
+	"#009688", "#43a047", "#7cb342", "#f9a825", "#fb8c00", "#f4511e",
+	"#6d4c41", "#546e7a", "#d81b60", "#5e35b1",
+}
+
+// Issuer signs and verifies identity tokens
+type Issuer struct {
+	secret []byte
+}
+
+// NewIssuer creates an issuer signing with secret. Without one a random
+// secret is used, so tokens stop verifying when the server restarts.
+func NewIssuer(secret string) *Issuer {
+	if secret != "" {
+		return &Issuer{secret: []byte(secret)}
+	}
+
+	log.Println("IDENTITY_SECRET not set, identities will not survive a restart")
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatalf("Failed to generate identity secret: %v", err)
+	}
+	return &Issuer{secret: random}
+}
+
+// Issue creates a new id and its token
+func (i *Issuer) Issue() (id, token string) {
+	id = uuid.New().String()
+	return id, id + "." + i.sign(id)
+}
+
+// Verify returns the id a token was issued for
+func (i *Issuer) Verify(token string) (string, bool) {
+	id, signature, ok := strings.Cut(token, ".")
+	if !ok || id == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(signature), []byte(i.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func (i *Issuer) sign(id string) string {
+	mac := hmac.New(sha256.New, i.secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Color returns the presence color for an id. The same id always gets the
+// same color.
+func Color(id string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return palette[hash.Sum32()%uint32(len(palette))]
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"strings"
+
+	"collab-editor/pkg/db"
+)
+
+// FolderTree maps directory paths in an import to folders in a workspace,
+// creating the folders that don't exist yet
+type FolderTree struct {
+	store       db.FolderStore
+	workspaceID string
+	root        *string
+	byPath      map[string]*string
+	byName      map[string]string // parent id + "/" + name -> folder id
+}
+
+// NewFolderTree loads a workspace's folders. Imports land under folderID if
+// it's set, otherwise at the workspace root.
+func NewFolderTree(store db.FolderStore, workspaceID, folderID string) (*FolderTree, error) {
+	var root *string
+	if folderID != "" {
+		folder, err := store.GetFolder(folderID)
+		if err != nil {
+			return nil, err
+		}
+		if workspaceID != "" && workspaceID != folder.WorkspaceID {
+			return nil, db.ErrFolderNotFound
+		}
+		workspaceID = folder.WorkspaceID
+		root = &folder.ID
+	}
+
+	folders, err := store.ListFolders(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if folderID == "" {
+		if _, err := store.GetWorkspace(workspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	tree := &FolderTree{
+		store:       store,
+		workspaceID: workspaceID,
+		root:        root,
+		byPath:      map[string]*string{"": root},
+		byName:      make(map[string]string, len(folders)),
+	}
+	for _, f := range folders {
+		tree.byName[folderKey(f.ParentID, f.Name)] = f.ID
+	}
+	return tree, nil
+}
+
+// Resolve returns the folder for a slash-separated directory path below the
+// tree's root, creating missing folders along the way
+func (t *FolderTree) Resolve(dir string) (*string, error) {
+	if id, ok := t.byPath[dir]; ok {
+		return id, nil
+	}
+
+	parentDir, name := "", dir
+	if i := strings.LastIndex(dir, "/"); i >= 0 {
+		parentDir, name = dir[:i], dir[i+1:]
+	}
+
+	parent, err := t.Resolve(parentDir)
+	if err != nil {
+		return nil, err
+	}
+
+	id, ok := t.byName[folderKey(parent, name)]
+	if !ok {
+		folder, err := t.store.CreateFolder(t.workspaceID, parent, name)
+		if err != nil {
+			return nil, err
+		}
+		id = folder.ID
+		t.byName[folderKey(parent, name)] = id
+	}
+
+	t.byPath[dir] = &id
+	return &id, nil
+}
+
+func folderKey(parentID *string, name string) string {
+	if parentID == nil {
+		return "/" + name
+	}
+	return *parentID + "/" + name
+}
@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultMaxFiles caps how many files one import may create
+	DefaultMaxFiles = 1000
+	// DefaultMaxFileSize caps the size of a single imported file
+	DefaultMaxFileSize = 5 << 20
+	// DefaultMaxTotalSize caps the size of all imported files together,
+	// after decompression
+	DefaultMaxTotalSize = 128 << 20
+	// DefaultMaxSkipped caps how many skipped entries are listed
+	DefaultMaxSkipped = 200
+)
+
+// ErrTooLarge is returned once the files read add up to more than
+// MaxTotalSize, so an archive that unpacks to far more than was uploaded is
+// given up on rather than held in memory
+var ErrTooLarge = errors.New("import is too large")
+
+// File is a text file read from an upload, with its slash-separated path
+// relative to the upload's root
+type File struct {
+	Path    string
+	Content string
+}
+
+// Skipped records an uploaded entry that wasn't imported and why
+type Skipped struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// Collector gathers importable files from uploads and archives, skipping
+// binaries, oversized files and editor/VCS clutter. Skipped lists the first
+// MaxSkipped entries skipped; MoreSkipped counts the rest.
+type Collector struct {
+	Files        []File
+	Skipped      []Skipped
+	MoreSkipped  int
+	MaxFiles     int
+	MaxFileSize  int64
+	MaxTotalSize int64
+	MaxSkipped   int
+	total        int64 // bytes in Files
+}
+
+// NewCollector creates a collector with the default limits
+func NewCollector() *Collector {
+	return &Collector{
+		MaxFiles:     DefaultMaxFiles,
+		MaxFileSize:  DefaultMaxFileSize,
+		MaxTotalSize: DefaultMaxTotalSize,
+		MaxSkipped:   DefaultMaxSkipped,
+	}
+}
+
+// ArchiveFormat returns "zip" or "tar.gz" if name looks like an archive, or ""
+func ArchiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	}
+	return ""
+}
+
+// Add reads one plain file. It returns ErrTooLarge if the file would take
+// the total past MaxTotalSize.
+func (c *Collector) Add(name string, r io.Reader) error {
+	name = cleanPath(name)
+	if name == "" {
+		return nil
+	}
+	if reason := ignored(name); reason != "" {
+		c.Skip(name, reason)
+		return nil
+	}
+	if len(c.Files) >= c.MaxFiles {
+		c.Skip(name, fmt.Sprintf("more than %d files", c.MaxFiles))
+		return nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, c.MaxFileSize+1))
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > c.MaxFileSize {
+		c.Skip(name, fmt.Sprintf("larger than %d bytes", c.MaxFileSize))
+		return nil
+	}
+	if bytes.IndexByte(data, 0) >= 0 || !utf8.Valid(data) {
+		c.Skip(name, "not a text file")
+		return nil
+	}
+	if c.total+int64(len(data)) > c.MaxTotalSize {
+		return fmt.Errorf("%w: files add up to more than %d bytes", ErrTooLarge, c.MaxTotalSize)
+	}
+
+	c.total += int64(len(data))
+	c.Files = append(c.Files, File{Path: name, Content: string(data)})
+	return nil
+}
+
+// AddZip reads every file in a zip archive
+func (c *Collector) AddZip(r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		f, err := entry.Open()
+		if err != nil {
+			c.Skip(entry.Name, err.Error())
+			continue
+		}
+		err = c.Add(entry.Name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddTarGz reads every regular file in a gzipped tar archive
+func (c *Collector) AddTarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("failed to open tar.gz archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar.gz archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := c.Add(header.Name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// Skip records an entry that won't be imported and why: in Skipped, or
+// counted in MoreSkipped once Skipped holds MaxSkipped entries. Callers that
+// fail to import a collected file record it here too.
+func (c *Collector) Skip(name, reason string) {
+	if len(c.Skipped) >= c.MaxSkipped {
+		c.MoreSkipped++
+		return
+	}
+	c.Skipped = append(c.Skipped, Skipped{Path: name, Reason: reason})
+}
+
+// ignored returns why a path should be skipped, or "" to import it
+func ignored(name string) string {
+	for _, part := range strings.Split(name, "/") {
+		switch {
+		case part == "__MACOSX", part == ".git", part == "node_modules":
+			return "ignored directory"
+		case part == ".DS_Store", strings.HasPrefix(part, "._"):
+			return "ignored file"
+		}
+	}
+	return ""
+}
+
+// cleanPath turns an archive or upload name into a relative slash path,
+// dropping any attempt to climb out of the root
+func cleanPath(name string) string {
+	p := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	return strings.TrimPrefix(p, "/")
+}
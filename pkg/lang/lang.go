@@ -0,0 +1,155 @@
+package lang
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+)
+
+// extensions maps a document language to its canonical file extension.
+// Languages use the identifiers the editor (Monaco) uses.
+var extensions = map[string]string{
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"csharp":     ".cs",
+	"css":        ".css",
+	"dockerfile": ".dockerfile",
+	"go":         ".go",
+	"html":       ".html",
+	"java":       ".java",
+	"javascript": ".js",
+	"json":       ".json",
+	"kotlin":     ".kt",
+	"lua":        ".lua",
+	"markdown":   ".md",
+	"php":        ".php",
+	"plaintext":  ".txt",
+	"python":     ".py",
+	"ruby":       ".rb",
+	"rust":       ".rs",
+	"scss":       ".scss",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"swift":      ".swift",
+	"toml":       ".toml",
+	"typescript": ".ts",
+	"xml":        ".xml",
+	"yaml":       ".yaml",
+}
+
+// aliases maps extra extensions to languages, on top of the reverse of extensions
+var aliases = map[string]string{
+	".bash": "shell",
+	".cc":   "cpp",
+	".cxx":  "cpp",
+	".h":    "c",
+	".hpp":  "cpp",
+	".htm":  "html",
+	".jsx":  "javascript",
+	".mjs":  "javascript",
+	".text": "plaintext",
+	".tsx":  "typescript",
+	".yml":  "yaml",
+	".zsh":  "shell",
+}
+
+// Extension returns the file extension for a language, or ".txt" if unknown
+func Extension(language string) string {
+	if ext, ok := extensions[strings.ToLower(language)]; ok {
+		return ext
+	}
+	return ".txt"
+}
+
+// FromExtension returns the language for a file name's extension, or "" if unknown
+func FromExtension(name string) string {
+	if strings.EqualFold(filepath.Base(name), "Dockerfile") {
+		return "dockerfile"
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == "" {
+		return ""
+	}
+	if language, ok := aliases[ext]; ok {
+		return language
+	}
+	for language, e := range extensions {
+		if e == ext {
+			return language
+		}
+	}
+	return ""
+}
+
+// Filename returns a file name for a document title, adding the language's
+// extension unless the title already ends with an extension of that language
+func Filename(title, language string) string {
+	name := strings.TrimSpace(title)
+	if name == "" {
+		name = "untitled"
+	}
+	if language != "" && FromExtension(name) == strings.ToLower(language) {
+		return name
+	}
+	if language == "" && filepath.Ext(name) != "" {
+		return name
+	}
+	return name + Extension(language)
+}
+
+// interpreters maps the program named on a shebang line to a language
+var interpreters = map[string]string{
+	"bash":    "shell",
+	"node":    "javascript",
+	"php":     "php",
+	"python":  "python",
+	"python3": "python",
+	"ruby":    "ruby",
+	"sh":      "shell",
+	"zsh":     "shell",
+}
+
+// Detect returns the language of a file, from its name's extension if that's
+// known and otherwise by sniffing the content. It falls back to "plaintext".
+func Detect(name, content string) string {
+	if language := FromExtension(name); language != "" {
+		return language
+	}
+
+	trimmed := strings.TrimSpace(content)
+	firstLine := trimmed
+	if i := strings.IndexByte(trimmed, '\n'); i >= 0 {
+		firstLine = trimmed[:i]
+	}
+
+	switch {
+	case strings.HasPrefix(firstLine, "#!"):
+		fields := strings.Fields(strings.TrimPrefix(firstLine, "#!"))
+		if len(fields) > 0 {
+			program := filepath.Base(fields[0])
+			if program == "env" && len(fields) > 1 {
+				program = fields[1]
+			}
+			if language, ok := interpreters[program]; ok {
+				return language
+			}
+		}
+	case strings.HasPrefix(trimmed, "<?php"):
+		return "php"
+	case strings.HasPrefix(trimmed, "<?xml"):
+		return "xml"
+	case hasPrefixFold(trimmed, "<!DOCTYPE html"), hasPrefixFold(trimmed, "<html"):
+		return "html"
+	case strings.HasPrefix(firstLine, "package ") && strings.Contains(content, "func "):
+		return "go"
+	case (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed)):
+		return "json"
+	}
+
+	return "plaintext"
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
@@ -0,0 +1,61 @@
+// Package notify delivers notifications to users wherever they are
+// connected, independent of the rooms they have open, and finds the
+// @mentions that trigger them.
+package notify
+
+import "sync"
+
+// Hub tracks the notification connections of every online user. A user can
+// have several at once, one per tab or device.
+type Hub struct {
+	subscribers map[string]map[chan []byte]struct{}
+	mutex       sync.RWMutex
+}
+
+// NewHub creates an empty hub
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[string]map[chan []byte]struct{}),
+	}
+}
+
+// Subscribe delivers userID's notifications to send
+func (h *Hub) Subscribe(userID string, send chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan []byte]struct{})
+	}
+	h.subscribers[userID][send] = struct{}{}
+}
+
+// Unsubscribe stops delivering to send. Once it returns the hub won't touch
+// send again, so the caller may close it.
+func (h *Hub) Unsubscribe(userID string, send chan []byte) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	delete(h.subscribers[userID], send)
+	if len(h.subscribers[userID]) == 0 {
+		delete(h.subscribers, userID)
+	}
+}
+
+// Publish sends data to every connection userID has open and returns how
+// many it reached
+func (h *Hub) Publish(userID string, data []byte) int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	delivered := 0
+	for send := range h.subscribers[userID] {
+		select {
+		case send <- data:
+			delivered++
+		default:
+			// drop on slow client
+		}
+	}
+	return delivered
+}
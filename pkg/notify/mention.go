@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"regexp"
+	"strings"
+)
+
+// mentionPattern matches @name where the @ doesn't follow a word character,
+// so email addresses aren't mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\pL\pN][\pL\pN_.-]*)`)
+
+// Mentions returns the distinct names @mentioned in text, in the order they
+// first appear. Punctuation ending a sentence isn't part of the name.
+func Mentions(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(match[1], ".-")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+	}
+	return names
+}
+
+// Excerpt shortens text to at most max characters for a notification,
+// ending it with an ellipsis when cut
+func Excerpt(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:max-1])) + "…"
+}
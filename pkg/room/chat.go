@@ -0,0 +1,58 @@
+package room
+
+import (
+	"encoding/json"
+	"log"
+
+	"collab-editor/pkg/db"
+)
+
+// chatHistoryLimit is how many recent chat messages a room keeps for the
+// snapshot it sends joining clients
+const chatHistoryLimit = 50
+
+// loadChat fills a new room's recent chat from the store, if it keeps chat
+func (rm *RoomManager) loadChat(r *Room) {
+	store, ok := rm.Store.(db.ChatStore)
+	if !ok {
+		return
+	}
+
+	messages, err := store.ListChatMessages(r.ID, 0, chatHistoryLimit)
+	if err != nil {
+		log.Printf("failed to load chat for %s: %v", r.ID, err)
+		return
+	}
+	// Newest first from the store; the room keeps them oldest first
+	for i := len(messages) - 1; i >= 0; i-- {
+		r.chat = append(r.chat, messages[i])
+	}
+}
+
+// BroadcastChat adds a message to the room's recent chat and sends it to
+// every client, project clients included, and to the sender so it learns
+// the stored id. sessionID and seq let the sender match the echo to what it
+// sent.
+func (r *Room) BroadcastChat(message *db.ChatMessage, sessionID string, seq uint64) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":       "chat",
+		"message":    message,
+		"session_id": sessionID,
+		"seq":        seq,
+	})
+
+	r.mutex.Lock()
+	r.chat = append(r.chat, message)
+	if len(r.chat) > chatHistoryLimit {
+		r.chat = append([]*db.ChatMessage(nil), r.chat[len(r.chat)-chatHistoryLimit:]...)
+	}
+	// Sent under the same lock, so clients get messages in history order
+	r.send(data, "")
+	r.mutex.Unlock()
+}
+
+// chatHistory returns the room's recent chat, oldest first. The room lock
+// must be held.
+func (r *Room) chatHistory() []*db.ChatMessage {
+	return append([]*db.ChatMessage{}, r.chat...)
+}
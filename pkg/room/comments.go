@@ -0,0 +1,290 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+
+	"collab-editor/pkg/db"
+)
+
+// ErrInvalidRange is returned for a comment range outside the document
+var ErrInvalidRange = errors.New("start and end must be a range within the document")
+
+// loadComments fills a new room's comment threads from the store, if it
+// keeps comments
+func (rm *RoomManager) loadComments(r *Room) {
+	store, ok := rm.Store.(db.CommentStore)
+	if !ok {
+		return
+	}
+
+	threads, err := store.ListCommentThreads(r.ID)
+	if err != nil {
+		log.Printf("failed to load comments for %s: %v", r.ID, err)
+		return
+	}
+	for _, thread := range threads {
+		r.comments[thread.ID] = thread
+	}
+}
+
+// copyThread copies a thread so callers can't race with the room moving its
+// anchors. Comments are never changed once written, so they're shared.
+func copyThread(thread *db.CommentThread) *db.CommentThread {
+	c := *thread
+	c.Comments = append([]*db.Comment{}, thread.Comments...)
+	return &c
+}
+
+// CommentThreads returns the room's threads in document order, with their
+// anchors as of the live content
+func (r *Room) CommentThreads() []*db.CommentThread {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.commentThreads()
+}
+
+// commentThreads is CommentThreads with the room lock held
+func (r *Room) commentThreads() []*db.CommentThread {
+	threads := make([]*db.CommentThread, 0, len(r.comments))
+	for _, thread := range r.comments {
+		threads = append(threads, copyThread(thread))
+	}
+	sort.Slice(threads, func(i, j int) bool {
+		if threads[i].Start != threads[j].Start {
+			return threads[i].Start < threads[j].Start
+		}
+		return threads[i].CreatedAt.Before(threads[j].CreatedAt)
+	})
+	return threads
+}
+
+// CommentThread returns one of the room's threads with its live anchors
+func (r *Room) CommentThread(id string) (*db.CommentThread, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	thread, ok := r.comments[id]
+	if !ok {
+		return nil, false
+	}
+	return copyThread(thread), true
+}
+
+// PutCommentThread adds a thread to the room, or replaces it keeping the
+// anchors the room has moved since, and broadcasts event with it. It
+// returns the thread as the room now holds it.
+func (r *Room) PutCommentThread(thread *db.CommentThread, event string) *db.CommentThread {
+	thread = copyThread(thread)
+
+	r.mutex.Lock()
+	if existing, ok := r.comments[thread.ID]; ok {
+		thread.Start, thread.End = existing.Start, existing.End
+	}
+	r.comments[thread.ID] = thread
+	thread = copyThread(thread)
+	r.sendComments(map[string]interface{}{
+		"type":   event,
+		"thread": thread,
+	})
+	r.mutex.Unlock()
+
+	return thread
+}
+
+// OpenCommentThread opens a thread on [thread.Start, thread.End) of the
+// live content: it checks the range, quotes the text under it, has create
+// store the thread and adds the stored thread to the room, telling everyone.
+// It all happens under the room lock, so no operation lands between checking
+// the range and the room moving the anchors with every later one.
+func (r *Room) OpenCommentThread(thread *db.CommentThread, create func(*db.CommentThread) (*db.CommentThread, error)) (*db.CommentThread, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	content := r.Document.Content
+	if thread.Start < 0 || thread.End < thread.Start || thread.End > len(content) {
+		return nil, ErrInvalidRange
+	}
+	thread.Quote = content[thread.Start:thread.End]
+
+	created, err := create(thread)
+	if err != nil {
+		return nil, err
+	}
+	r.comments[created.ID] = copyThread(created)
+	r.sendComments(map[string]interface{}{
+		"type":   "comment_thread_created",
+		"thread": created,
+	})
+	return created, nil
+}
+
+// AddComment appends a reply to one of the room's threads and broadcasts it
+func (r *Room) AddComment(comment *db.Comment) {
+	r.mutex.Lock()
+	if thread, ok := r.comments[comment.ThreadID]; ok {
+		updated := copyThread(thread)
+		updated.Comments = append(updated.Comments, comment)
+		updated.UpdatedAt = comment.CreatedAt
+		r.comments[comment.ThreadID] = updated
+	}
+	r.sendComments(map[string]interface{}{
+		"type":    "comment_added",
+		"comment": comment,
+	})
+	r.mutex.Unlock()
+}
+
+// RemoveCommentThread drops a deleted thread from the room and broadcasts it
+func (r *Room) RemoveCommentThread(id string) {
+	r.mutex.Lock()
+	delete(r.comments, id)
+	r.sendComments(map[string]interface{}{
+		"type": "comment_thread_deleted",
+		"id":   id,
+	})
+	r.mutex.Unlock()
+}
+
+// sendComments sends a comment frame to everyone, so it lands in order with
+// the operations moving the anchors. The room lock must be held.
+func (r *Room) sendComments(message map[string]interface{}) {
+	data, _ := json.Marshal(message)
+	r.send(data, "")
+}
+
+// transformComments shifts every thread's anchors through an operation
+// applied to before. Text inserted inside a range widens it; text inserted
+// at its start or end stays outside. Deleting a range collapses it. The room
+// lock must be held.
+func (r *Room) transformComments(operation *Operation, before string) {
+	for _, thread := range r.comments {
+		start, end, moved := transformRange(thread.Start, thread.End, operation, len(before))
+		if moved {
+			thread.Start, thread.End = start, end
+			r.commentsMoved = true
+		}
+	}
+}
+
+// moveComments shifts every thread's anchors through the content being
+// replaced from before to after, as the few edits that turn one into the
+// other, so a thread on text the replacement kept stays on it. The room lock
+// must be held.
+func (r *Room) moveComments(before, after string) {
+	for _, operation := range EditOperations(before, after, "", "") {
+		r.transformComments(operation, before)
+		before = operation.Apply(before)
+	}
+}
+
+// MoveCommentAnchors shifts the stored anchors of a document no room has
+// open through its content being replaced from before to after, the way a
+// room moves its own when it's given new content
+func (rm *RoomManager) MoveCommentAnchors(id, before, after string) {
+	store, ok := rm.Store.(db.CommentStore)
+	if !ok || before == after {
+		return
+	}
+	if _, ok := rm.GetRoom(id); ok {
+		return
+	}
+
+	threads, err := store.ListCommentThreads(id)
+	if err != nil {
+		log.Printf("failed to load comments for %s: %v", id, err)
+		return
+	}
+
+	var anchors []db.CommentAnchor
+	for _, thread := range threads {
+		start, end, content := thread.Start, thread.End, before
+		for _, operation := range EditOperations(before, after, "", "") {
+			start, end, _ = transformRange(start, end, operation, len(content))
+			content = operation.Apply(content)
+		}
+		if start != thread.Start || end != thread.End {
+			anchors = append(anchors, db.CommentAnchor{ThreadID: thread.ID, Start: start, End: end})
+		}
+	}
+	if len(anchors) == 0 {
+		return
+	}
+	if err := store.UpdateCommentAnchors(anchors); err != nil {
+		log.Printf("failed to save comment anchors for %s: %v", id, err)
+	}
+}
+
+// SaveCommentAnchors stores the anchors a room moved since they were last
+// saved, alongside the content they were moved through
+func (rm *RoomManager) SaveCommentAnchors(r *Room) {
+	store, ok := rm.Store.(db.CommentStore)
+	if !ok {
+		return
+	}
+	if err := store.UpdateCommentAnchors(r.TakeCommentAnchors()); err != nil {
+		log.Printf("failed to save comment anchors for %s: %v", r.ID, err)
+	}
+}
+
+// TakeCommentAnchors returns every thread's anchors, clamped to the live
+// content, if any moved since the last call
+func (r *Room) TakeCommentAnchors() []db.CommentAnchor {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.commentsMoved {
+		return nil
+	}
+	r.commentsMoved = false
+
+	length := len(r.Document.Content)
+	anchors := make([]db.CommentAnchor, 0, len(r.comments))
+	for _, thread := range r.comments {
+		thread.Start = min(thread.Start, length)
+		thread.End = min(thread.End, length)
+		anchors = append(anchors, db.CommentAnchor{ThreadID: thread.ID, Start: thread.Start, End: thread.End})
+	}
+	return anchors
+}
+
+// transformRange moves [start, end) through an operation on content of the
+// given length, matching what Operation.Apply does to the text
+func transformRange(start, end int, operation *Operation, length int) (int, int, bool) {
+	switch operation.Type {
+	case "insert":
+		at := min(max(operation.Position, 0), length)
+		n := len(operation.Content)
+		newStart, newEnd := start, end
+		if at <= start {
+			newStart += n
+		}
+		if at < end {
+			newEnd += n
+		}
+		newEnd = max(newEnd, newStart)
+		return newStart, newEnd, newStart != start || newEnd != end
+
+	case "delete":
+		at, n := operation.Position, operation.Length
+		if at < 0 || n <= 0 || at+n > length {
+			// Apply ignores deletes outside the content
+			return start, end, false
+		}
+		shift := func(offset int) int {
+			switch {
+			case offset >= at+n:
+				return offset - n
+			case offset > at:
+				return at
+			}
+			return offset
+		}
+		newStart, newEnd := shift(start), shift(end)
+		return newStart, newEnd, newStart != start || newEnd != end
+	}
+	return start, end, false
+}
@@ -0,0 +1,87 @@
+package room
+
+import (
+	"strings"
+	"testing"
+
+	"collab-editor/pkg/db"
+)
+
+// TestSnapshotMovesComments checks that replacing the whole content keeps
+// threads on the text they were attached to, wherever it moved
+func TestSnapshotMovesComments(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		quote  string
+		after  string
+		want   string // the text the thread ends up on
+	}{
+		{name: "text before it grows", before: "hello world\n", quote: "world", after: "why hello there, world\n", want: "world"},
+		{name: "lines inserted above", before: "a\nb\nTODO\n", quote: "TODO", after: "x\ny\na\nb\nTODO\n", want: "TODO"},
+		{name: "edited inside", before: "one two three\n", quote: "two", after: "one tWo three\n", want: "tWo"},
+		{name: "deleted", before: "keep drop keep\n", quote: "drop", after: "keep  keep\n", want: ""},
+		{name: "unchanged", before: "same\n", quote: "same", after: "same\n", want: "same"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _, _ := testRoom(tt.before)
+			start := strings.Index(tt.before, tt.quote)
+			r.comments["thread"] = &db.CommentThread{ID: "thread", Start: start, End: start + len(tt.quote)}
+
+			r.ApplySnapshot(&db.Document{Content: tt.after}, &Snapshot{Content: tt.after}, "")
+
+			thread, _ := r.CommentThread("thread")
+			if got := tt.after[thread.Start:thread.End]; got != tt.want {
+				t.Errorf("thread is on %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenCommentThread(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		quote      string
+		err        error
+	}{
+		{name: "word", start: 6, end: 11, quote: "world"},
+		{name: "empty range", start: 0, end: 0, quote: ""},
+		{name: "whole content", start: 0, end: 12, quote: "hello world\n"},
+		{name: "past the end", start: 6, end: 13, err: ErrInvalidRange},
+		{name: "backwards", start: 5, end: 4, err: ErrInvalidRange},
+		{name: "negative", start: -1, end: 3, err: ErrInvalidRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, alice, _ := testRoom("hello world\n")
+			stored := false
+			thread, err := r.OpenCommentThread(&db.CommentThread{ID: "thread", Start: tt.start, End: tt.end}, func(thread *db.CommentThread) (*db.CommentThread, error) {
+				stored = true
+				return thread, nil
+			})
+
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if stored {
+					t.Error("stored a thread on an invalid range")
+				}
+				return
+			}
+			if thread.Quote != tt.quote {
+				t.Errorf("quoted %q, want %q", thread.Quote, tt.quote)
+			}
+			if _, ok := r.CommentThread("thread"); !ok {
+				t.Error("thread isn't in the room")
+			}
+			if len(alice.Send) != 1 {
+				t.Errorf("clients got %d frames, want 1", len(alice.Send))
+			}
+		})
+	}
+}
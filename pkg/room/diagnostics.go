@@ -0,0 +1,162 @@
+package room
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"collab-editor/pkg/diagnostics"
+)
+
+const (
+	// diagnosticsDelay is how long a document must go without changes before
+	// it is checked, so a burst of typing is checked once
+	diagnosticsDelay = 500 * time.Millisecond
+	// diagnosticsTimeout bounds one check
+	diagnosticsTimeout = 5 * time.Second
+)
+
+// diagnosticsState is a room's latest diagnostics and its debounce timer
+type diagnosticsState struct {
+	timer   *time.Timer
+	checked uint64 // hash of the language and content last checked
+	current []diagnostics.Diagnostic
+	mutex   sync.Mutex
+	running sync.Mutex // held while a check runs, so checks don't overlap
+}
+
+// SetDiagnostics sets the providers that check the documents of rooms
+// opened from now on. Without it rooms aren't checked.
+func (rm *RoomManager) SetDiagnostics(registry *diagnostics.Registry) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.diagnostics = registry
+}
+
+// scheduleDiagnostics checks the document once it has gone diagnosticsDelay
+// without changes, restarting the wait on every call. Documents in languages
+// no provider checks are left alone, unless diagnostics were sent for the
+// language they had before and need clearing.
+func (r *Room) scheduleDiagnostics() {
+	if r.diagnostics == nil {
+		return
+	}
+
+	r.mutex.RLock()
+	language := r.Document.Language
+	r.mutex.RUnlock()
+
+	s := &r.diagnosed
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !r.diagnostics.Supports(language) && s.current == nil {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		return
+	}
+	if s.timer == nil {
+		s.timer = time.AfterFunc(diagnosticsDelay, r.runDiagnostics)
+		return
+	}
+	s.timer.Reset(diagnosticsDelay)
+}
+
+// runDiagnostics checks the document, unless it is unchanged since the last
+// check, and sends the diagnostics to everyone if they differ from the last
+// ones sent. When the language is no longer checked, the diagnostics sent
+// for the previous one are cleared.
+func (r *Room) runDiagnostics() {
+	s := &r.diagnosed
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	r.mutex.RLock()
+	language, content := r.Document.Language, r.Document.Content
+	r.mutex.RUnlock()
+
+	if !r.diagnostics.Supports(language) {
+		s.mutex.Lock()
+		cleared := s.current != nil
+		s.current, s.checked = nil, 0
+		s.mutex.Unlock()
+		if cleared {
+			r.sendDiagnostics(language, []diagnostics.Diagnostic{})
+		}
+		return
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(language))
+	h.Write([]byte{0})
+	h.Write([]byte(content))
+	key := h.Sum64()
+
+	s.mutex.Lock()
+	unchanged := s.current != nil && s.checked == key
+	s.mutex.Unlock()
+	if unchanged {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagnosticsTimeout)
+	defer cancel()
+	found, err := r.diagnostics.Diagnose(ctx, language, content)
+	if err != nil {
+		log.Printf("diagnostics on %s: %v", r.ID, err)
+	}
+
+	s.mutex.Lock()
+	s.checked = key
+	same := s.current != nil && reflect.DeepEqual(found, s.current)
+	s.current = found
+	s.mutex.Unlock()
+	if same {
+		return
+	}
+	r.sendDiagnostics(language, found)
+}
+
+// sendDiagnostics sends a document's diagnostics to watchers, clients and
+// the document's project
+func (r *Room) sendDiagnostics(language string, found []diagnostics.Diagnostic) {
+	data, _ := json.Marshal(diagnosticsMessage(language, found))
+	r.notifyWatchers(data)
+
+	r.mutex.RLock()
+	for _, client := range r.Clients {
+		select {
+		case client.Send <- data:
+		default:
+			// drop on slow client
+		}
+	}
+	r.relay(data, "")
+	r.mutex.RUnlock()
+}
+
+// currentDiagnostics returns the diagnostics last sent, for a joining
+// client's snapshot, or nil if the document hasn't been checked yet
+func (r *Room) currentDiagnostics() []diagnostics.Diagnostic {
+	s := &r.diagnosed
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.current
+}
+
+// diagnosticsMessage is the frame clients get with a document's diagnostics
+func diagnosticsMessage(language string, found []diagnostics.Diagnostic) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "diagnostics",
+		"language":    language,
+		"diagnostics": found,
+		"timestamp":   time.Now().UnixNano(),
+	}
+}
@@ -0,0 +1,52 @@
+package room
+
+import (
+	"time"
+
+	"collab-editor/pkg/db"
+)
+
+// Document events, named the way webhooks deliver them
+const (
+	EventDocumentCreated = "document.created"
+	EventDocumentUpdated = "document.updated"
+	EventDocumentDeleted = "document.deleted"
+	EventVersionTagged   = "document.version_tagged"
+	EventUserJoined      = "user.joined"
+)
+
+// Event is something that happened to a document. Data carries what the
+// event is about beyond the document: the *db.Tag for version tags and the
+// User for joins.
+type Event struct {
+	Type     string
+	Document *db.Document
+	Data     interface{}
+	Time     time.Time
+}
+
+// Listen sets the function the manager reports document events to. It's
+// called from whichever goroutine caused the event, so it must not block.
+func (rm *RoomManager) Listen(listener func(Event)) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.listener = listener
+}
+
+// Emit reports a document event to the listener, if there is one
+func (rm *RoomManager) Emit(eventType string, doc *db.Document, data interface{}) {
+	rm.mutex.RLock()
+	listener := rm.listener
+	rm.mutex.RUnlock()
+
+	if listener == nil {
+		return
+	}
+	listener(Event{
+		Type:     eventType,
+		Document: doc,
+		Data:     data,
+		Time:     time.Now(),
+	})
+}
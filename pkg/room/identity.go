@@ -0,0 +1,119 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"collab-editor/pkg/identity"
+)
+
+// defaultUsername is shown for clients that didn't give a name
+const defaultUsername = "Anonymous"
+
+// assignIdentity sets a client's id, the color that id always gets, and a
+// display name no other identity among clients is using. The user's other
+// sessions take the same name. Callers hold the lock guarding clients.
+func assignIdentity(clients map[string]*Client, c *Client, id, username string) {
+	c.ClientID = id
+	c.Color = identity.Color(id)
+	c.Username = uniqueName(clients, c, username)
+
+	for _, other := range clients {
+		if other.ClientID == id {
+			other.Username = c.Username
+		}
+	}
+}
+
+// reidentify assigns a client in clients a new identity or name and returns
+// the events to broadcast: when the identity changes, the old user loses a
+// session and the new one gains it, then init_ok confirms the result.
+// Callers hold the lock guarding clients.
+func reidentify(clients map[string]*Client, c *Client, id, token, username string) [][]byte {
+	previous := *c
+	c.Token = token
+	assignIdentity(clients, c, id, username)
+
+	var events [][]byte
+	if previous.ClientID != c.ClientID {
+		events = append(events, leftEvent(clients, &previous), joinedEvent(clients, c))
+	}
+	initOK, _ := json.Marshal(map[string]interface{}{
+		"type":       "init_ok",
+		"id":         c.ClientID,
+		"session_id": c.ID,
+		"username":   c.Username,
+		"color":      c.Color,
+	})
+	return append(events, initOK)
+}
+
+// uniqueName returns name, or name with a " (2)", " (3)"... suffix when a
+// client with another identity already goes by it
+func uniqueName(clients map[string]*Client, self *Client, name string) string {
+	if name == "" {
+		name = defaultUsername
+	}
+
+	taken := make(map[string]bool)
+	for _, c := range clients {
+		if c.ID != self.ID && c.ClientID != self.ClientID {
+			taken[c.Username] = true
+		}
+	}
+	if !taken[name] {
+		return name
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)", name, n)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// sendIdentity tells a client who the server knows it as. The token is only
+// ever sent to the client it belongs to; presenting it on the next
+// connection keeps the same id.
+func sendIdentity(c *Client) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":       "identity",
+		"id":         c.ClientID,
+		"session_id": c.ID,
+		"username":   c.Username,
+		"color":      c.Color,
+		"token":      c.Token,
+	})
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+// Identify switches a client to another identity or display name, as asked
+// for by an init message, and announces it to the room
+func (r *Room) Identify(c *Client, id, token, username string) {
+	r.mutex.Lock()
+	events := reidentify(r.Clients, c, id, token, username)
+	r.mutex.Unlock()
+
+	sendIdentity(c)
+	for _, event := range events {
+		r.Broadcast <- event
+	}
+}
+
+// Identify switches a client to another identity or display name, as asked
+// for by an init message, and announces it to the project
+func (p *ProjectRoom) Identify(c *Client, id, token, username string) {
+	p.mutex.Lock()
+	events := reidentify(p.Clients, c, id, token, username)
+	p.mutex.Unlock()
+
+	sendIdentity(c)
+	for _, event := range events {
+		p.Broadcast <- event
+	}
+}
@@ -0,0 +1,62 @@
+package room
+
+import (
+	"time"
+
+	"collab-editor/pkg/diff"
+)
+
+// Apply returns content with the operation applied. Inserts past the end
+// append; deletes that run past the end are ignored.
+// This is a simplified implementation. In production, you would use
+// operational transformation algorithms to handle concurrent edits properly.
+func (op *Operation) Apply(content string) string {
+	switch op.Type {
+	case "insert":
+		// Insert text at position
+		if op.Position >= len(content) {
+			return content + op.Content
+		}
+		if op.Position < 0 {
+			return op.Content + content
+		}
+		return content[:op.Position] + op.Content + content[op.Position:]
+	case "delete":
+		// Delete text at position
+		if op.Position >= 0 && op.Length >= 0 && op.Position+op.Length <= len(content) {
+			return content[:op.Position] + content[op.Position+op.Length:]
+		}
+	}
+	return content
+}
+
+// EditOperations turns the few edits from before to after into operations
+// by sessionID with the given origin, each applying to the content the ones
+// before it left
+func EditOperations(before, after, sessionID, origin string) []*Operation {
+	now := time.Now().UnixNano()
+	var operations []*Operation
+	for _, edit := range diff.Edits(before, after) {
+		if edit.Delete > 0 {
+			operations = append(operations, &Operation{
+				Type:      "delete",
+				Position:  edit.Position,
+				Length:    edit.Delete,
+				ClientID:  sessionID,
+				Timestamp: now,
+				Origin:    origin,
+			})
+		}
+		if edit.Insert != "" {
+			operations = append(operations, &Operation{
+				Type:      "insert",
+				Position:  edit.Position,
+				Content:   edit.Insert,
+				ClientID:  sessionID,
+				Timestamp: now,
+				Origin:    origin,
+			})
+		}
+	}
+	return operations
+}
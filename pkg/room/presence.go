@@ -0,0 +1,271 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Activity states a client can report in its presence
+const (
+	ActivityViewing = "viewing"
+	ActivityTyping  = "typing"
+	ActivityIdle    = "idle"
+)
+
+// MaxSelections caps how many cursors one client's presence may carry
+const MaxSelections = 64
+
+// presenceInterval is the least time between two presence broadcasts for one
+// client. Updates arriving faster are coalesced into the latest one.
+const presenceInterval = 50 * time.Millisecond
+
+// Position is a 1-based line and column in a document, as editors report
+// them. Columns count in the same units as operation positions.
+type Position struct {
+	LineNumber int `json:"lineNumber"`
+	Column     int `json:"column"`
+}
+
+// Selection is a range between where a selection started (Anchor) and where
+// its cursor is (Head). A plain cursor has Anchor equal to Head.
+type Selection struct {
+	Anchor Position `json:"anchor"`
+	Head   Position `json:"head"`
+}
+
+// Viewport is the range of lines a client has on screen
+type Viewport struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// clientPresence is a client's latest presence and its broadcast throttle
+type clientPresence struct {
+	presence *Presence
+	sentAt   time.Time
+	pending  bool // a delayed broadcast of presence is scheduled
+}
+
+// Normalize checks a presence sent by a client and fills in whichever of the
+// primary cursor (LineNumber/Column) and Selections it left out, so older
+// clients sending only a cursor and newer ones sending only selections are
+// both understood by everyone.
+func (p *Presence) Normalize() error {
+	switch p.Activity {
+	case "", ActivityViewing, ActivityTyping, ActivityIdle:
+	default:
+		return errors.New("activity must be viewing, typing or idle")
+	}
+	if len(p.Selections) > MaxSelections {
+		p.Selections = p.Selections[:MaxSelections]
+	}
+	if p.Viewport != nil && (p.Viewport.StartLine < 1 || p.Viewport.EndLine < p.Viewport.StartLine) {
+		return errors.New("viewport must be a range of lines from 1")
+	}
+
+	for _, selection := range p.Selections {
+		if selection.Anchor.LineNumber < 1 || selection.Anchor.Column < 1 ||
+			selection.Head.LineNumber < 1 || selection.Head.Column < 1 {
+			return errors.New("selection positions start at line 1, column 1")
+		}
+	}
+
+	switch {
+	case len(p.Selections) > 0:
+		p.LineNumber = float64(p.Selections[0].Head.LineNumber)
+		p.Column = float64(p.Selections[0].Head.Column)
+	case p.LineNumber >= 1 && p.Column >= 1:
+		cursor := Position{LineNumber: int(p.LineNumber), Column: int(p.Column)}
+		p.Selections = []Selection{{Anchor: cursor, Head: cursor}}
+	default:
+		return errors.New("presence needs a cursor position or selections")
+	}
+	return nil
+}
+
+// message is the presence_user frame broadcast to other clients
+func (p *Presence) message() map[string]interface{} {
+	message := map[string]interface{}{
+		"type":       "presence_user",
+		"id":         p.ClientID,
+		"session_id": p.SessionID,
+		"username":   p.Username,
+		"color":      p.Color,
+		"lineNumber": p.LineNumber,
+		"column":     p.Column,
+		"selections": p.Selections,
+	}
+	if p.Activity != "" {
+		message["activity"] = p.Activity
+	}
+	if p.Viewport != nil {
+		message["viewport"] = p.Viewport
+	}
+	return message
+}
+
+// Transform moves the presence's cursors through an operation that turned
+// before into after. own says whether the presence belongs to the client
+// that made the operation: its cursor at an insertion point moves past the
+// inserted text, while other clients' cursors there stay put.
+func (p *Presence) Transform(operation *Operation, before, after string, own bool) {
+	for i := range p.Selections {
+		selection := &p.Selections[i]
+		selection.Anchor = transformPosition(selection.Anchor, operation, before, after, own)
+		selection.Head = transformPosition(selection.Head, operation, before, after, own)
+	}
+	if len(p.Selections) > 0 {
+		p.LineNumber = float64(p.Selections[0].Head.LineNumber)
+		p.Column = float64(p.Selections[0].Head.Column)
+	}
+}
+
+func transformPosition(pos Position, operation *Operation, before, after string, own bool) Position {
+	offset := offsetOf(before, pos)
+
+	switch operation.Type {
+	case "insert":
+		at := min(max(operation.Position, 0), len(before))
+		if offset > at || (offset == at && own) {
+			offset += len(operation.Content)
+		}
+	case "delete":
+		if after == before {
+			// Apply ignored an out-of-range delete
+			return pos
+		}
+		end := operation.Position + operation.Length
+		switch {
+		case offset >= end:
+			offset -= operation.Length
+		case offset > operation.Position:
+			offset = operation.Position
+		}
+	}
+
+	return positionOf(after, offset)
+}
+
+// offsetOf converts a position to an offset in content, clamping it to the
+// end of its line and the end of the document
+func offsetOf(content string, pos Position) int {
+	offset := 0
+	for line := 1; line < pos.LineNumber; line++ {
+		next := strings.IndexByte(content[offset:], '\n')
+		if next < 0 {
+			return len(content)
+		}
+		offset += next + 1
+	}
+
+	lineEnd := strings.IndexByte(content[offset:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(content) - offset
+	}
+	return offset + min(pos.Column-1, lineEnd)
+}
+
+// positionOf converts an offset in content to a position
+func positionOf(content string, offset int) Position {
+	offset = min(max(offset, 0), len(content))
+	lineStart := strings.LastIndexByte(content[:offset], '\n') + 1
+	return Position{
+		LineNumber: strings.Count(content[:offset], "\n") + 1,
+		Column:     offset - lineStart + 1,
+	}
+}
+
+// BroadcastPresence records a client's presence and sends it to everyone
+// else, at most once per presenceInterval. Updates inside the interval
+// replace the pending one, which goes out when the interval ends.
+func (r *Room) BroadcastPresence(presence *Presence, excludeClientID string) {
+	r.mutex.Lock()
+	if _, ok := r.member(excludeClientID); !ok {
+		r.mutex.Unlock()
+		return
+	}
+
+	state, ok := r.presence[excludeClientID]
+	if !ok {
+		state = &clientPresence{}
+		r.presence[excludeClientID] = state
+	}
+	state.presence = presence
+
+	if state.pending {
+		r.mutex.Unlock()
+		return
+	}
+	if wait := presenceInterval - time.Since(state.sentAt); wait > 0 {
+		state.pending = true
+		time.AfterFunc(wait, func() {
+			r.flushPresence(excludeClientID)
+		})
+		r.mutex.Unlock()
+		return
+	}
+	state.sentAt = time.Now()
+	r.mutex.Unlock()
+
+	r.sendPresence(excludeClientID)
+}
+
+// flushPresence sends a client's coalesced presence once its interval is up
+func (r *Room) flushPresence(clientID string) {
+	r.mutex.Lock()
+	state, ok := r.presence[clientID]
+	if ok {
+		state.pending = false
+		state.sentAt = time.Now()
+	}
+	r.mutex.Unlock()
+
+	if ok {
+		r.sendPresence(clientID)
+	}
+}
+
+// sendPresence sends a client's stored presence to everyone else
+func (r *Room) sendPresence(clientID string) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	state, ok := r.presence[clientID]
+	if !ok {
+		return
+	}
+	data, _ := json.Marshal(state.presence.message())
+
+	for _, client := range r.Clients {
+		if client.ID != clientID {
+			select {
+			case client.Send <- data:
+			default:
+				// drop on slow client
+			}
+		}
+	}
+	r.relay(data, clientID)
+}
+
+// presenceMessages returns every stored presence as the presence_user frames
+// clients already receive, for a joining client's snapshot. The room lock
+// must be held.
+func (r *Room) presenceMessages() []map[string]interface{} {
+	messages := make([]map[string]interface{}, 0, len(r.presence))
+	for _, state := range r.presence {
+		messages = append(messages, state.presence.message())
+	}
+	return messages
+}
+
+// transformPresence moves every stored cursor through an operation that
+// turned the document from before into after, so they stay on the same text.
+// The room lock must be held.
+func (r *Room) transformPresence(operation *Operation, before, after string) {
+	for clientID, state := range r.presence {
+		state.presence.Transform(operation, before, after, clientID == operation.ClientID)
+	}
+}
@@ -0,0 +1,163 @@
+package room
+
+import "testing"
+
+func TestOffsetOf(t *testing.T) {
+	content := "ab\ncde\n\nf"
+
+	tests := []struct {
+		name    string
+		pos     Position
+		want    int
+		clamped bool // pos isn't in content, so want maps back to another position
+	}{
+		{name: "start", pos: Position{LineNumber: 1, Column: 1}, want: 0},
+		{name: "inside first line", pos: Position{LineNumber: 1, Column: 2}, want: 1},
+		{name: "end of first line", pos: Position{LineNumber: 1, Column: 3}, want: 2},
+		{name: "past end of line", pos: Position{LineNumber: 1, Column: 10}, want: 2, clamped: true},
+		{name: "second line", pos: Position{LineNumber: 2, Column: 2}, want: 4},
+		{name: "empty line", pos: Position{LineNumber: 3, Column: 1}, want: 7},
+		{name: "past end of empty line", pos: Position{LineNumber: 3, Column: 5}, want: 7, clamped: true},
+		{name: "last line", pos: Position{LineNumber: 4, Column: 2}, want: 9},
+		{name: "past last line", pos: Position{LineNumber: 9, Column: 1}, want: 9, clamped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offsetOf(content, tt.pos); got != tt.want {
+				t.Errorf("offsetOf(%+v) = %d, want %d", tt.pos, got, tt.want)
+			}
+			if back := positionOf(content, tt.want); !tt.clamped && back != tt.pos {
+				t.Errorf("positionOf(%d) = %+v, want %+v", tt.want, back, tt.pos)
+			}
+		})
+	}
+}
+
+// TestPresenceTransform checks that cursors and selections stay on the text
+// they were on as operations are applied around them
+func TestPresenceTransform(t *testing.T) {
+	cursor := func(line, column int) []Selection {
+		pos := Position{LineNumber: line, Column: column}
+		return []Selection{{Anchor: pos, Head: pos}}
+	}
+
+	tests := []struct {
+		name       string
+		before     string
+		operation  Operation
+		own        bool
+		selections []Selection
+		want       []Selection
+	}{
+		{
+			name:       "insert before cursor",
+			before:     "hello world",
+			operation:  Operation{Type: "insert", Position: 0, Content: ">> "},
+			selections: cursor(1, 7),
+			want:       cursor(1, 10),
+		},
+		{
+			name:       "insert after cursor",
+			before:     "hello world",
+			operation:  Operation{Type: "insert", Position: 8, Content: "!"},
+			selections: cursor(1, 3),
+			want:       cursor(1, 3),
+		},
+		{
+			name:       "insert at another's cursor",
+			before:     "hello",
+			operation:  Operation{Type: "insert", Position: 2, Content: "XY"},
+			selections: cursor(1, 3),
+			want:       cursor(1, 3),
+		},
+		{
+			name:       "insert at own cursor",
+			before:     "hello",
+			operation:  Operation{Type: "insert", Position: 2, Content: "XY"},
+			own:        true,
+			selections: cursor(1, 3),
+			want:       cursor(1, 5),
+		},
+		{
+			name:       "insert line above",
+			before:     "one\ntwo",
+			operation:  Operation{Type: "insert", Position: 0, Content: "zero\n"},
+			selections: cursor(2, 2),
+			want:       cursor(3, 2),
+		},
+		{
+			name:       "delete before cursor",
+			before:     "hello world",
+			operation:  Operation{Type: "delete", Position: 0, Length: 6},
+			selections: cursor(1, 9),
+			want:       cursor(1, 3),
+		},
+		{
+			name:       "delete around cursor",
+			before:     "hello world",
+			operation:  Operation{Type: "delete", Position: 2, Length: 5},
+			selections: cursor(1, 5),
+			want:       cursor(1, 3),
+		},
+		{
+			name:       "delete joining lines",
+			before:     "one\ntwo",
+			operation:  Operation{Type: "delete", Position: 3, Length: 1},
+			selections: cursor(2, 3),
+			want:       cursor(1, 6),
+		},
+		{
+			name:       "out of range delete",
+			before:     "abc",
+			operation:  Operation{Type: "delete", Position: 10, Length: 2},
+			selections: cursor(1, 2),
+			want:       cursor(1, 2),
+		},
+		{
+			name:      "selection across an insert",
+			before:    "hello world",
+			operation: Operation{Type: "insert", Position: 5, Content: ","},
+			selections: []Selection{{
+				Anchor: Position{LineNumber: 1, Column: 1},
+				Head:   Position{LineNumber: 1, Column: 12},
+			}},
+			want: []Selection{{
+				Anchor: Position{LineNumber: 1, Column: 1},
+				Head:   Position{LineNumber: 1, Column: 13},
+			}},
+		},
+		{
+			name:      "several cursors",
+			before:    "ab\ncd",
+			operation: Operation{Type: "insert", Position: 1, Content: "\n"},
+			selections: []Selection{
+				{Anchor: Position{LineNumber: 1, Column: 1}, Head: Position{LineNumber: 1, Column: 1}},
+				{Anchor: Position{LineNumber: 1, Column: 3}, Head: Position{LineNumber: 2, Column: 2}},
+			},
+			want: []Selection{
+				{Anchor: Position{LineNumber: 1, Column: 1}, Head: Position{LineNumber: 1, Column: 1}},
+				{Anchor: Position{LineNumber: 2, Column: 2}, Head: Position{LineNumber: 3, Column: 2}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Presence{Selections: append([]Selection(nil), tt.selections...)}
+			after := tt.operation.Apply(tt.before)
+
+			p.Transform(&tt.operation, tt.before, after, tt.own)
+
+			for i, want := range tt.want {
+				if got := p.Selections[i]; got != want {
+					t.Errorf("selection %d = %+v, want %+v", i, got, want)
+				}
+			}
+			head := tt.want[0].Head
+			if p.LineNumber != float64(head.LineNumber) || p.Column != float64(head.Column) {
+				t.Errorf("cursor at %v:%v, want the first head %+v", p.LineNumber, p.Column, head)
+			}
+		})
+	}
+}
@@ -0,0 +1,467 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	"collab-editor/pkg/db"
+)
+
+// ProjectRoom is a collaborative session over every document in a folder.
+// Clients share one WebSocket for all files; operations, presence and
+// snapshots carry the file_id they apply to.
+//
+// Each file is the document's own Room, so project clients and clients of
+// the document's room edit one live document: their operations go through
+// the room, which applies them, moves cursors, comments and undo history,
+// and relays every frame it sends to the project's clients with the file_id
+// added. A project's lock is only ever taken after a room's, never before.
+type ProjectRoom struct {
+	ID         string             `json:"id"` // folder id
+	Files      map[string]*Room   `json:"-"`  // by document id
+	Clients    map[string]*Client `json:"clients"`
+	Broadcast  chan []byte        `json:"-"`
+	Register   chan *Client       `json:"-"`
+	Unregister chan *Client       `json:"-"`
+	emit       func(eventType string, doc *db.Document, data interface{})
+	done       chan struct{} // closed once the project is dropped, see close
+	mutex      sync.RWMutex
+}
+
+// GetOrCreateProjectRoom gets an existing project room or opens the rooms
+// of the folder's documents into a new one
+func (rm *RoomManager) GetOrCreateProjectRoom(folderID string) (*ProjectRoom, error) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	project, ok := rm.projects[folderID]
+	if ok {
+		return project, nil
+	}
+
+	folders, ok := rm.Store.(db.FolderStore)
+	if !ok {
+		return nil, fmt.Errorf("projects need a store with folder support")
+	}
+	if _, err := folders.GetFolder(folderID); err != nil {
+		return nil, err
+	}
+
+	project = &ProjectRoom{
+		ID:         folderID,
+		Files:      make(map[string]*Room),
+		Clients:    make(map[string]*Client),
+		Register:   make(chan *Client),
+		Unregister: make(chan *Client),
+		Broadcast:  make(chan []byte, 256),
+		emit:       rm.Emit,
+		done:       make(chan struct{}),
+	}
+
+	opts := &db.ListOptions{FolderID: folderID, Limit: db.MaxListLimit}
+	for {
+		page, err := rm.Store.ListDocuments(opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, doc := range page.Documents {
+			r, ok := rm.rooms[doc.ID]
+			if !ok {
+				r = rm.openRoom(doc)
+			}
+			r.mutex.Lock()
+			r.project = project
+			r.mutex.Unlock()
+			project.Files[doc.ID] = r
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.Cursor = page.NextCursor
+	}
+
+	rm.projects[folderID] = project
+
+	go project.run()
+
+	return project, nil
+}
+
+// FileDocument follows a document just created in, or moved to, the folder
+// doc.FolderID: its room leaves the open project it was in and joins the
+// folder's, opening the room if need be
+func (rm *RoomManager) FileDocument(doc *db.Document) {
+	var project *ProjectRoom
+	if doc.FolderID != nil {
+		project, _ = rm.GetProjectRoom(*doc.FolderID)
+	}
+
+	var current *ProjectRoom
+	liveRoom, ok := rm.GetRoom(doc.ID)
+	if ok {
+		liveRoom.mutex.Lock()
+		liveRoom.Document.FolderID = doc.FolderID
+		current = liveRoom.project
+		liveRoom.mutex.Unlock()
+	}
+	if current == project {
+		return
+	}
+
+	if current != nil {
+		rm.removeFile(current, doc.ID)
+	}
+	if project == nil {
+		return
+	}
+	if !ok {
+		var err error
+		if liveRoom, err = rm.GetOrCreateRoom(doc.ID); err != nil {
+			log.Printf("failed to open %s for project %s: %v", doc.ID, project.ID, err)
+			return
+		}
+	}
+	project.AddFile(liveRoom)
+}
+
+// RemoveDocument closes a deleted document's room, if it is open, taking it
+// out of its open project first
+func (rm *RoomManager) RemoveDocument(id string) {
+	rm.mutex.Lock()
+	liveRoom, ok := rm.rooms[id]
+	delete(rm.rooms, id)
+	rm.mutex.Unlock()
+	if !ok {
+		return
+	}
+
+	liveRoom.mutex.RLock()
+	project := liveRoom.project
+	liveRoom.mutex.RUnlock()
+	if project != nil {
+		rm.removeFile(project, id)
+	}
+	liveRoom.close()
+}
+
+// removeFile takes a file out of a project, and closes the project if that
+// leaves it with neither files nor clients
+func (rm *RoomManager) removeFile(p *ProjectRoom, fileID string) {
+	p.RemoveFile(fileID)
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	p.mutex.RLock()
+	empty := len(p.Files) == 0 && len(p.Clients) == 0
+	p.mutex.RUnlock()
+	if empty && rm.projects[p.ID] == p {
+		delete(rm.projects, p.ID)
+		p.close()
+	}
+}
+
+// run handles project room registration and broadcasts
+func (p *ProjectRoom) run() {
+	defer func() {
+		if rec := recover(); rec != nil {
+			log.Printf("panic in project.run: %v\n%s", rec, debug.Stack())
+		}
+	}()
+	for {
+		select {
+		case client := <-p.Register:
+			joined, firstIn := p.register(client)
+			p.Broadcast <- joined
+			user := User{ID: client.ClientID, Username: client.Username, Color: client.Color, Sessions: 1}
+			for i := range firstIn {
+				p.emit(EventUserJoined, &firstIn[i], user)
+			}
+			log.Printf("Client %s joined project %s", client.ID, p.ID)
+
+		case client := <-p.Unregister:
+			p.mutex.Lock()
+			if _, ok := p.Clients[client.ID]; ok {
+				delete(p.Clients, client.ID)
+				close(client.Send)
+			}
+			left := leftEvent(p.Clients, client)
+			files := p.rooms()
+			p.mutex.Unlock()
+			for _, r := range files {
+				r.leave(client)
+			}
+			p.Broadcast <- left
+			log.Printf("Client %s left project %s", client.ID, p.ID)
+
+		case message := <-p.Broadcast:
+			p.mutex.Lock()
+			p.send(message, "")
+			p.mutex.Unlock()
+
+		case <-p.done:
+			log.Printf("Project %s closed", p.ID)
+			return
+		}
+	}
+}
+
+// register adds a client and sends it every file in the project. Each
+// file's room lock is held meanwhile, so the first operation the client
+// gets for a file is the first one applied after its snapshot. It returns
+// the event announcing the client, and the files it is the user's first
+// session on, in the files' rooms or the project.
+func (p *ProjectRoom) register(client *Client) ([]byte, []db.Document) {
+	for {
+		p.mutex.RLock()
+		files := p.rooms()
+		p.mutex.RUnlock()
+
+		// In a fixed order, so two projects never wait on each other
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].ID < files[j].ID
+		})
+		for _, r := range files {
+			r.mutex.RLock()
+		}
+
+		p.mutex.Lock()
+		if !p.hasFiles(files) {
+			// A file was added or removed before the project was locked
+			p.mutex.Unlock()
+			for _, r := range files {
+				r.mutex.RUnlock()
+			}
+			continue
+		}
+
+		assignIdentity(p.Clients, client, client.ClientID, client.Username)
+		p.Clients[client.ID] = client
+		joined := joinedEvent(p.Clients, client)
+		sendIdentity(client)
+
+		documents := make([]db.Document, len(files))
+		var firstIn []db.Document
+		for i, r := range files {
+			documents[i] = *r.Document
+			if sessionsOf(r.Clients, client.ClientID)+sessionsOf(p.Clients, client.ClientID) == 1 {
+				firstIn = append(firstIn, *r.Document)
+			}
+		}
+		sortByTitle(documents)
+		snapshot, _ := json.Marshal(map[string]interface{}{
+			"type":       "project_snapshot",
+			"project_id": p.ID,
+			"files":      documents,
+			"users":      usersOf(p.Clients),
+		})
+		client.Send <- snapshot
+		p.mutex.Unlock()
+
+		for _, r := range files {
+			r.mutex.RUnlock()
+		}
+		return joined, firstIn
+	}
+}
+
+// Join registers a client with the project. It reports false, without
+// registering it, if the project was closed meanwhile.
+func (p *ProjectRoom) Join(c *Client) bool {
+	select {
+	case p.Register <- c:
+		return true
+	case <-p.done:
+		return false
+	}
+}
+
+// close stops a project that has neither files nor clients. The manager
+// lock must be held, so no one can open it in the meantime.
+func (p *ProjectRoom) close() {
+	close(p.done)
+}
+
+// rooms returns the rooms of the project's files. The project lock must be
+// held.
+func (p *ProjectRoom) rooms() []*Room {
+	files := make([]*Room, 0, len(p.Files))
+	for _, r := range p.Files {
+		files = append(files, r)
+	}
+	return files
+}
+
+// hasFiles reports whether files are exactly the project's files. The
+// project lock must be held.
+func (p *ProjectRoom) hasFiles(files []*Room) bool {
+	if len(files) != len(p.Files) {
+		return false
+	}
+	for _, r := range files {
+		if p.Files[r.ID] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// client returns one of the project's clients by session id
+func (p *ProjectRoom) client(id string) (*Client, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	c, ok := p.Clients[id]
+	return c, ok
+}
+
+// sessions counts the sessions user id has in the project
+func (p *ProjectRoom) sessions(id string) int {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return sessionsOf(p.Clients, id)
+}
+
+// File returns the room of a file in the project
+func (p *ProjectRoom) File(fileID string) (*Room, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	r, ok := p.Files[fileID]
+	return r, ok
+}
+
+// sortByTitle orders documents by title
+func sortByTitle(documents []db.Document) {
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].Title < documents[j].Title
+	})
+}
+
+// AddFile makes a document's room one of the project's files and announces
+// it. The room stays locked until everyone has been told, so no client gets
+// an operation on the file before hearing it exists.
+func (p *ProjectRoom) AddFile(r *Room) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.project = p
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "file_created",
+		"file": r.Document,
+	})
+
+	p.mutex.Lock()
+	p.Files[r.ID] = r
+	p.send(data, "")
+	p.mutex.Unlock()
+}
+
+// RenameFile announces a file's new title. The room calls it when a title
+// change is applied, with its lock held.
+func (p *ProjectRoom) RenameFile(file *db.Document) {
+	p.broadcastExcept(map[string]interface{}{
+		"type":    "file_renamed",
+		"file_id": file.ID,
+		"title":   file.Title,
+		"version": file.Version,
+	}, "")
+}
+
+// RemoveFile drops a file deleted or moved out of the folder and announces it
+func (p *ProjectRoom) RemoveFile(fileID string) {
+	p.mutex.Lock()
+	r, ok := p.Files[fileID]
+	delete(p.Files, fileID)
+	p.mutex.Unlock()
+
+	if ok {
+		r.mutex.Lock()
+		if r.project == p {
+			r.project = nil
+		}
+		r.mutex.Unlock()
+	}
+
+	p.broadcastExcept(map[string]interface{}{
+		"type":    "file_deleted",
+		"file_id": fileID,
+	}, "")
+}
+
+// SendConflict sends a conflict frame about one file to a single client
+func (p *ProjectRoom) SendConflict(c *Client, fileID string, conflict Conflict) {
+	data, _ := json.Marshal(struct {
+		Conflict
+		FileID string `json:"file_id"`
+	}{conflict, fileID})
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+// SendAck acknowledges a client message
+func (p *ProjectRoom) SendAck(c *Client, ack Ack) {
+	data, _ := json.Marshal(ack)
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+// relay sends a frame a file's room sent its clients to every project
+// client except excludeClientID, with the file_id added
+func (p *ProjectRoom) relay(fileID string, data []byte, excludeClientID string) {
+	var frame map[string]json.RawMessage
+	if err := json.Unmarshal(data, &frame); err != nil {
+		return
+	}
+	frame["file_id"], _ = json.Marshal(fileID)
+	data, _ = json.Marshal(frame)
+
+	p.mutex.Lock()
+	p.send(data, excludeClientID)
+	p.mutex.Unlock()
+}
+
+// broadcastExcept sends a message to every client but one
+func (p *ProjectRoom) broadcastExcept(message map[string]interface{}, excludeClientID string) {
+	data, _ := json.Marshal(message)
+
+	p.mutex.Lock()
+	p.send(data, excludeClientID)
+	p.mutex.Unlock()
+}
+
+// send sends a frame to every client except excludeClientID, dropping the
+// ones that can't keep up. The project lock must be held.
+func (p *ProjectRoom) send(data []byte, excludeClientID string) {
+	for _, client := range p.Clients {
+		if client.ID != excludeClientID {
+			select {
+			case client.Send <- data:
+			default:
+				close(client.Send)
+				delete(p.Clients, client.ID)
+			}
+		}
+	}
+}
+
+// GetUsers returns a list of users currently in the project
+func (p *ProjectRoom) GetUsers() []User {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return usersOf(p.Clients)
+}
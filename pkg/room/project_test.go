@@ -0,0 +1,154 @@
+package room
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// TestProjectSharesRoom checks that a project member and a room client edit
+// the same document: each gets the other's operations, the member's with
+// the file_id added, and the member can undo its own edit
+func TestProjectSharesRoom(t *testing.T) {
+	r, alice, _ := testRoom("hello")
+	p := &ProjectRoom{
+		ID:        "folder",
+		Files:     map[string]*Room{r.ID: r},
+		Clients:   make(map[string]*Client),
+		Broadcast: make(chan []byte, 256),
+	}
+	r.project = p
+	carol := &Client{ID: "carol-session", ClientID: "carol", Project: p, Send: make(chan []byte, 1<<10)}
+	p.register(carol)
+	drain(carol)
+
+	type frame struct {
+		Type      string     `json:"type"`
+		FileID    string     `json:"file_id"`
+		Operation *Operation `json:"operation"`
+	}
+	next := func(c *Client) frame {
+		t.Helper()
+		var f frame
+		select {
+		case data := <-c.Send:
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			t.Fatalf("%s got nothing", c.ClientID)
+		}
+		return f
+	}
+
+	edit(r, alice, []Operation{{Type: "insert", Position: 5, Content: "!"}})
+	if f := next(carol); f.Type != "operation" || f.FileID != r.ID || f.Operation.Content != "!" {
+		t.Errorf("project member got %+v", f)
+	}
+
+	edit(r, carol, []Operation{{Type: "insert", Position: 0, Content: "> "}})
+	if f := next(alice); f.Type != "operation" || f.Operation.Content != "> " {
+		t.Errorf("room client got %+v", f)
+	}
+	if len(carol.Send) != 0 {
+		t.Error("project member got its own operation back")
+	}
+
+	if ops := r.Undo(carol, false); len(ops) == 0 {
+		t.Fatal("project member had nothing to undo")
+	}
+	if got := r.Document.Content; got != "hello!" {
+		t.Errorf("after undo got %q", got)
+	}
+	if f := next(carol); f.Operation == nil || f.Operation.Origin != "undo" {
+		t.Errorf("project member got %+v for its undo", f)
+	}
+}
+
+// drain empties a client's send channel
+func drain(c *Client) {
+	for len(c.Send) > 0 {
+		<-c.Send
+	}
+}
+
+// TestProjectRegisterFirstSession checks that joining a project reports the
+// files it is the user's first session on, counting sessions in the files'
+// rooms as well as the project's
+func TestProjectRegisterFirstSession(t *testing.T) {
+	r, alice, _ := testRoom("hello")
+	p := &ProjectRoom{
+		ID:        "folder",
+		Files:     map[string]*Room{r.ID: r},
+		Clients:   make(map[string]*Client),
+		Broadcast: make(chan []byte, 256),
+	}
+	r.project = p
+
+	tests := []struct {
+		name   string
+		client *Client
+		first  bool
+	}{
+		{"new user", &Client{ID: "carol-1", ClientID: "carol"}, true},
+		{"second session", &Client{ID: "carol-2", ClientID: "carol"}, false},
+		{"in the room", &Client{ID: "alice-2", ClientID: alice.ClientID}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.client.Project = p
+			tt.client.Send = make(chan []byte, 1<<10)
+			_, firstIn := p.register(tt.client)
+			if got := len(firstIn) == 1 && firstIn[0].ID == r.ID; got != tt.first {
+				t.Errorf("first session on %s = %v, want %v (got %v)", r.ID, got, tt.first, firstIn)
+			}
+		})
+	}
+}
+
+// TestRemoveDocument checks that deleting a document closes its room,
+// telling its clients, and drops the project it leaves empty
+func TestRemoveDocument(t *testing.T) {
+	r, alice, _ := testRoom("hello")
+	p := &ProjectRoom{
+		ID:        "folder",
+		Files:     map[string]*Room{r.ID: r},
+		Clients:   make(map[string]*Client),
+		Broadcast: make(chan []byte, 256),
+		done:      make(chan struct{}),
+	}
+	r.project = p
+	rm := &RoomManager{
+		rooms:    map[string]*Room{r.ID: r},
+		projects: map[string]*ProjectRoom{p.ID: p},
+	}
+
+	rm.RemoveDocument(r.ID)
+
+	if _, ok := rm.GetRoom(r.ID); ok {
+		t.Error("room still open")
+	}
+	if _, ok := rm.GetProjectRoom(p.ID); ok {
+		t.Error("empty project still open")
+	}
+	for name, done := range map[string]chan struct{}{"room": r.done, "project": p.done} {
+		select {
+		case <-done:
+		default:
+			t.Errorf("%s not closed", name)
+		}
+	}
+
+	var deleted bool
+	for data := range alice.Send {
+		var f struct {
+			Type string `json:"type"`
+			ID   string `json:"id"`
+		}
+		json.Unmarshal(data, &f)
+		deleted = deleted || (f.Type == "document_deleted" && f.ID == r.ID)
+	}
+	if !deleted {
+		t.Error("room client wasn't told the document was deleted")
+	}
+}
@@ -5,8 +5,11 @@ import (
 	"log"
 	"runtime/debug"
 	"sync"
+	"time"
 
 	"collab-editor/pkg/db"
+	"collab-editor/pkg/diagnostics"
+	"collab-editor/pkg/diff"
 
 	"github.com/gorilla/websocket"
 )
@@ -19,32 +22,53 @@ type Operation struct {
 	Length    int    `json:"length"`    // Length for retain/delete operations
 	ClientID  string `json:"client_id"` // ID of the client that generated this operation
 	Timestamp int64  `json:"timestamp"` // Timestamp for ordering operations
+	// Origin marks operations the server generated for ClientID: "undo" or
+	// "redo" for undoing or redoing their edits, "format" for formatting,
+	// "reconcile" for merging in their offline edits. "git", "merge" and
+	// "replace" mark a git import, a merge and a content replacement through
+	// the REST API, which have no ClientID.
+	Origin string `json:"origin,omitempty"`
+	group  uint64 // undo/redo step the operation belongs to, see Undo
 }
 
+// MetadataUpdate changes a document's title and language. Version is, from
+// a client, the stored version its change is based on (0 if unknown) and,
+// broadcast, the version the change was saved as.
 type MetadataUpdate struct {
 	Type      string `json:"type"`
 	Title     string `json:"title"`
 	Language  string `json:"language"`
+	Version   int    `json:"version,omitempty"`
 	ClientID  string `json:"client_id"`
 	Timestamp int64  `json:"timestamp"`
 }
 
+// Snapshot replaces a document's content. Version works as in MetadataUpdate.
 type Snapshot struct {
 	Type      string   `json:"type"`
 	Content   string   `json:"content"`
+	Version   int      `json:"version,omitempty"`
 	ClientID  string   `json:"id"`
 	Users     []Client `json:"users"`
 	Timestamp int64    `json:"timestamp"`
 	Seq       uint64   `json:"seq,omitempty"` // correlation id
 
 }
+
+// Presence is where a client is in the document. LineNumber and Column are
+// the primary cursor, the head of the first selection, kept for clients that
+// only show one cursor.
 type Presence struct {
-	Type       string  `json:"type"`
-	ClientID   string  `json:"client_id"`
-	Username   string  `json:"username"`
-	Color      string  `json:"color"`
-	LineNumber float64 `json:"lineNumber"`
-	Column     float64 `json:"column"`
+	Type       string      `json:"type"`
+	ClientID   string      `json:"client_id"`
+	SessionID  string      `json:"session_id"`
+	Username   string      `json:"username"`
+	Color      string      `json:"color"`
+	LineNumber float64     `json:"lineNumber"`
+	Column     float64     `json:"column"`
+	Selections []Selection `json:"selections,omitempty"`
+	Activity   string      `json:"activity,omitempty"` // "viewing", "typing", "idle"
+	Viewport   *Viewport   `json:"viewport,omitempty"`
 }
 
 // Client represents a connected client in a room
@@ -52,49 +76,225 @@ type Client struct {
 	ID       string          `json:"-"`
 	ClientID string          `json:"id"`
 	Username string          `json:"username"`
+	Color    string          `json:"color"`
+	Token    string          `json:"-"` // proves ClientID; see pkg/identity
 	Conn     *websocket.Conn `json:"-"`
 	Room     *Room           `json:"-"`
+	Project  *ProjectRoom    `json:"-"` // set instead of Room for project connections
 	Send     chan []byte     `json:"-"`
 }
 
+// Leave asks the client's room or project to unregister it. It never blocks,
+// so it is safe to call from both pumps as they shut down.
+func (c *Client) Leave() {
+	unregister := c.Room.unregisterChan()
+	if c.Project != nil {
+		unregister = c.Project.Unregister
+	}
+	if unregister == nil {
+		return
+	}
+
+	select {
+	case unregister <- c:
+	default:
+	}
+}
+
+// User is one identity in a room, however many sessions it has open
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
+	Color    string `json:"color,omitempty"`
+	Sessions int    `json:"sessions,omitempty"`
 }
 
 // Room represents a collaborative editing session
 type Room struct {
-	ID         string             `json:"id"`
-	Document   *db.Document       `json:"document"`
-	Clients    map[string]*Client `json:"clients"`
-	Broadcast  chan []byte        `json:"-"`
-	Register   chan *Client       `json:"-"`
-	Unregister chan *Client       `json:"-"`
-	mutex      sync.RWMutex
+	ID            string                       `json:"id"`
+	Document      *db.Document                 `json:"document"`
+	Clients       map[string]*Client           `json:"clients"`
+	Broadcast     chan []byte                  `json:"-"`
+	Register      chan *Client                 `json:"-"`
+	Unregister    chan *Client                 `json:"-"`
+	presence      map[string]*clientPresence   // latest presence per client, by Client.ID
+	chat          []*db.ChatMessage            // recent chat, oldest first
+	comments      map[string]*db.CommentThread // by thread id, anchors kept up to date
+	commentsMoved bool                         // anchors changed since they were last saved
+	emit          func(eventType string, doc *db.Document, data interface{})
+	watchers      map[*Watcher]struct{} // read-only followers, see Watch
+	watchersMutex sync.Mutex
+	undo          undoState
+	diagnostics   *diagnostics.Registry // nil when documents aren't checked
+	diagnosed     diagnosticsState
+	project       *ProjectRoom  // open project of the document's folder, if any
+	done          chan struct{} // closed once the document is deleted, see close
+	mutex         sync.RWMutex
 }
 
 // RoomManager manages all rooms
 type RoomManager struct {
-	rooms map[string]*Room
-	mutex sync.RWMutex
-	Store db.PostgresDocumentStore
+	rooms       map[string]*Room
+	projects    map[string]*ProjectRoom
+	listener    func(Event)           // see Listen
+	diagnostics *diagnostics.Registry // see SetDiagnostics
+	mutex       sync.RWMutex
+	Store       db.IDocumentStore
 }
 
 // NewRoomManager creates a new room manager
-func NewRoomManager(store db.PostgresDocumentStore) *RoomManager {
+func NewRoomManager(store db.IDocumentStore) *RoomManager {
 	return &RoomManager{
-		rooms: make(map[string]*Room),
-		Store: store,
+		rooms:    make(map[string]*Room),
+		projects: make(map[string]*ProjectRoom),
+		Store:    store,
+	}
+}
+
+// Join registers a client with the room. It reports false, without
+// registering it, if the room was closed because its document was deleted.
+func (r *Room) Join(c *Client) bool {
+	select {
+	case r.Register <- c:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// close shuts the room of a deleted document: clients and watchers are told
+// with a document_deleted frame and then disconnected, and the room stops
+// running. The room must already be out of its project.
+func (r *Room) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"type": "document_deleted",
+		"id":   r.ID,
+	})
+	for _, client := range r.Clients {
+		select {
+		case client.Send <- data:
+		default:
+		}
+		close(client.Send)
+		delete(r.Clients, client.ID)
+	}
+
+	r.watchersMutex.Lock()
+	for w := range r.watchers {
+		select {
+		case w.Send <- data:
+		default:
+		}
+		close(w.Send)
+		delete(r.watchers, w)
 	}
+	r.watchersMutex.Unlock()
+
+	r.diagnosed.mutex.Lock()
+	if r.diagnosed.timer != nil {
+		r.diagnosed.timer.Stop()
+	}
+	r.diagnosed.mutex.Unlock()
+
+	close(r.done)
+}
+
+// unregisterChan returns the room's Unregister channel, or nil for a nil room
+func (r *Room) unregisterChan() chan *Client {
+	if r == nil {
+		return nil
+	}
+	return r.Unregister
 }
 
 type Ack struct {
-	Type      string `json:"type"`  // "ack"
-	Event     string `json:"event"` // "snapshot"
+	Type      string `json:"type"`              // "ack"
+	Event     string `json:"event"`             // "snapshot", "document_update"
+	Version   int    `json:"version,omitempty"` // the version the write was saved as
 	Seq       uint64 `json:"seq,omitempty"`
 	Timestamp int64  `json:"ts"`
 }
 
+// Conflict tells a client its write was based on a stale document version.
+// Document carries the authoritative state: the room's live document, or the
+// stored one if the room had to be reset to it. Discarded holds the room's
+// content that reset threw away, edits no one had saved yet, when there was
+// any.
+type Conflict struct {
+	Type            string       `json:"type"`  // "conflict"
+	Event           string       `json:"event"` // "snapshot", "document_update"
+	ExpectedVersion int          `json:"expected_version"`
+	ActualVersion   int          `json:"actual_version"`
+	Document        *db.Document `json:"document,omitempty"`
+	Discarded       string       `json:"discarded,omitempty"`
+	Timestamp       int64        `json:"ts"`
+}
+
+// SendConflict sends a conflict frame to a single client
+func (r *Room) SendConflict(c *Client, conflict Conflict) {
+	data, _ := json.Marshal(conflict)
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+// ReconcileResult answers a client's reconcile request with the document
+// after its offline edits were merged in. Merged is the merge with conflict
+// markers, set only when Conflicts isn't empty; Content is what the document
+// now holds, with every conflict settled in favour of the live text.
+type ReconcileResult struct {
+	Type        string          `json:"type"` // "reconcile_result"
+	Seq         uint64          `json:"seq,omitempty"`
+	BaseVersion int             `json:"base_version"`
+	Version     int             `json:"version"`
+	Content     string          `json:"content"`
+	Clean       bool            `json:"clean"`
+	Conflicts   []diff.Conflict `json:"conflicts"`
+	Merged      string          `json:"merged,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Timestamp   int64           `json:"ts"`
+}
+
+// SendReconcileResult sends a reconcile result to a single client
+func (r *Room) SendReconcileResult(c *Client, result ReconcileResult) {
+	data, _ := json.Marshal(result)
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
+// FormatResult answers a client's format request. The formatting itself
+// reaches everyone as ordinary operations; Operations counts them.
+type FormatResult struct {
+	Type       string `json:"type"` // "format_result"
+	Seq        uint64 `json:"seq,omitempty"`
+	Language   string `json:"language"`
+	Changed    bool   `json:"changed"`
+	Operations int    `json:"operations"`
+	Error      string `json:"error,omitempty"`
+	Timestamp  int64  `json:"ts"`
+}
+
+// SendFormatResult sends a format result to a single client
+func (r *Room) SendFormatResult(c *Client, result FormatResult) {
+	data, _ := json.Marshal(result)
+
+	select {
+	case c.Send <- data:
+	default:
+		// drop on slow client
+	}
+}
+
 func (r *Room) SendAck(c *Client, ack Ack, sendClientID string) {
 	data, _ := json.Marshal(ack)
 
@@ -128,22 +328,100 @@ func (rm *RoomManager) GetOrCreateRoom(roomID string) (*Room, error) {
 		return nil, err
 	}
 
-	// Create a new room
-	room = &Room{
-		ID:         roomID,
-		Document:   document,
-		Clients:    make(map[string]*Client),
-		Register:   make(chan *Client),
-		Unregister: make(chan *Client),
-		Broadcast:  make(chan []byte, 256),
+	return rm.openRoom(document), nil
+}
+
+// openRoom creates and starts a room for a document. The manager lock must
+// be held.
+func (rm *RoomManager) openRoom(document *db.Document) *Room {
+	room := &Room{
+		ID:          document.ID,
+		Document:    document,
+		Clients:     make(map[string]*Client),
+		Register:    make(chan *Client),
+		Unregister:  make(chan *Client),
+		Broadcast:   make(chan []byte, 256),
+		presence:    make(map[string]*clientPresence),
+		comments:    make(map[string]*db.CommentThread),
+		emit:        rm.Emit,
+		watchers:    make(map[*Watcher]struct{}),
+		undo:        undoState{stacks: make(map[string]*undoStacks)},
+		diagnostics: rm.diagnostics,
+		done:        make(chan struct{}),
 	}
 
-	rm.rooms[roomID] = room
+	rm.loadChat(room)
+	rm.loadComments(room)
+	rm.rooms[document.ID] = room
 
 	// Start room.Run() immediately in a goroutine
 	go room.run()
+	room.scheduleDiagnostics()
+
+	return room
+}
+
+// GetRoom returns the live room for a document, if anyone has it open
+func (rm *RoomManager) GetRoom(roomID string) (*Room, bool) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	room, ok := rm.rooms[roomID]
+	return room, ok
+}
+
+// GetProjectRoom returns the live project room for a folder, if anyone has it open
+func (rm *RoomManager) GetProjectRoom(folderID string) (*ProjectRoom, bool) {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	project, ok := rm.projects[folderID]
+	return project, ok
+}
 
-	return room, nil
+// LiveDocument returns doc with the content of its room if one is open, so
+// readers see edits that haven't been persisted yet. Files of an open
+// project always have one.
+func (rm *RoomManager) LiveDocument(doc *db.Document) *db.Document {
+	if liveRoom, ok := rm.GetRoom(doc.ID); ok {
+		live := liveRoom.CurrentDocument()
+		current := *doc
+		current.Title = live.Title
+		current.Content = live.Content
+		current.Language = live.Language
+		return &current
+	}
+
+	return doc
+}
+
+// RefreshDocument pushes a document that was changed behind the rooms' backs
+// (e.g. imported from git) into its live room, if any, and a new one into
+// its folder's open project
+func (rm *RoomManager) RefreshDocument(doc *db.Document) {
+	if liveRoom, ok := rm.GetRoom(doc.ID); ok {
+		liveRoom.ApplyExternalChange(doc)
+		rm.SaveCommentAnchors(liveRoom)
+	}
+	rm.FileDocument(doc)
+}
+
+// WatchExternalChanges pushes documents modified outside the server into
+// their live rooms. It blocks until changes is closed.
+func (rm *RoomManager) WatchExternalChanges(changes <-chan *db.Document) {
+	for doc := range changes {
+		rm.mutex.RLock()
+		room, ok := rm.rooms[doc.ID]
+		rm.mutex.RUnlock()
+		if !ok {
+			// No one is editing it; the next GetOrCreateRoom reads the new content
+			continue
+		}
+
+		log.Printf("Document %s changed externally, refreshing room", doc.ID)
+		room.ApplyExternalChange(doc)
+		rm.SaveCommentAnchors(room)
+	}
 }
 
 // run handles room operations
@@ -159,12 +437,22 @@ func (r *Room) run() {
 		case client := <-r.Register:
 			log.Println("Registering client", client.ID)
 			r.mutex.Lock()
+			assignIdentity(r.Clients, client, client.ClientID, client.Username)
 			r.Clients[client.ID] = client
-			r.mutex.Unlock()
-			//send snapshot
+			joined := joinedEvent(r.Clients, client)
+			firstSession := r.sessions(client.ClientID) == 1
+			user := User{ID: client.ClientID, Username: client.Username, Color: client.Color, Sessions: 1}
+			doc := *r.Document
+			sendIdentity(client)
+			// The snapshot goes out under the lock so the first operation
+			// the client gets is the first one applied after it
 			r.sendSnapshot(client)
-			// //broadcast user joined
-			r.broadcastUserJoined(client)
+			r.mutex.Unlock()
+			// broadcast user (or session) joined
+			r.Broadcast <- joined
+			if firstSession {
+				r.emit(EventUserJoined, &doc, user)
+			}
 			log.Printf("Client %s joined room %s", client.ID, r.ID)
 
 		case client := <-r.Unregister:
@@ -174,10 +462,15 @@ func (r *Room) run() {
 				delete(r.Clients, client.ID)
 				close(client.Send)
 			}
+			delete(r.presence, client.ID)
+			left := leftEvent(r.Clients, client)
+			if r.sessions(client.ClientID) == 0 {
+				r.forgetUndo(client.ClientID)
+			}
 			r.mutex.Unlock()
 
-			// Notify other clients about user leaving
-			r.broadcastUserLeft(client)
+			// Notify other clients about user (or session) leaving
+			r.Broadcast <- left
 			log.Printf("Client %s left room %s", client.ID, r.ID)
 
 		case message := <-r.Broadcast:
@@ -192,6 +485,10 @@ func (r *Room) run() {
 				}
 			}
 			r.mutex.RUnlock()
+
+		case <-r.done:
+			log.Printf("Room %s closed", r.ID)
+			return
 		}
 
 		log.Println("Clients:", len(r.Clients))
@@ -199,65 +496,88 @@ func (r *Room) run() {
 
 }
 
-// broadcastUserJoined notifies clients about a new user
-func (r *Room) broadcastUserJoined(client *Client) {
-	message := map[string]interface{}{
-		"type":     "user_joined",
-		"id":       client.ClientID,
-		"username": client.Username,
-	}
-
-	data, _ := json.Marshal(message)
-	r.Broadcast <- data
-}
-
-func (r *Room) BroadcastUserConnected(user *User) {
-	message := map[string]interface{}{
-		"type":     "init_ok",
-		"id":       user.ID,
-		"username": user.Username,
-	}
-
-	data, _ := json.Marshal(message)
-	r.Broadcast <- data
-}
-
+// sendSnapshot sends a joining client the document and everything else the
+// room knows. The room lock must be held.
 func (r *Room) sendSnapshot(c *Client) {
-	// Send initial snapshot
 	snapshot := map[string]interface{}{
 		"type":     "snapshot",
-		"id":       c.Room.Document.ID,
-		"content":  c.Room.Document.Content,
-		"title":    c.Room.Document.Title,
-		"language": c.Room.Document.Language,
-		"users":    c.Room.GetUsers(),
+		"id":       r.Document.ID,
+		"content":  r.Document.Content,
+		"title":    r.Document.Title,
+		"language": r.Document.Language,
+		"version":  r.Document.Version,
+		"users":    usersOf(r.Clients),
+		"presence": r.presenceMessages(),
+		"chat":     r.chatHistory(),
+		"comments": r.commentThreads(),
+	}
+	if found := r.currentDiagnostics(); found != nil {
+		snapshot["diagnostics"] = found
 	}
 	msg, _ := json.Marshal(snapshot)
 	c.Send <- msg
 }
 
-// broadcastUserLeft notifies clients about a user leaving
-func (r *Room) broadcastUserLeft(client *Client) {
-	message := map[string]interface{}{
-		"type":     "user_left",
-		"id":       client.ClientID,
-		"username": client.Username,
+// ApplyOperations applies operations to the document, in order, moving
+// cursors, comment anchors and the undo history with each, and sends each to
+// watchers and every client except excludeClientID. It all happens under the
+// room lock, so everyone gets operations in the order they were applied.
+func (r *Room) ApplyOperations(operations []*Operation, excludeClientID string) {
+	r.mutex.Lock()
+	r.applyOperations(operations, excludeClientID)
+	r.mutex.Unlock()
+
+	if len(operations) > 0 {
+		r.scheduleDiagnostics()
 	}
-
-	data, _ := json.Marshal(message)
-	r.Broadcast <- data
 }
 
-// BroadcastOperation broadcasts an operation to all clients except the sender
-func (r *Room) BroadcastOperation(operation *Operation, excludeClientID string) {
-	message := map[string]interface{}{
-		"type":      "operation",
-		"operation": operation,
+// Edit applies the operations change returns for the document as it is
+// now, like ApplyOperations. Reading the document and applying them happen
+// under the room lock, so nothing else lands in between, which makes it the
+// way to apply changes worked out from the current content. When after is
+// set it runs under the lock too, with the document the operations left, so
+// a frame it sends reaches its client before any later operation. Edit
+// returns the operations applied.
+func (r *Room) Edit(change func(doc db.Document) []*Operation, excludeClientID string, after func(doc db.Document)) []*Operation {
+	r.mutex.Lock()
+	operations := change(*r.Document)
+	r.applyOperations(operations, excludeClientID)
+	if after != nil {
+		after(*r.Document)
 	}
+	r.mutex.Unlock()
 
-	data, _ := json.Marshal(message)
+	if len(operations) > 0 {
+		r.scheduleDiagnostics()
+	}
+	return operations
+}
 
-	r.mutex.RLock()
+// applyOperations is ApplyOperations with the room lock held
+func (r *Room) applyOperations(operations []*Operation, excludeClientID string) {
+	for _, operation := range operations {
+		before := r.Document.Content
+		r.Document.Content = operation.Apply(before)
+		r.transformPresence(operation, before, r.Document.Content)
+		r.transformComments(operation, before)
+		r.recordOperation(operation, before)
+
+		data, _ := json.Marshal(map[string]interface{}{
+			"type":      "operation",
+			"operation": operation,
+		})
+		r.notifyWatchers(data)
+		r.send(data, excludeClientID)
+	}
+	// The document isn't saved here; Document.Version tracks the persisted
+	// version, so it isn't bumped either.
+}
+
+// send sends a frame to every client except excludeClientID, dropping the
+// ones that can't keep up, and relays it to the document's project. The room
+// lock must be held.
+func (r *Room) send(data []byte, excludeClientID string) {
 	for _, client := range r.Clients {
 		if client.ID != excludeClientID {
 			select {
@@ -268,84 +588,175 @@ func (r *Room) BroadcastOperation(operation *Operation, excludeClientID string)
 			}
 		}
 	}
-	r.mutex.RUnlock()
+	r.relay(data, excludeClientID)
 }
 
-func (r *Room) BroadcastPresence(presence *Presence, excludeClientID string) {
-	message := map[string]interface{}{
-		"type":       "presence_user",
-		"id":         presence.ClientID,
-		"username":   presence.Username,
-		"color":      presence.Color,
-		"lineNumber": presence.LineNumber,
-		"column":     presence.Column,
+// relay sends a frame the room's clients got to the clients of the
+// document's project, if it is in an open one. The room lock must be held.
+func (r *Room) relay(data []byte, excludeClientID string) {
+	if r.project != nil {
+		r.project.relay(r.ID, data, excludeClientID)
 	}
+}
 
-	data, _ := json.Marshal(message)
-	log.Printf("broadcasting presence")
+// member returns the client with session id, either in the room or in the
+// document's project. The room lock must be held.
+func (r *Room) member(id string) (*Client, bool) {
+	if c, ok := r.Clients[id]; ok {
+		return c, true
+	}
+	if r.project != nil {
+		return r.project.client(id)
+	}
+	return nil, false
+}
 
-	r.mutex.RLock()
-	for _, client := range r.Clients {
-		if client.ID != excludeClientID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(r.Clients, client.ID)
-			}
-		}
+// leave forgets a project client that has left: its cursor, which everyone
+// is told is gone, and its user's undo history once they have no session
+// left on the document
+func (r *Room) leave(c *Client) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, ok := r.presence[c.ID]; ok {
+		delete(r.presence, c.ID)
+		r.send(userEvent("session_left", c), "")
 	}
-	r.mutex.RUnlock()
+	if r.sessions(c.ClientID) == 0 {
+		r.forgetUndo(c.ClientID)
+	}
+}
 
+// sessions counts the sessions user id has on the document, in the room and
+// in its project. The room lock must be held.
+func (r *Room) sessions(id string) int {
+	count := sessionsOf(r.Clients, id)
+	if r.project != nil {
+		count += r.project.sessions(id)
+	}
+	return count
 }
 
-// BroadcastOperation broadcasts an operation to all clients except the sender
-func (r *Room) BroadcastMetadataUpdate(update *MetadataUpdate, excludeClientID string) {
-	message := map[string]interface{}{
-		"type":            "document_update",
-		"document_update": update,
+// ApplyMetadataUpdate makes doc, just saved with update's title and
+// language, the room's stored document, keeping the live content, and sends
+// update, with the version it was saved as, to watchers and every client
+// except excludeClientID. A new title is announced to the document's project
+// as a file rename.
+func (r *Room) ApplyMetadataUpdate(doc *db.Document, update *MetadataUpdate, excludeClientID string) {
+	r.mutex.Lock()
+	renamed := r.Document.Title != doc.Title
+	r.Document.Title = doc.Title
+	r.Document.Language = doc.Language
+	r.Document.Version = doc.Version
+	r.Document.UpdatedAt = doc.UpdatedAt
+	update.Version = doc.Version
+	if renamed && r.project != nil {
+		r.project.RenameFile(doc)
 	}
 
-	data, _ := json.Marshal(message)
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":            "document_update",
+		"document_update": update,
+	})
+	r.notifyWatchers(data)
+	r.send(data, excludeClientID)
+	r.mutex.Unlock()
 
-	r.mutex.RLock()
-	for _, client := range r.Clients {
-		if client.ID != excludeClientID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(r.Clients, client.ID)
-			}
-		}
-	}
-	r.mutex.RUnlock()
+	r.scheduleDiagnostics()
 }
 
-func (r *Room) BroadcastSnapshotUpdate(snapshot *Snapshot, excludeClientID string) {
-	message := map[string]interface{}{
-		"type": "snapshot",
-		//"id":       c.Room.Document.ID,
+// ApplySnapshot replaces the room's document with doc, just saved from
+// snapshot, and sends the snapshot, with the version it was saved as, to
+// watchers and every client except excludeClientID
+func (r *Room) ApplySnapshot(doc *db.Document, snapshot *Snapshot, excludeClientID string) {
+	r.mutex.Lock()
+	r.replaceDocument(doc)
+	snapshot.Version = doc.Version
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":    "snapshot",
 		"content": snapshot.Content,
+		"version": snapshot.Version,
 		"users":   snapshot.Users,
-		// "title":    snapshot.,
-		// "language": snapshot.Language,
+	})
+	r.notifyWatchers(data)
+	r.send(data, excludeClientID)
+	r.mutex.Unlock()
+
+	r.scheduleDiagnostics()
+}
+
+// ApplyExternalChange replaces the room's document with one that was
+// modified outside the server and sends every client a fresh snapshot. It
+// returns the live content it replaced.
+func (r *Room) ApplyExternalChange(doc *db.Document) string {
+	r.mutex.Lock()
+	replaced := r.Document.Content
+	r.replaceDocument(doc)
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":     "snapshot",
+		"id":       doc.ID,
+		"content":  doc.Content,
+		"title":    doc.Title,
+		"language": doc.Language,
+		"version":  doc.Version,
+		"users":    usersOf(r.Clients),
+		"source":   "external",
+	})
+	r.notifyWatchers(data)
+	r.send(data, "")
+	r.mutex.Unlock()
+
+	r.scheduleDiagnostics()
+	return replaced
+}
+
+// replaceDocument makes doc the room's document, content included. Comment
+// anchors move through the change; edits made before the content was
+// replaced can't be undone after it. The room lock must be held.
+func (r *Room) replaceDocument(doc *db.Document) {
+	r.moveComments(r.Document.Content, doc.Content)
+	r.Document.Content = doc.Content
+	r.Document.Title = doc.Title
+	r.Document.Language = doc.Language
+	r.Document.Version = doc.Version
+	r.Document.UpdatedAt = doc.UpdatedAt
+	r.resetUndo()
+}
+
+// SaveEdit saves doc, a room's document as an Edit left it, guarded by the
+// version the room held then, and tells the room's clients the version it
+// was saved as. Operations applied since stay unsaved, as usual. A version
+// conflict means the document was saved meanwhile; doc's content is live in
+// the room either way and goes out with its next save.
+func (rm *RoomManager) SaveEdit(r *Room, doc db.Document) (*db.Document, error) {
+	updated, err := rm.Store.UpdateDocument(r.ID, &db.DocumentUpdate{
+		Content:         &doc.Content,
+		ExpectedVersion: &doc.Version,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	data, _ := json.Marshal(message)
+	r.ApplyMetadataUpdate(updated, &MetadataUpdate{
+		Type:      "document_update",
+		Title:     updated.Title,
+		Language:  updated.Language,
+		Timestamp: time.Now().UnixNano(),
+	}, "")
+	rm.SaveCommentAnchors(r)
+	rm.Emit(EventDocumentUpdated, updated, nil)
+	return updated, nil
+}
 
+// CurrentDocument returns a copy of the room's document as it is now: the
+// live content, and the title, language and version last saved
+func (r *Room) CurrentDocument() db.Document {
 	r.mutex.RLock()
-	for _, client := range r.Clients {
-		if client.ID != excludeClientID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(r.Clients, client.ID)
-			}
-		}
-	}
-	r.mutex.RUnlock()
+	defer r.mutex.RUnlock()
+
+	return *r.Document
 }
 
 // GetUsers returns a list of users currently in the room
@@ -353,13 +764,18 @@ func (r *Room) GetUsers() []User {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	users := make([]User, 0, len(r.Clients))
-	for _, client := range r.Clients {
-		users = append(users, User{
-			ID:       client.ClientID,
-			Username: client.Username,
-		})
-	}
+	return usersOf(r.Clients)
+}
 
+// Present returns the users on the document: those in the room and, when
+// the document is in an open project, those in the project
+func (r *Room) Present() []User {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	users := usersOf(r.Clients)
+	if r.project != nil {
+		users = append(users, r.project.GetUsers()...)
+	}
 	return users
 }
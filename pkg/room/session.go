@@ -0,0 +1,70 @@
+package room
+
+import "encoding/json"
+
+// A user (one identity, see pkg/identity) can be connected through several
+// sessions at once, say two tabs or a laptop and a phone. Each session is a
+// Client with its own ID; sessions of the same user share ClientID, name and
+// color. Join and leave events are per user, cursors are per session.
+
+// sessionsOf counts the sessions user id has among clients
+func sessionsOf(clients map[string]*Client, id string) int {
+	count := 0
+	for _, c := range clients {
+		if c.ClientID == id {
+			count++
+		}
+	}
+	return count
+}
+
+// usersOf lists each user among clients once, with how many sessions it has
+func usersOf(clients map[string]*Client) []User {
+	users := make([]User, 0, len(clients))
+	index := make(map[string]int)
+	for _, c := range clients {
+		if i, ok := index[c.ClientID]; ok {
+			users[i].Sessions++
+			continue
+		}
+		index[c.ClientID] = len(users)
+		users = append(users, User{
+			ID:       c.ClientID,
+			Username: c.Username,
+			Color:    c.Color,
+			Sessions: 1,
+		})
+	}
+	return users
+}
+
+// userEvent builds a user_joined, user_left, session_joined or session_left
+// frame about c
+func userEvent(event string, c *Client) []byte {
+	data, _ := json.Marshal(map[string]interface{}{
+		"type":       event,
+		"id":         c.ClientID,
+		"session_id": c.ID,
+		"username":   c.Username,
+		"color":      c.Color,
+	})
+	return data
+}
+
+// joinedEvent announces a session that was just added to clients:
+// user_joined if it's the user's first, session_joined otherwise
+func joinedEvent(clients map[string]*Client, c *Client) []byte {
+	if sessionsOf(clients, c.ClientID) == 1 {
+		return userEvent("user_joined", c)
+	}
+	return userEvent("session_joined", c)
+}
+
+// leftEvent announces a session that was just removed from clients:
+// user_left if it was the user's last, session_left otherwise
+func leftEvent(clients map[string]*Client, c *Client) []byte {
+	if sessionsOf(clients, c.ClientID) == 0 {
+		return userEvent("user_left", c)
+	}
+	return userEvent("session_left", c)
+}
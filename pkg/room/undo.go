@@ -0,0 +1,402 @@
+package room
+
+import (
+	"sync"
+	"time"
+)
+
+// Undo is per user: each user undoes their own edits, not everyone's. The
+// room keeps a history of the operations applied to the document and, per
+// user, stacks of the edits they can undo and redo. Undoing an edit applies
+// its inverse, transformed against every operation applied since, so other
+// users' later work stays put.
+
+const (
+	// maxHistory bounds the operations kept to transform undos against.
+	// Edits older than the history can no longer be undone.
+	maxHistory = 1000
+	// maxUndo bounds each user's undo and redo stacks
+	maxUndo = 100
+	// undoGroupWindow is how soon after the previous one an edit must come,
+	// with nothing in between, to be undone together with it, so typing a
+	// word is one undo rather than one per letter
+	undoGroupWindow = time.Second
+)
+
+// appliedOp is an operation as it was applied to the document, with the
+// text a delete removed so it can be put back
+type appliedOp struct {
+	seq     uint64
+	op      Operation
+	deleted string
+}
+
+// undoEntry is one step on an undo or redo stack: the operations applied,
+// in order, and the history seq of the last one
+type undoEntry struct {
+	ops   []appliedOp
+	seq   uint64
+	group uint64
+	at    time.Time
+}
+
+type undoStacks struct {
+	undo, redo []*undoEntry
+}
+
+type undoState struct {
+	history []appliedOp
+	seq     uint64                 // seq of the latest operation in history
+	groups  uint64                 // last undo/redo step handed out
+	stacks  map[string]*undoStacks // by identity id
+	mutex   sync.Mutex
+}
+
+// recordOperation adds an operation, just applied to before, to the room's
+// history. A client's own edit goes on its user's undo stack and clears
+// their redo stack; operations from Undo go on the opposite stack. The room
+// lock must be held.
+func (r *Room) recordOperation(op *Operation, before string) {
+	var author string
+	if client, ok := r.member(op.ClientID); ok {
+		author = client.ClientID
+	}
+
+	applied, ok := normalizeApplied(op, before)
+	if !ok {
+		// Apply ignored it, so there is nothing to undo
+		return
+	}
+
+	u := &r.undo
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.seq++
+	applied.seq = u.seq
+	u.history = append(u.history, applied)
+	if len(u.history) > maxHistory {
+		u.history = u.history[len(u.history)-maxHistory:]
+	}
+
+	if author == "" {
+		return
+	}
+	stacks := u.stacks[author]
+	if stacks == nil {
+		stacks = &undoStacks{}
+		u.stacks[author] = stacks
+	}
+
+	switch op.Origin {
+	case "undo":
+		stacks.redo = pushUndo(stacks.redo, applied, op.group, false)
+	case "redo":
+		stacks.undo = pushUndo(stacks.undo, applied, op.group, false)
+	default:
+		stacks.redo = nil
+		stacks.undo = pushUndo(stacks.undo, applied, 0, true)
+	}
+}
+
+// pushUndo adds an applied operation to a stack: to the top entry when it's
+// part of the same step, otherwise as a new entry
+func pushUndo(stack []*undoEntry, applied appliedOp, group uint64, byTime bool) []*undoEntry {
+	now := time.Now()
+	if n := len(stack); n > 0 {
+		top := stack[n-1]
+		sameStep := group != 0 && top.group == group
+		if byTime {
+			// Only group edits nothing else happened between
+			sameStep = top.group == 0 && top.seq == applied.seq-1 && now.Sub(top.at) < undoGroupWindow
+		}
+		if sameStep {
+			top.ops = append(top.ops, applied)
+			top.seq = applied.seq
+			top.at = now
+			return stack
+		}
+	}
+
+	stack = append(stack, &undoEntry{
+		ops:   []appliedOp{applied},
+		seq:   applied.seq,
+		group: group,
+		at:    now,
+	})
+	if len(stack) > maxUndo {
+		stack = stack[len(stack)-maxUndo:]
+	}
+	return stack
+}
+
+// Undo undoes a client's user's latest edit, or redoes their latest undo:
+// it applies the inverse operations, transformed against everything applied
+// since, and sends them to everyone like any other operation. Working them
+// out and applying them happen under the room lock, so nothing can be
+// applied in between. It returns the operations applied, none when there
+// was nothing to undo or redo.
+func (r *Room) Undo(c *Client, redo bool) []*Operation {
+	r.mutex.Lock()
+	operations := r.undoOperations(c, redo)
+	r.applyOperations(operations, "")
+	r.mutex.Unlock()
+
+	if len(operations) > 0 {
+		r.scheduleDiagnostics()
+	}
+	return operations
+}
+
+// undoOperations returns the operations that undo a client's user's latest
+// edit, or redo their latest undo, transformed against everything applied
+// since, or nil when there is nothing to undo or redo. The room lock must be
+// held until they're applied.
+func (r *Room) undoOperations(c *Client, redo bool) []*Operation {
+	u := &r.undo
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stacks := u.stacks[c.ClientID]
+	if stacks == nil {
+		return nil
+	}
+	stack, origin := &stacks.undo, "undo"
+	if redo {
+		stack, origin = &stacks.redo, "redo"
+	}
+
+	for len(*stack) > 0 {
+		entry := (*stack)[len(*stack)-1]
+		*stack = (*stack)[:len(*stack)-1]
+
+		since, ok := u.since(entry.seq)
+		if !ok {
+			// Older than the history; so is everything under it
+			*stack = nil
+			return nil
+		}
+
+		ops, _ := transformOps(invert(entry.ops), since)
+		if len(ops) == 0 {
+			// Others already removed everything this would change
+			continue
+		}
+
+		u.groups++
+		now := time.Now().UnixNano()
+		result := make([]*Operation, len(ops))
+		for i := range ops {
+			op := ops[i]
+			op.ClientID = c.ID
+			op.Timestamp = now
+			op.Origin = origin
+			op.group = u.groups
+			result[i] = &op
+		}
+		return result
+	}
+	return nil
+}
+
+// UndoDepth returns how many steps a client's user can undo and redo
+func (r *Room) UndoDepth(c *Client) (int, int) {
+	u := &r.undo
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	stacks := u.stacks[c.ClientID]
+	if stacks == nil {
+		return 0, 0
+	}
+	return len(stacks.undo), len(stacks.redo)
+}
+
+// since returns the operations applied after seq, or false if some of them
+// have already left the history. An operation followed by its inverse, such
+// as an edit and its undo, changes nothing, so the pair is left out:
+// transforming through it would lose track of text the first one deleted.
+func (u *undoState) since(seq uint64) ([]Operation, bool) {
+	if seq == u.seq {
+		return nil, true
+	}
+	if len(u.history) == 0 || seq+1 < u.history[0].seq {
+		return nil, false
+	}
+
+	start := int(seq + 1 - u.history[0].seq)
+	kept := make([]appliedOp, 0, len(u.history)-start)
+	for _, applied := range u.history[start:] {
+		if n := len(kept); n > 0 && inverts(applied, kept[n-1]) {
+			kept = kept[:n-1]
+			continue
+		}
+		kept = append(kept, applied)
+	}
+
+	ops := make([]Operation, len(kept))
+	for i, applied := range kept {
+		ops[i] = applied.op
+	}
+	return ops, true
+}
+
+// inverts reports whether b, applied right after a, puts back what a changed
+func inverts(b, a appliedOp) bool {
+	switch {
+	case a.op.Type == "insert" && b.op.Type == "delete":
+		return b.op.Position == a.op.Position && b.deleted == a.op.Content
+	case a.op.Type == "delete" && b.op.Type == "insert":
+		return b.op.Position == a.op.Position && b.op.Content == a.deleted
+	}
+	return false
+}
+
+// resetUndo forgets the history and every stack, for when the content was
+// replaced wholesale and old edits no longer line up with it
+func (r *Room) resetUndo() {
+	u := &r.undo
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	u.history = nil
+	u.stacks = make(map[string]*undoStacks)
+}
+
+// forgetUndo drops a user's stacks once their last session has left
+func (r *Room) forgetUndo(id string) {
+	u := &r.undo
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	delete(u.stacks, id)
+}
+
+// normalizeApplied returns an operation the way Apply treated it, with
+// positions clamped and the deleted text, or false if Apply ignored it
+func normalizeApplied(op *Operation, before string) (appliedOp, bool) {
+	applied := appliedOp{op: Operation{Type: op.Type, Position: op.Position}}
+	switch op.Type {
+	case "insert":
+		if op.Content == "" {
+			return applied, false
+		}
+		applied.op.Position = min(max(op.Position, 0), len(before))
+		applied.op.Content = op.Content
+		return applied, true
+	case "delete":
+		if op.Position < 0 || op.Length <= 0 || op.Position+op.Length > len(before) {
+			return applied, false
+		}
+		applied.op.Length = op.Length
+		applied.deleted = before[op.Position : op.Position+op.Length]
+		return applied, true
+	}
+	return applied, false
+}
+
+// invert returns the operations that take the document back to before ops
+// were applied: each one's inverse, last first
+func invert(ops []appliedOp) []Operation {
+	inverse := make([]Operation, 0, len(ops))
+	for i := len(ops) - 1; i >= 0; i-- {
+		op := ops[i].op
+		switch op.Type {
+		case "insert":
+			inverse = append(inverse, Operation{Type: "delete", Position: op.Position, Length: len(op.Content)})
+		case "delete":
+			inverse = append(inverse, Operation{Type: "insert", Position: op.Position, Content: ops[i].deleted})
+		}
+	}
+	return inverse
+}
+
+// transformOps transforms two sequences of operations made on the same
+// content against each other. The first result applies after b and the
+// second after a, and both orders end with the same content.
+func transformOps(a, b []Operation) ([]Operation, []Operation) {
+	switch {
+	case len(a) == 0 || len(b) == 0:
+		return a, b
+	case len(a) == 1 && len(b) == 1:
+		return transformPair(a[0], b[0])
+	case len(a) > 1:
+		head, b1 := transformOps(a[:1], b)
+		tail, b2 := transformOps(a[1:], b1)
+		return append(head, tail...), b2
+	default:
+		a1, head := transformOps(a, b[:1])
+		a2, tail := transformOps(a1, b[1:])
+		return a2, append(head, tail...)
+	}
+}
+
+// transformPair transforms two operations made on the same content against
+// each other. When both insert at the same place, b's text comes first.
+func transformPair(a, b Operation) ([]Operation, []Operation) {
+	switch {
+	case a.Type == "insert" && b.Type == "insert":
+		if b.Position <= a.Position {
+			a.Position += len(b.Content)
+		} else {
+			b.Position += len(a.Content)
+		}
+		return []Operation{a}, []Operation{b}
+
+	case a.Type == "insert" && b.Type == "delete":
+		bs, as := transformInsertDelete(a, b)
+		return as, bs
+
+	case a.Type == "delete" && b.Type == "insert":
+		return transformInsertDelete(b, a)
+
+	case a.Type == "delete" && b.Type == "delete":
+		return deleteAfter(a, b), deleteAfter(b, a)
+	}
+	return []Operation{a}, []Operation{b}
+}
+
+// transformInsertDelete transforms an insert and a delete made on the same
+// content, returning the delete to apply after the insert and the insert to
+// apply after the delete. Text inserted inside the deleted range survives,
+// splitting the delete in two.
+func transformInsertDelete(ins, del Operation) ([]Operation, []Operation) {
+	n := len(ins.Content)
+	end := del.Position + del.Length
+
+	switch {
+	case ins.Position <= del.Position:
+		del.Position += n
+		return []Operation{del}, []Operation{ins}
+	case ins.Position >= end:
+		ins.Position -= del.Length
+		return []Operation{del}, []Operation{ins}
+	}
+
+	// Delete the part after the insert first so the part before stays put
+	after := Operation{Type: "delete", Position: ins.Position + n, Length: end - ins.Position}
+	before := Operation{Type: "delete", Position: del.Position, Length: ins.Position - del.Position}
+	ins.Position = del.Position
+	return []Operation{after, before}, []Operation{ins}
+}
+
+// deleteAfter returns delete a as it applies after delete b, without the
+// text b already removed
+func deleteAfter(a, b Operation) []Operation {
+	shift := func(offset int) int {
+		switch {
+		case offset >= b.Position+b.Length:
+			return offset - b.Length
+		case offset > b.Position:
+			return b.Position
+		}
+		return offset
+	}
+
+	start, end := shift(a.Position), shift(a.Position+a.Length)
+	if end <= start {
+		return nil
+	}
+	a.Position, a.Length = start, end-start
+	return []Operation{a}
+}
@@ -0,0 +1,223 @@
+package room
+
+import (
+	"math/rand"
+	"testing"
+
+	"collab-editor/pkg/db"
+)
+
+// applyAll applies operations in order
+func applyAll(content string, ops []Operation) string {
+	for i := range ops {
+		content = ops[i].Apply(content)
+	}
+	return content
+}
+
+// randomOps returns up to n operations, each valid on the content the ones
+// before it leave
+func randomOps(rng *rand.Rand, content string, n int) []Operation {
+	const alphabet = "abcxyz\n"
+	var ops []Operation
+	for i := rng.Intn(n + 1); i > 0; i-- {
+		var op Operation
+		if len(content) == 0 || rng.Intn(2) == 0 {
+			text := make([]byte, 1+rng.Intn(3))
+			for j := range text {
+				text[j] = alphabet[rng.Intn(len(alphabet))]
+			}
+			op = Operation{Type: "insert", Position: rng.Intn(len(content) + 1), Content: string(text)}
+		} else {
+			position := rng.Intn(len(content))
+			op = Operation{Type: "delete", Position: position, Length: 1 + rng.Intn(len(content)-position)}
+		}
+		content = op.Apply(content)
+		ops = append(ops, op)
+	}
+	return ops
+}
+
+func TestTransformPair(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		a, b    Operation
+		want    string
+	}{
+		{
+			name:    "inserts at the same place put b first",
+			content: "ac",
+			a:       Operation{Type: "insert", Position: 1, Content: "A"},
+			b:       Operation{Type: "insert", Position: 1, Content: "B"},
+			want:    "aBAc",
+		},
+		{
+			name:    "insert before a delete",
+			content: "abcdef",
+			a:       Operation{Type: "insert", Position: 1, Content: "X"},
+			b:       Operation{Type: "delete", Position: 2, Length: 2},
+			want:    "aXbef",
+		},
+		{
+			name:    "insert inside a delete survives it",
+			content: "abcdef",
+			a:       Operation{Type: "insert", Position: 3, Content: "X"},
+			b:       Operation{Type: "delete", Position: 1, Length: 4},
+			want:    "aXf",
+		},
+		{
+			name:    "insert at the end of a delete",
+			content: "abcdef",
+			a:       Operation{Type: "insert", Position: 4, Content: "X"},
+			b:       Operation{Type: "delete", Position: 1, Length: 3},
+			want:    "aXef",
+		},
+		{
+			name:    "overlapping deletes",
+			content: "abcdef",
+			a:       Operation{Type: "delete", Position: 1, Length: 3},
+			b:       Operation{Type: "delete", Position: 2, Length: 3},
+			want:    "af",
+		},
+		{
+			name:    "one delete inside another",
+			content: "abcdef",
+			a:       Operation{Type: "delete", Position: 0, Length: 6},
+			b:       Operation{Type: "delete", Position: 2, Length: 2},
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := transformPair(tt.a, tt.b)
+			afterB := applyAll(tt.b.Apply(tt.content), a)
+			afterA := applyAll(tt.a.Apply(tt.content), b)
+			if afterB != tt.want || afterA != tt.want {
+				t.Errorf("got %q (b first) and %q (a first), want %q", afterB, afterA, tt.want)
+			}
+		})
+	}
+}
+
+// TestTransformOpsConverges checks that two random sequences of operations
+// made on the same content end with the same content whichever is applied
+// first, the other transformed against it
+func TestTransformOpsConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		content := applyAll("", randomOps(rng, "", 6))
+		a := randomOps(rng, content, 4)
+		b := randomOps(rng, content, 4)
+
+		a2, b2 := transformOps(a, b)
+		afterB := applyAll(applyAll(content, b), a2)
+		afterA := applyAll(applyAll(content, a), b2)
+		if afterA != afterB {
+			t.Fatalf("content %q\na %+v\nb %+v\ngot %q after a then b, %q after b then a", content, a, b, afterA, afterB)
+		}
+	}
+}
+
+// testRoom returns a room with a document and two users, one session each
+func testRoom(content string) (*Room, *Client, *Client) {
+	r := &Room{
+		ID:       "doc",
+		Document: &db.Document{ID: "doc", Content: content},
+		Clients:  make(map[string]*Client),
+		presence: make(map[string]*clientPresence),
+		comments: make(map[string]*db.CommentThread),
+		watchers: make(map[*Watcher]struct{}),
+		undo:     undoState{stacks: make(map[string]*undoStacks)},
+		done:     make(chan struct{}),
+	}
+	alice := &Client{ID: "alice-session", ClientID: "alice", Room: r, Send: make(chan []byte, 1<<16)}
+	bob := &Client{ID: "bob-session", ClientID: "bob", Room: r, Send: make(chan []byte, 1<<16)}
+	r.Clients[alice.ID] = alice
+	r.Clients[bob.ID] = bob
+	return r, alice, bob
+}
+
+// edit applies operations as a client's own edit, each its own undo step
+func edit(r *Room, c *Client, ops []Operation) {
+	for i := range ops {
+		op := ops[i]
+		op.ClientID = c.ID
+		r.ApplyOperations([]*Operation{&op}, c.ID)
+
+		// Don't group it with the next edit
+		if stacks := r.undo.stacks[c.ClientID]; stacks != nil && len(stacks.undo) > 0 {
+			stacks.undo[len(stacks.undo)-1].at = stacks.undo[len(stacks.undo)-1].at.Add(-undoGroupWindow)
+		}
+	}
+}
+
+func TestUndoKeepsOthersEdits(t *testing.T) {
+	r, alice, bob := testRoom("")
+
+	edit(r, alice, []Operation{{Type: "insert", Position: 0, Content: "hello"}})
+	edit(r, bob, []Operation{{Type: "insert", Position: 5, Content: " world"}})
+	edit(r, bob, []Operation{{Type: "insert", Position: 0, Content: ">> "}})
+
+	if ops := r.Undo(alice, false); len(ops) == 0 {
+		t.Fatal("nothing was undone")
+	}
+	if got := r.Document.Content; got != ">>  world" {
+		t.Errorf("after undo got %q", got)
+	}
+
+	r.Undo(alice, true)
+	if got := r.Document.Content; got != ">> hello world" {
+		t.Errorf("after redo got %q", got)
+	}
+}
+
+// TestUndoRedoRoundTrip checks that, with two users editing at random,
+// undoing then redoing one user's latest edit leaves the content as it was
+func TestUndoRedoRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 500; i++ {
+		r, alice, bob := testRoom("")
+		for step := 0; step < 8; step++ {
+			c := alice
+			if rng.Intn(2) == 0 {
+				c = bob
+			}
+			edit(r, c, randomOps(rng, r.Document.Content, 2))
+		}
+
+		before := r.Document.Content
+		if len(r.Undo(alice, false)) > 0 {
+			r.Undo(alice, true)
+			if got := r.Document.Content; got != before {
+				t.Fatalf("undo then redo turned %q into %q", before, got)
+			}
+		}
+	}
+}
+
+// TestUndoAll checks that a user editing alone can undo back to where they
+// started and redo back to where they were
+func TestUndoAll(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for i := 0; i < 500; i++ {
+		start := applyAll("", randomOps(rng, "", 4))
+		r, alice, _ := testRoom(start)
+		for step := 0; step < 8; step++ {
+			edit(r, alice, randomOps(rng, r.Document.Content, 2))
+		}
+		end := r.Document.Content
+
+		for len(r.Undo(alice, false)) > 0 {
+		}
+		if got := r.Document.Content; got != start {
+			t.Fatalf("undoing everything gave %q, want %q", got, start)
+		}
+		for len(r.Undo(alice, true)) > 0 {
+		}
+		if got := r.Document.Content; got != end {
+			t.Fatalf("redoing everything gave %q, want %q", got, end)
+		}
+	}
+}
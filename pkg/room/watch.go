@@ -0,0 +1,57 @@
+package room
+
+import "collab-editor/pkg/db"
+
+// Watcher follows a room's document without joining it: it has no identity
+// or presence, isn't listed among the users and can't edit. Read-only feeds
+// such as the SSE stream use it.
+type Watcher struct {
+	// Send carries operation, document_update, snapshot and diagnostics
+	// frames, exactly as clients get them. It's closed if the watcher falls
+	// behind.
+	Send chan []byte
+}
+
+// Watch starts following the room and returns the document as of that
+// moment; every change accepted after it is sent to the watcher. Changes are
+// applied and sent under the room lock, which Watch holds too, so none is
+// both in the document and sent. Call Unwatch when done.
+func (r *Room) Watch() (*Watcher, db.Document) {
+	w := &Watcher{Send: make(chan []byte, 256)}
+
+	r.mutex.RLock()
+	doc := *r.Document
+	r.watchersMutex.Lock()
+	r.watchers[w] = struct{}{}
+	r.watchersMutex.Unlock()
+	r.mutex.RUnlock()
+
+	return w, doc
+}
+
+// Unwatch stops sending changes to a watcher
+func (r *Room) Unwatch(w *Watcher) {
+	r.watchersMutex.Lock()
+	defer r.watchersMutex.Unlock()
+
+	if _, ok := r.watchers[w]; ok {
+		delete(r.watchers, w)
+		close(w.Send)
+	}
+}
+
+// notifyWatchers sends a document change frame to every watcher, dropping
+// the ones that can't keep up
+func (r *Room) notifyWatchers(data []byte) {
+	r.watchersMutex.Lock()
+	defer r.watchersMutex.Unlock()
+
+	for w := range r.watchers {
+		select {
+		case w.Send <- data:
+		default:
+			delete(r.watchers, w)
+			close(w.Send)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package room
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"collab-editor/pkg/db"
+)
+
+// TestWatchReplays checks that a watcher starting while the document is
+// being edited gets a snapshot and then every change after it, in order, so
+// replaying them ends with the room's content
+func TestWatchReplays(t *testing.T) {
+	r, alice, bob := testRoom("")
+
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	for _, c := range []*Client{alice, bob} {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			for i := 0; i < 60; i++ {
+				if i == 10 && c == alice {
+					close(started)
+				}
+				switch i % 10 {
+				case 9:
+					r.Undo(c, false)
+				case 5:
+					content := fmt.Sprintf("[%s %d]", c.ClientID, i)
+					r.ApplySnapshot(&db.Document{Content: content}, &Snapshot{Content: content}, "")
+				default:
+					op := &Operation{Type: "insert", Position: i, Content: c.ClientID[:1], ClientID: c.ID}
+					r.ApplyOperations([]*Operation{op}, "")
+				}
+			}
+		}(c)
+	}
+
+	<-started
+	watcher, doc := r.Watch()
+	wg.Wait()
+
+	content := doc.Content
+	for len(watcher.Send) > 0 {
+		var frame struct {
+			Type      string     `json:"type"`
+			Content   string     `json:"content"`
+			Operation *Operation `json:"operation"`
+		}
+		if err := json.Unmarshal(<-watcher.Send, &frame); err != nil {
+			t.Fatal(err)
+		}
+		switch frame.Type {
+		case "operation":
+			content = frame.Operation.Apply(content)
+		case "snapshot":
+			content = frame.Content
+		}
+	}
+	if content != r.Document.Content {
+		t.Errorf("replayed %q, room has %q", content, r.Document.Content)
+	}
+}
@@ -0,0 +1,406 @@
+// Package webhook tells registered HTTP endpoints about document events.
+// Every event is stored as a delivery per matching webhook before it's sent,
+// so failed deliveries are retried with backoff, across restarts, and the
+// log of what was sent can be inspected.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"collab-editor/pkg/db"
+	"collab-editor/pkg/room"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidWebhook = errors.New("invalid webhook")
+
+// EventPing is sent when a webhook is tested. Every webhook gets it,
+// whatever it subscribed to.
+const EventPing = "ping"
+
+// Events lists the events a webhook can subscribe to
+var Events = []string{
+	room.EventDocumentCreated,
+	room.EventDocumentUpdated,
+	room.EventDocumentDeleted,
+	room.EventVersionTagged,
+	room.EventUserJoined,
+}
+
+const (
+	// claimBatch is how many due deliveries are sent at once
+	claimBatch = 16
+	// queueSize bounds the events waiting to be turned into deliveries
+	queueSize = 1024
+	// maxResponseBody is how much of an endpoint's response is read
+	maxResponseBody = 64 << 10
+)
+
+// Config configures how deliveries are sent and retried
+type Config struct {
+	// MaxAttempts is how many times a delivery is tried before it's failed
+	MaxAttempts int
+	// Backoff is the delay before the first retry; it doubles after every
+	// failed attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each request
+	Timeout time.Duration
+	// AllowPrivate lets webhooks target loopback and private addresses,
+	// for endpoints on the same host or network
+	AllowPrivate bool
+}
+
+// Payload is the JSON body sent to webhooks
+type Payload struct {
+	ID          string              `json:"id"` // the event's id, the same for every webhook told about it
+	Event       string              `json:"event"`
+	OccurredAt  time.Time           `json:"occurred_at"`
+	WorkspaceID string              `json:"workspace_id,omitempty"`
+	Document    *db.DocumentSummary `json:"document,omitempty"`
+	Data        interface{}         `json:"data,omitempty"`
+}
+
+// Dispatcher turns document events into deliveries and sends them
+type Dispatcher struct {
+	config  Config
+	rooms   *room.RoomManager
+	store   db.WebhookStore
+	folders db.FolderStore // nil when the store has no workspaces
+	client  *http.Client
+	events  chan room.Event
+	wake    chan struct{}
+}
+
+// NewDispatcher creates a dispatcher. The room manager's store must support
+// webhooks.
+func NewDispatcher(cfg Config, rooms *room.RoomManager) (*Dispatcher, error) {
+	store, ok := rooms.Store.(db.WebhookStore)
+	if !ok {
+		return nil, fmt.Errorf("webhooks need a store with webhook support")
+	}
+	folders, _ := rooms.Store.(db.FolderStore)
+
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.Backoff)
+
+	return &Dispatcher{
+		config:  cfg,
+		rooms:   rooms,
+		store:   store,
+		folders: folders,
+		client:  newClient(cfg.Timeout, cfg.AllowPrivate),
+		events:  make(chan room.Event, queueSize),
+		wake:    make(chan struct{}, 1),
+	}, nil
+}
+
+// Webhooks returns the webhook store
+func (d *Dispatcher) Webhooks() db.WebhookStore {
+	return d.store
+}
+
+// CreateWebhook validates a webhook and stores it. A secret is generated
+// when none is given.
+func (d *Dispatcher) CreateWebhook(webhook *db.Webhook) (*db.Webhook, error) {
+	if (webhook.DocumentID == nil) == (webhook.WorkspaceID == nil) {
+		return nil, fmt.Errorf("%w: exactly one of document_id and workspace_id is required", ErrInvalidWebhook)
+	}
+
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if err := checkHost(context.Background(), target.Hostname(), d.config.AllowPrivate); err != nil {
+		return nil, err
+	}
+
+	events := []string{}
+	seen := make(map[string]bool)
+	for _, event := range webhook.Events {
+		if !knownEvent(event) {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+	webhook.Events = events
+
+	if webhook.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		webhook.Secret = hex.EncodeToString(secret)
+	}
+
+	if webhook.DocumentID != nil {
+		if _, err := d.rooms.Store.GetDocument(*webhook.DocumentID); err != nil {
+			return nil, err
+		}
+	} else {
+		if d.folders == nil {
+			return nil, fmt.Errorf("%w: this storage backend has no workspaces", ErrInvalidWebhook)
+		}
+		if _, err := d.folders.GetWorkspace(*webhook.WorkspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.store.CreateWebhook(webhook)
+}
+
+func knownEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle queues a document event for delivery. It never blocks: events are
+// dropped, and logged, when the queue is full. Pass it to
+// RoomManager.Listen.
+func (d *Dispatcher) Handle(event room.Event) {
+	select {
+	case d.events <- event:
+	default:
+		log.Printf("webhooks: queue full, dropping %s for %s", event.Type, event.Document.ID)
+	}
+}
+
+// Ping sends a ping event to a webhook so its endpoint can be tested
+func (d *Dispatcher) Ping(webhook *db.Webhook) (*db.WebhookDelivery, error) {
+	payload := &Payload{
+		ID:         uuid.New().String(),
+		Event:      EventPing,
+		OccurredAt: time.Now(),
+		Data:       map[string]string{"webhook_id": webhook.ID},
+	}
+	delivery, err := d.createDelivery(webhook, payload)
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return delivery, nil
+}
+
+// Run turns queued events into deliveries and sends deliveries when they're
+// due, checking for retries every tick. It blocks until stop is closed.
+func (d *Dispatcher) Run(tick time.Duration, stop <-chan struct{}) {
+	go d.sendLoop(tick, stop)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case event := <-d.events:
+			d.enqueue(event)
+		}
+	}
+}
+
+// enqueue stores a delivery of event for every webhook that wants it
+func (d *Dispatcher) enqueue(event room.Event) {
+	workspaceID := d.workspaceOf(event.Document)
+	webhooks, err := d.store.MatchWebhooks(event.Document.ID, workspaceID, event.Type)
+	if err != nil {
+		log.Printf("webhooks: failed to match %s for %s: %v", event.Type, event.Document.ID, err)
+		return
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+
+	payload := &Payload{
+		ID:          uuid.New().String(),
+		Event:       event.Type,
+		OccurredAt:  event.Time,
+		WorkspaceID: workspaceID,
+		Document:    event.Document.Summary(),
+		Data:        event.Data,
+	}
+	for _, webhook := range webhooks {
+		if _, err := d.createDelivery(webhook, payload); err != nil {
+			log.Printf("webhooks: failed to queue %s for webhook %s: %v", event.Type, webhook.ID, err)
+		}
+	}
+	d.notify()
+}
+
+// workspaceOf returns the workspace a document's folder is in, or "" for
+// documents outside any folder
+func (d *Dispatcher) workspaceOf(doc *db.Document) string {
+	if doc.FolderID == nil || d.folders == nil {
+		return ""
+	}
+	folder, err := d.folders.GetFolder(*doc.FolderID)
+	if err != nil {
+		log.Printf("webhooks: failed to get folder %s: %v", *doc.FolderID, err)
+		return ""
+	}
+	return folder.WorkspaceID
+}
+
+func (d *Dispatcher) createDelivery(webhook *db.Webhook, payload *Payload) (*db.WebhookDelivery, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	now := time.Now()
+	return d.store.CreateWebhookDelivery(&db.WebhookDelivery{
+		WebhookID:     webhook.ID,
+		EventID:       payload.ID,
+		Event:         payload.Event,
+		Payload:       body,
+		Status:        db.DeliveryPending,
+		NextAttemptAt: &now,
+	})
+}
+
+// notify wakes the send loop without waiting for the next tick
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+		// already awake
+	}
+}
+
+func (d *Dispatcher) sendLoop(tick time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+		d.sendDue()
+	}
+}
+
+// sendDue sends every delivery that's due, a batch at a time
+func (d *Dispatcher) sendDue() {
+	for {
+		now := time.Now()
+		// Claimed deliveries aren't due again until their attempt has had
+		// time to finish
+		deliveries, err := d.store.ClaimWebhookDeliveries(now, now.Add(2*d.config.Timeout+time.Minute), claimBatch)
+		if err != nil {
+			log.Printf("webhooks: failed to claim deliveries: %v", err)
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func(delivery *db.WebhookDelivery) {
+				defer wg.Done()
+				d.attempt(delivery)
+			}(delivery)
+		}
+		wg.Wait()
+
+		if len(deliveries) < claimBatch {
+			return
+		}
+	}
+}
+
+// attempt sends a delivery once and records the outcome, scheduling a retry
+// or giving up when it fails
+func (d *Dispatcher) attempt(delivery *db.WebhookDelivery) {
+	webhook, err := d.store.GetWebhook(delivery.WebhookID)
+	if err != nil {
+		if !errors.Is(err, db.ErrWebhookNotFound) {
+			log.Printf("webhooks: failed to get webhook %s: %v", delivery.WebhookID, err)
+		}
+		return
+	}
+
+	status, err := d.send(webhook, delivery)
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+
+	switch {
+	case err == nil:
+		delivery.Status = db.DeliveryDelivered
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+	case delivery.Attempts >= d.config.MaxAttempts:
+		delivery.Status = db.DeliveryFailed
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = nil
+		delivery.CompletedAt = &now
+		log.Printf("webhooks: giving up on delivery %s to %s after %d attempts: %v", delivery.Event, webhook.URL, delivery.Attempts, err)
+	default:
+		next := now.Add(d.backoff(delivery.Attempts))
+		delivery.Error = err.Error()
+		delivery.NextAttemptAt = &next
+	}
+
+	if err := d.store.UpdateWebhookDelivery(delivery); err != nil && !errors.Is(err, db.ErrWebhookNotFound) {
+		log.Printf("webhooks: failed to record delivery %d: %v", delivery.ID, err)
+	}
+}
+
+// send posts a delivery's payload, signed, and returns the response status.
+// Anything but a 2xx is an error.
+func (d *Dispatcher) send(webhook *db.Webhook, delivery *db.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "collab-editor-webhooks")
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Delivery", fmt.Sprint(delivery.ID))
+	req.Header.Set("X-Webhook-Timestamp", fmt.Sprint(timestamp))
+	req.Header.Set("X-Webhook-Signature", Sign(webhook.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after a delivery's nth failed attempt
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.Backoff
+	for i := 1; i < attempts && delay < d.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.config.MaxBackoff)
+}
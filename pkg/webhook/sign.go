@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// signaturePrefix names the algorithm in X-Webhook-Signature
+const signaturePrefix = "sha256="
+
+// Sign returns the X-Webhook-Signature value for a body sent at timestamp
+// (Unix seconds, also sent as X-Webhook-Timestamp): the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed by the webhook's secret. Covering the timestamp
+// lets receivers reject replayed requests.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the one Sign makes for the body and
+// timestamp, comparing in constant time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
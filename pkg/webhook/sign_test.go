@@ -0,0 +1,65 @@
+package webhook
+
+import "testing"
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{
+			name:      "payload",
+			secret:    "secret",
+			timestamp: 1700000000,
+			body:      `{"event":"ping"}`,
+			want:      "sha256=4d39bd2442f073b6bc62e95d0297ce25475582a17389ab860abdc778fe1d9f77",
+		},
+		{
+			name:      "empty",
+			secret:    "",
+			timestamp: 0,
+			body:      "",
+			want:      "sha256=b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("Sign() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"ping"}`)
+	signature := Sign("secret", 1700000000, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		signature string
+		want      bool
+	}{
+		{"matching", "secret", 1700000000, string(body), signature, true},
+		{"other secret", "other", 1700000000, string(body), signature, false},
+		{"other timestamp", "secret", 1700000001, string(body), signature, false},
+		{"other body", "secret", 1700000000, `{"event":"pong"}`, signature, false},
+		{"no prefix", "secret", 1700000000, string(body), signature[len(signaturePrefix):], false},
+		{"empty signature", "secret", 1700000000, string(body), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, []byte(tt.body), tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenTarget is returned for webhook URLs that point at this host or
+// its private network, which a webhook could otherwise be used to probe
+var ErrForbiddenTarget = fmt.Errorf("%w: url must point at a public address", ErrInvalidWebhook)
+
+// publicAddress reports whether ip can be a webhook target: not loopback,
+// private, link-local, multicast or unspecified
+func publicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsValid() &&
+		!ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() &&
+		!ip.IsUnspecified()
+}
+
+// checkHost resolves a webhook URL's host and fails unless every address it
+// resolves to is public, or allowPrivate is set. The check is repeated on
+// every connection, since the name may resolve differently by then.
+func checkHost(ctx context.Context, host string, allowPrivate bool) error {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		if !allowPrivate && !publicAddress(ip) {
+			return ErrForbiddenTarget
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("%w: failed to resolve %s: %v", ErrInvalidWebhook, host, err)
+	}
+	for _, addr := range addrs {
+		if !allowPrivate && !publicAddress(addr) {
+			return ErrForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. Unless
+// allowPrivate is set it only connects to public addresses, checked on the
+// address actually dialed so a name can't be re-pointed after the webhook is
+// created. It doesn't follow redirects, which could lead anywhere; a
+// redirect is reported as the response.
+func newClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !publicAddress(addrPort.Addr()) {
+				return ErrForbiddenTarget
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
@@ -0,0 +1,128 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2001:4860:4860::8888", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:8.8.8.8", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := publicAddress(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Errorf("publicAddress(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		name         string
+		host         string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{name: "public", host: "8.8.8.8"},
+		{name: "loopback", host: "127.0.0.1", wantErr: ErrForbiddenTarget},
+		{name: "private", host: "10.0.0.1", wantErr: ErrForbiddenTarget},
+		{name: "link-local", host: "169.254.169.254", wantErr: ErrForbiddenTarget},
+		{name: "ipv6 loopback", host: "::1", wantErr: ErrForbiddenTarget},
+		{name: "name of loopback", host: "localhost", wantErr: ErrForbiddenTarget},
+		{name: "loopback allowed", host: "127.0.0.1", allowPrivate: true},
+		{name: "private allowed", host: "10.0.0.1", allowPrivate: true},
+		{name: "name of loopback allowed", host: "localhost", allowPrivate: true},
+		{name: "unresolvable", host: "nonexistent.invalid", wantErr: ErrInvalidWebhook},
+		{name: "unresolvable allowed", host: "nonexistent.invalid", allowPrivate: true, wantErr: ErrInvalidWebhook},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHost(context.Background(), tt.host, tt.allowPrivate)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("checkHost(%q) = %v, want nil", tt.host, err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkHost(%q) = %v, want %v", tt.host, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientDial(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name         string
+		allowPrivate bool
+		wantErr      error
+	}{
+		{name: "refused", wantErr: ErrForbiddenTarget},
+		{name: "allowed", allowPrivate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newClient(5*time.Second, tt.allowPrivate)
+			resp, err := client.Get(server.URL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get(%s) error = %v, want %v", server.URL, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get(%s) error = %v", server.URL, err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusNoContent)
+			}
+		})
+	}
+}
+
+func TestClientRedirect(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/elsewhere", http.StatusFound)
+	}))
+	defer server.Close()
+
+	resp, err := newClient(5*time.Second, true).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get(%s) error = %v", server.URL, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("status = %d, want the redirect %d reported", resp.StatusCode, http.StatusFound)
+	}
+}
@@ -30,6 +30,9 @@ createdb -h $DB_HOST -p $DB_PORT -U $DB_USER $DB_NAME 2>/dev/null || echo "Datab
 
 echo "Database setup complete!"
 echo ""
+echo "Apply the schema with:"
+echo "  go run main.go migrate"
+echo ""
 echo "You can now start the server with:"
 echo "  go run main.go"
 echo ""